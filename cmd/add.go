@@ -9,16 +9,17 @@ import (
 
 	_ "embed"
 
-	"github.com/protomoks/pmok/internal/config"
 	"github.com/protomoks/pmok/internal/functions/add"
 	"github.com/protomoks/pmok/internal/ux"
 	"github.com/spf13/cobra"
 )
 
 var (
-	path    string
-	name    string
-	methods []string
+	path         string
+	name         string
+	methods      []string
+	proto        string
+	grpcServices []string
 )
 
 // addCmd represents the add command
@@ -27,10 +28,7 @@ var addCmd = &cobra.Command{
 	Short: "Add a function handler",
 	Long:  `Add a function handler`,
 	Run: func(cmd *cobra.Command, args []string) {
-		conf := config.GetConfig()
-		if conf == nil {
-			log.Fatal("could not find a protomok project")
-		}
+		conf := mustLoadConfig()
 		fmt.Println(conf.Manifest)
 		if err := add.AddFunction(add.AddFunctionCommand{
 			Name:           name,
@@ -46,8 +44,37 @@ var addCmd = &cobra.Command{
 	},
 }
 
+var addGrpcCmd = &cobra.Command{
+	Use:   "grpc",
+	Short: "Add the gRPC services of a .proto file",
+	Long: `Add the gRPC services of a .proto file
+
+The services are registered in the manifest and every method gets a mock spec
+in protomok/mocks/grpc, answering with an empty message. Edit the JSON messages
+of the specs, pmok serve transcodes them to protobuf and serves the services
+on the gRPC port of the manifest, 50051 by default`,
+	Run: func(cmd *cobra.Command, args []string) {
+		services, err := add.AddGrpc(add.AddGrpcCommand{
+			Proto:    proto,
+			Services: grpcServices,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s := ux.DefaultStyleRenderer()
+		for _, svc := range services {
+			fmt.Printf("Added %s\n", s.SuccessText.Render(svc))
+		}
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(addCmd)
+	addCmd.AddCommand(addGrpcCmd)
+	addGrpcCmd.Flags().StringVar(&proto, "proto", "", "the .proto file defining the services")
+	addGrpcCmd.Flags().StringSliceVar(&grpcServices, "service", nil, "the services to add, all services of the proto by default")
+	addGrpcCmd.MarkFlagRequired("proto")
 	addCmd.Flags().StringVarP(&path, "path", "p", "", "the url path pattern")
 	addCmd.Flags().StringVarP(&name, "name", "n", "", "the name of the function")
 	addCmd.Flags().StringSliceVar(&methods, "m", []string{"GET"}, "the http methods this function responds to")
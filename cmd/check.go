@@ -0,0 +1,46 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/protomoks/pmok/internal/routing"
+	"github.com/protomoks/pmok/internal/ux"
+	"github.com/spf13/cobra"
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Report ambiguous and shadowed routes",
+	Long: `Checks the functions of the manifest and the mocks directory for routes
+that overlap with the same priority and specificity (ambiguous), or that are
+covered by a higher ranked route and never served (shadowed).
+Exits with a non-zero status if any conflict is found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadProfileConfig()
+		routes, err := routing.FromProject(conf)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s := ux.DefaultStyleRenderer()
+		conflicts := routing.Check(routes)
+		if len(conflicts) == 0 {
+			fmt.Println(s.SuccessText.Render(fmt.Sprintf("No conflicts in %d routes", len(routes))))
+			return
+		}
+		for _, c := range conflicts {
+			fmt.Printf("%s %s\n", s.ErrorHeaderText.Render(string(c.Kind)), c)
+		}
+		os.Exit(1)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
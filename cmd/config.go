@@ -0,0 +1,114 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/ux"
+	"github.com/spf13/cobra"
+)
+
+var (
+	convertTo        string
+	convertOverwrite bool
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and convert the project manifest",
+}
+
+// convertCmd represents the config convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert the manifest between yaml and json",
+	Long: `Rewrites protomok/pmok.yaml as protomok/pmok.json or the other way around
+and removes the old file. Comments of a yaml manifest are lost when
+converting to json.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadConfig()
+		res, err := config.Convert(conf, config.ConfigFormat(convertTo), convertOverwrite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s := ux.DefaultStyleRenderer()
+		if res.From == res.To {
+			fmt.Println(s.SuccessText.Render(fmt.Sprintf("Manifest is already %s", convertTo)))
+			return
+		}
+		if res.LostComments {
+			fmt.Fprintf(os.Stderr, "warning: the comments of %s were not kept\n", res.From)
+		}
+		fmt.Println(s.SuccessText.Render(fmt.Sprintf("Converted %s to %s", res.From, res.To)))
+	},
+}
+
+// showCmd represents the config show command
+var showCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective manifest",
+	Long: `Prints the manifest as pmok serve uses it: migrated to the current version,
+with the profile selected by --profile or PMOK_PROFILE merged in.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadProfileConfig()
+		b, err := conf.Manifest.Marshal()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(b)
+	},
+}
+
+// mustLoadConfig loads the base manifest of the project of the working
+// directory, printing its warnings. Commands that write the manifest use it,
+// PMOK_PROFILE is ignored so exporting it does not make them fail. It exits
+// when the project cannot be loaded
+func mustLoadConfig() *config.Config {
+	return loadConfig(profile)
+}
+
+// mustLoadProfileConfig loads the manifest with the profile of --profile or
+// PMOK_PROFILE merged in, for commands that only read it
+func mustLoadProfileConfig() *config.Config {
+	return loadConfig(selectedProfile())
+}
+
+func selectedProfile() string {
+	if profile != "" {
+		return profile
+	}
+	return os.Getenv(config.ProfileEnv)
+}
+
+func loadConfig(profile string) *config.Config {
+	var opts []config.Option
+	if profile != "" {
+		opts = append(opts, config.WithProfile(profile))
+	}
+	if strictEnv {
+		opts = append(opts, config.WithStrictEnv(true))
+	}
+	conf, err := config.LoadConfig(opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, w := range conf.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	return conf
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(convertCmd)
+	configCmd.AddCommand(showCmd)
+	convertCmd.Flags().StringVar(&convertTo, "to", "", "the target format, yaml or json")
+	convertCmd.Flags().BoolVar(&convertOverwrite, "overwrite", false, "replace an existing manifest in the target format")
+	convertCmd.MarkFlagRequired("to")
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/protomoks/pmok/internal/functions/manage"
+	"github.com/protomoks/pmok/internal/ux"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rmKeepFiles   bool
+	updatePath    string
+	updateMethods []string
+)
+
+// functionsCmd represents the functions command
+var functionsCmd = &cobra.Command{
+	Use:   "functions",
+	Short: "List and manage function handlers",
+}
+
+var functionsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the functions of the manifest",
+	Long: `Lists the functions of the manifest with their path, methods and
+entrypoint. Functions whose directory or entrypoint is missing, and function
+directories missing from the manifest, are reported.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadProfileConfig()
+		infos, err := manage.List(conf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPATH\tMETHODS\tENTRYPOINT")
+		for _, fn := range infos {
+			name := fn.Name
+			if fn.Disabled {
+				name += " (disabled)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, fn.HttpPathname, strings.Join(fn.AllowedMethods, ","), fn.Entrypoint)
+		}
+		w.Flush()
+
+		s := ux.DefaultStyleRenderer()
+		for _, fn := range infos {
+			for _, p := range fn.Problems {
+				fmt.Printf("%s %s: %s\n", s.ErrorHeaderText.Render("warning"), fn.Name, p)
+			}
+		}
+	},
+}
+
+var functionsRmCmd = &cobra.Command{
+	Use:   "rm <name>",
+	Short: "Remove a function and its directory",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadConfig()
+		if err := manage.Remove(conf, args[0], rmKeepFiles); err != nil {
+			log.Fatal(err)
+		}
+		s := ux.DefaultStyleRenderer()
+		fmt.Printf("Removed %s\n", s.SuccessText.Render(args[0]))
+	},
+}
+
+var functionsMvCmd = &cobra.Command{
+	Use:   "mv <name> <new-name>",
+	Short: "Rename a function and its directory",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadConfig()
+		if err := manage.Rename(conf, args[0], args[1]); err != nil {
+			log.Fatal(err)
+		}
+		s := ux.DefaultStyleRenderer()
+		fmt.Printf("Renamed %s to %s\n", args[0], s.SuccessText.Render(args[1]))
+	},
+}
+
+var functionsUpdateCmd = &cobra.Command{
+	Use:   "update <name>",
+	Short: "Change the path or the methods of a function",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadConfig()
+		if err := manage.Update(conf, manage.UpdateFunctionCommand{
+			Name:           args[0],
+			HttpPath:       updatePath,
+			AllowedMethods: updateMethods,
+		}); err != nil {
+			log.Fatal(err)
+		}
+		s := ux.DefaultStyleRenderer()
+		fmt.Printf("Updated %s\n", s.SuccessText.Render(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(functionsCmd)
+	functionsCmd.AddCommand(functionsListCmd, functionsRmCmd, functionsMvCmd, functionsUpdateCmd)
+	functionsRmCmd.Flags().BoolVar(&rmKeepFiles, "keep-files", false, "only remove the function from the manifest")
+	functionsUpdateCmd.Flags().StringVarP(&updatePath, "path", "p", "", "the new url path pattern")
+	functionsUpdateCmd.Flags().StringSliceVar(&updateMethods, "methods", nil, "the new http methods")
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/protomoks/pmok/internal/functions/serve/docker"
+	"github.com/protomoks/pmok/internal/utils/constants"
+	"github.com/protomoks/pmok/pkg/pmokclient"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logsRequests bool
+	logsServer   string
+	logsQuery    pmokclient.RequestQuery
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show the logs or the request journal of the mock server",
+	Long: `Streams the logs of the running mock server.
+With --requests, prints the request journal instead: every request the mock
+server received, what served it and the response status. The mock server
+keeps the last 1000 requests, set PMOK_JOURNAL_SIZE in the env of the server
+section of the manifest to keep more, or 0 to turn the journal off.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !logsRequests {
+			cm, err := docker.NewContainerManager()
+			if err != nil {
+				log.Fatalf("Error %s\n", err)
+			}
+			if err := cm.StreamLogs(cmd.Context(), constants.FunctionsServerContainer, os.Stderr, os.Stdout); err != nil {
+				log.Fatalf("Error %s\n", err)
+			}
+			return
+		}
+
+		reqs, err := pmokclient.New(logsServer).Requests(cmd.Context(), logsQuery)
+		if err != nil {
+			log.Fatalf("unable to read the request journal. Is the mock server running? %s", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tMETHOD\tPATH\tSTATUS\tMATCH\tDURATION")
+		for _, r := range reqs {
+			match := r.Match.Type
+			if r.Match.Name != "" {
+				match += " " + r.Match.Name
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%dms\n",
+				r.ID, r.Time.Format("15:04:05.000"), r.Method, r.Path, r.Status, match, r.DurationMs)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().BoolVar(&logsRequests, "requests", false, "print the request journal instead of the server logs")
+	logsCmd.Flags().StringVar(&logsServer, "server", pmokclient.DefaultBaseURL, "the address of the mock server")
+	logsCmd.Flags().StringVar(&logsQuery.Method, "method", "", "only show requests with this http method")
+	logsCmd.Flags().StringVar(&logsQuery.Path, "path", "", "only show requests matching this path pattern")
+	logsCmd.Flags().StringVar(&logsQuery.Match, "match", "", "only show requests served by this mock, function or match type")
+	logsCmd.Flags().IntVar(&logsQuery.Limit, "limit", 0, "only show the most recent requests")
+}
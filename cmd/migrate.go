@@ -0,0 +1,64 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/utils/constants"
+	"github.com/protomoks/pmok/internal/ux"
+	"github.com/spf13/cobra"
+)
+
+var migrateDryRun bool
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the manifest to the current version",
+	Long: fmt.Sprintf(`Upgrades protomok/pmok.yaml (or pmok.json) to manifest version %s.
+Outdated manifests are already upgraded in memory when loaded, migrate
+writes the upgrade to disk and keeps the previous file as a backup.
+Use --dry-run to print the changes without writing them.`, constants.DefaultManifestVersion),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadConfig()
+		res, err := config.Migrate(conf, migrateDryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s := ux.DefaultStyleRenderer()
+		if len(res.Applied) == 0 {
+			fmt.Println(s.SuccessText.Render(fmt.Sprintf("Manifest is up to date (version %s)", constants.DefaultManifestVersion)))
+			return
+		}
+		for _, m := range res.Applied {
+			fmt.Printf("%s -> %s: %s\n", m.From, m.To, m.Description)
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(res.Before)),
+			B:        difflib.SplitLines(string(res.After)),
+			FromFile: res.Path,
+			ToFile:   res.Path,
+			Context:  3,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(diff)
+		if migrateDryRun {
+			return
+		}
+		fmt.Printf("Backup written to %s\n", res.BackupPath)
+		fmt.Println(s.SuccessText.Render(fmt.Sprintf("Migrated manifest to version %s", constants.DefaultManifestVersion)))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "print the changes without writing them")
+}
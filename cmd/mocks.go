@@ -0,0 +1,151 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/protomoks/pmok/internal/mocks"
+	"github.com/protomoks/pmok/internal/ux"
+	"github.com/spf13/cobra"
+)
+
+const routeHelp = `A route is a file relative to protomok/mocks, with or without .json, a
+request path such as /users/:id, or a method and a path such as "POST /users".`
+
+// mocksCmd represents the mocks command
+var mocksCmd = &cobra.Command{
+	Use:   "mocks",
+	Short: "List and manage recorded mocks",
+}
+
+var mocksLsCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List the mocks of the project",
+	Run: func(cmd *cobra.Command, args []string) {
+		// broken specs are reported after the ones that could be read
+		files, err := mocks.List(mustLoadConfig())
+		if err != nil && files == nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "METHOD\tPATH\tSTATUS\tCONTENT TYPE\tSIZE\tFILE")
+		for _, f := range files {
+			s := f.Spec
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\n",
+				s.Request.Method, s.Request.RequestPath, s.Response.Status, mocks.ContentType(s), f.Size, f.Path)
+		}
+		w.Flush()
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var mocksShowCmd = &cobra.Command{
+	Use:   "show <route>",
+	Short: "Print a mock",
+	Long:  "Prints the spec of a mock.\n" + routeHelp,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadConfig()
+		f, err := mocks.Find(conf, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		b, err := os.ReadFile(filepath.Join(mocks.Dir(conf), f.Path))
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(b)
+	},
+}
+
+var mocksRmCmd = &cobra.Command{
+	Use:   "rm <route>",
+	Short: "Delete a mock",
+	Long:  "Deletes the spec of a mock.\n" + routeHelp,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := mocks.Remove(mustLoadConfig(), args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		s := ux.DefaultStyleRenderer()
+		fmt.Printf("Removed %s\n", s.SuccessText.Render(f.Path))
+	},
+}
+
+var mocksEditCmd = &cobra.Command{
+	Use:   "edit <route>",
+	Short: "Edit a mock in $EDITOR",
+	Long: `Opens the spec of a mock in $EDITOR and saves it once it is a valid spec.
+` + routeHelp,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadConfig()
+		f, err := mocks.Find(conf, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+		in := bufio.NewReader(os.Stdin)
+		changed, err := mocks.Edit(conf, f, editor, func(err error) bool {
+			fmt.Printf("The mock is invalid: %s\nEdit again? [Y/n] ", err)
+			answer, _ := in.ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			return answer == "" || answer == "y" || answer == "yes"
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		s := ux.DefaultStyleRenderer()
+		if !changed {
+			fmt.Println("No changes")
+			return
+		}
+		fmt.Printf("Saved %s\n", s.SuccessText.Render(f.Path))
+	},
+}
+
+var mocksDiffCmd = &cobra.Command{
+	Use:   "diff <route> <route>",
+	Short: "Compare two mocks",
+	Long:  "Prints a unified diff of two mocks.\n" + routeHelp,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := mustLoadConfig()
+		a, err := mocks.Find(conf, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		b, err := mocks.Find(conf, args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		diff, err := mocks.Diff(conf, a, b)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(diff)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mocksCmd)
+	mocksCmd.AddCommand(mocksLsCmd, mocksShowCmd, mocksRmCmd, mocksEditCmd, mocksDiffCmd)
+}
@@ -4,25 +4,69 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
 	"log"
+	"path/filepath"
 
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/grpcmock"
 	"github.com/protomoks/pmok/internal/recorder"
 	"github.com/spf13/cobra"
 )
 
 var (
-	target   string
-	mockpath string
+	target      string
+	mockpath    string
+	maxBodySize int64
+	largeBodies string
+	queueSize   int
 )
 
 // recordCmd represents the record command
 var recordCmd = &cobra.Command{
 	Use:   "record",
 	Short: "Start a proxy to record requests and responses",
+	Long: `Starts a proxy to record requests and responses. Responses stream to the
+client while they are written to disk.
+
+Bodies larger than --max-body-size are stored in a .body file next to the
+mock, or not recorded with --large-bodies skip.
+
+gRPC calls are proxied over HTTP/2 and recorded as JSON messages for the
+services registered in the manifest with pmok add grpc. Their specs are
+stored in the grpc directory, where pmok add grpc creates them, and calls
+larger than --max-body-size are not recorded.
+
+GraphQL requests to the GraphQL path of the manifest, /graphql by default,
+are recorded by operation name and variables, so the operations sent to the
+endpoint get a mock each.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		// gRPC calls are recorded for the services of the manifest, when run
+		// inside a project. A broken manifest is reported, not ignored
+		var reg *grpcmock.Registry
+		var graphqlPath string
+		conf, err := config.LoadConfig()
+		switch {
+		case errors.Is(err, config.ErrProjectNotFound):
+		case err != nil:
+			log.Fatalln(err)
+		default:
+			graphqlPath = conf.Manifest.Graphql.GraphqlPath()
+			if conf.Manifest.Grpc != nil {
+				reg, err = grpcmock.Load(filepath.Join(conf.GetProjectDir(), config.ProtomokDir), conf.Manifest.Grpc)
+				if err != nil {
+					log.Fatalln(err)
+				}
+			}
+		}
 		if err := recorder.Run(cmd.Context(), recorder.RecordCommand{
 			Target:        target,
 			ResponsesPath: mockpath,
+			MaxBodySize:   maxBodySize,
+			LargeBodies:   largeBodies,
+			QueueSize:     queueSize,
+			Grpc:          reg,
+			GraphqlPath:   graphqlPath,
 		}); err != nil {
 			log.Fatalln(err)
 		}
@@ -34,6 +78,9 @@ func init() {
 	rootCmd.AddCommand(recordCmd)
 	recordCmd.Flags().StringVarP(&target, "target", "t", "", "The target url you want to record responses for")
 	recordCmd.Flags().StringVarP(&mockpath, "path", "p", "", "If provided, mocks are stored in this path")
+	recordCmd.Flags().Int64Var(&maxBodySize, "max-body-size", recorder.DefaultMaxBodySize, "The largest body in bytes stored in a mock")
+	recordCmd.Flags().StringVar(&largeBodies, "large-bodies", recorder.LargeBodiesFile, "What to do with larger bodies, file or skip")
+	recordCmd.Flags().IntVar(&queueSize, "queue-size", recorder.DefaultQueueSize, "The number of responses waiting to be written before requests wait")
 
 	recordCmd.MarkFlagRequired("target")
 
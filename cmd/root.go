@@ -12,6 +12,13 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	// profile selects the pmok.<profile>.yaml manifest overlay
+	profile string
+	// strictEnv fails on ${VAR} references to unset variables
+	strictEnv bool
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "pmok",
@@ -40,6 +47,8 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.pmok.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "merge protomok/pmok.<profile>.yaml into the manifest (default $PMOK_PROFILE, for commands that only read it)")
+	rootCmd.PersistentFlags().BoolVar(&strictEnv, "strict-env", false, "fail on ${VAR} references to unset environment variables (default $PMOK_STRICT_ENV)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
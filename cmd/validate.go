@@ -0,0 +1,77 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/ux"
+	"github.com/protomoks/pmok/internal/validate"
+	"github.com/spf13/cobra"
+)
+
+var validateSchema string
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the manifest, functions and mock specs",
+	Long: `Validates protomok/pmok.yaml (or pmok.json) and every mock spec in
+protomok/mocks against their JSON schemas, checks that function entrypoints
+exist and that templates, scenarios and faults are well formed.
+Every problem is reported with its file, line and field. Exits with a
+non-zero status if any problem is found. The profile of --profile or
+PMOK_PROFILE is checked to merge into a manifest pmok serve can load.
+
+Use --schema manifest or --schema spec to print a schema, e.g. for editor
+integration.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if validateSchema != "" {
+			b, err := validate.Schema(validateSchema)
+			if err != nil {
+				log.Fatalf("unknown schema %q, expected manifest or spec", validateSchema)
+			}
+			os.Stdout.Write(b)
+			return
+		}
+
+		wd, err := os.Getwd()
+		if err != nil {
+			log.Fatal(err)
+		}
+		root, err := config.ResolveProjectDir(wd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		issues, err := validate.Project(root)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the problems of a valid base manifest are the profile's
+		if p := selectedProfile(); p != "" && len(issues) == 0 {
+			if _, err := config.ReadConfig(root, config.WithProfile(p)); err != nil {
+				issues = append(issues, validate.Issue{File: config.ProtomokDir, Field: "profile " + p, Message: err.Error()})
+			}
+		}
+
+		s := ux.DefaultStyleRenderer()
+		if len(issues) == 0 {
+			fmt.Println(s.SuccessText.Render("Project is valid"))
+			return
+		}
+		for _, i := range issues {
+			fmt.Println(i)
+		}
+		fmt.Println(s.ErrorHeaderText.Render(fmt.Sprintf("%d problems found", len(issues))))
+		os.Exit(1)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringVar(&validateSchema, "schema", "", "print the JSON schema of the manifest or spec instead of validating")
+}
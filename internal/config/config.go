@@ -2,36 +2,92 @@ package config
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"sync"
+
+	"github.com/protomoks/pmok/internal/utils"
 )
 
 type Config struct {
 	Name     string
 	Manifest ManifestConfig
+	// Profile is the overlay merged into Manifest, if any
+	Profile string
+	// Migrations were applied in memory to an outdated manifest file
+	Migrations []Migration
+	// Warnings are problems with the project that did not prevent loading
+	Warnings []string
+	// raw is the manifest file as loaded or last committed, nil when the
+	// config was not read from disk
+	raw []byte
 }
 
 func (c *Config) GetProjectDir() string {
 	return c.Manifest.rootDir
 }
 
-// Commits the contents of Config.Manifest to the manifest file
-func (c Config) Commit() error {
-	b, err := marshal(&c.Manifest)
-	if err != nil {
-		return err
+// Commit writes Config.Manifest to the manifest file, replacing it
+// atomically under the manifest lock and keeping its mode. Edits of a yaml
+// manifest keep its comments and key order. The lock is not held since the
+// config was loaded, so ErrManifestChanged is returned when the file changed
+// in between. ErrProfileActive is returned when a profile is merged in
+func (c *Config) Commit() error {
+	if c.Profile != "" {
+		return fmt.Errorf("%w: %s", ErrProfileActive, c.Profile)
 	}
-	f, err := os.OpenFile(c.Manifest.ConfigPath(), os.O_WRONLY|os.O_TRUNC, 0644)
+	b, err := c.marshalManifest()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	p := c.Manifest.ConfigPath()
+	return withManifestLock(c.Manifest.rootDir, func() error {
+		if err := checkUnchanged(p, c.raw); err != nil {
+			return err
+		}
+		if err := utils.WriteFileAtomic(p, b, 0644); err != nil {
+			return err
+		}
+		c.raw = b
+		return nil
+	})
+}
 
-	_, err = io.Copy(f, bytes.NewBuffer(b))
-	return err
+func (c *Config) marshalManifest() ([]byte, error) {
+	return encodeManifest(c.raw, &c.Manifest)
+}
+
+// encodeManifest encodes m as an update of the manifest file original. A
+// yaml manifest is updated in place, only the nodes that changed are
+// touched. Values that still equal the expansion of their ${VAR} are written
+// as the variable
+func encodeManifest(original []byte, m *ManifestConfig) ([]byte, error) {
+	if original == nil {
+		return marshal(m)
+	}
+	if m.format == ConfigYaml {
+		return mergeYAML(original, m)
+	}
+	if !hasVariables(string(original)) {
+		return marshal(m)
+	}
+	var before, after any
+	if err := json.Unmarshal(original, &before); err != nil {
+		return marshal(m)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &after); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(keepVariables(before, after), "", "\t")
 }
 
 var (
@@ -39,55 +95,124 @@ var (
 	once sync.Once
 )
 
+// GetConfig returns the project of the working directory, loaded once, or
+// nil if it cannot be loaded. Use LoadConfig to know why
 func GetConfig() *Config {
 	once.Do(func() {
-		wd, err := os.Getwd()
-		if err != nil {
-			return
-		}
-		dir, err := ResolveProjectDir(wd)
-		if err != nil {
-			return
-		}
-		mbytes, format, err := readManifestFile(dir)
-		if err != nil {
-			return
-		}
-		var manifest ManifestConfig
-		if err := unmarshal(mbytes, &manifest, format); err != nil {
-			return
-		}
-		manifest.format = format
-		manifest.rootDir = dir
-		cfg = &Config{
-			Name:     ConfigFileName + "." + string(format),
-			Manifest: manifest,
-		}
+		cfg, _ = LoadConfig()
 	})
 	return cfg
 }
 
-func readManifestFile(dir string) ([]byte, ConfigFormat, error) {
-	format := checkFormat(dir)
+// LoadConfig loads the project the working directory belongs to. It returns
+// ErrProjectNotFound, a *ManifestReadError, a *ManifestParseError or an
+// *UnsupportedVersionError when the project cannot be loaded
+func LoadConfig(opts ...Option) (*Config, error) {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	wd, err := options.FileSystem.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return loadConfig(options, wd)
+}
+
+// ReadConfig reads the project that dir belongs to. dir can be the project
+// root, the protomok directory or any directory below them
+func ReadConfig(dir string, opts ...Option) (*Config, error) {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return loadConfig(options, dir)
+}
+
+func loadConfig(options Options, dir string) (*Config, error) {
+	fs := options.FileSystem
+	dir, err := resolveProjectDir(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	format := checkFormat(fs, dir)
 	manifestPath := DeploymentManifestYaml
+	var warnings []string
 	if format == ConfigJson {
 		manifestPath = DeploymentManifestJson
+		if _, err := fs.Stat(filepath.Join(dir, DeploymentManifestYaml)); err == nil {
+			warnings = append(warnings, fmt.Sprintf("both %s and %s exist, %s is ignored", DeploymentManifestJson, DeploymentManifestYaml, DeploymentManifestYaml))
+		}
+	}
+	p := filepath.Join(dir, manifestPath)
+	mbytes, err := fs.ReadFile(p)
+	if err != nil {
+		return nil, &ManifestReadError{Path: p, Err: err}
 	}
-	mfile, err := os.Open(filepath.Join(dir, manifestPath))
+	expanded, parseFormat, err := interpolate(p, mbytes, format, options.StrictEnv)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, mfile); err != nil {
-		return nil, format, err
+	var manifest ManifestConfig
+	// older manifests are upgraded in memory, pmok migrate rewrites the file
+	migrations, err := migrate(p, expanded, parseFormat, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	if options.Profile != "" {
+		if err := applyProfile(fs, dir, options.Profile, options.StrictEnv, &manifest); err != nil {
+			return nil, err
+		}
 	}
-	return buf.Bytes(), format, nil
+	manifest.format = format
+	manifest.rootDir = dir
+	return &Config{
+		Name:       ConfigFileName + "." + string(format),
+		Manifest:   manifest,
+		Profile:    options.Profile,
+		Migrations: migrations,
+		Warnings:   warnings,
+		raw:        mbytes,
+	}, nil
 }
 
-func checkFormat(loc string) ConfigFormat {
+func checkFormat(fs FileSystem, loc string) ConfigFormat {
 	// check if the json deployment.json exists. If not we probably have a yaml one
-	if _, err := os.Stat(filepath.Join(loc, DeploymentManifestJson)); errors.Is(err, os.ErrNotExist) {
+	if _, err := fs.Stat(filepath.Join(loc, DeploymentManifestJson)); errors.Is(err, os.ErrNotExist) {
 		return ConfigYaml
 	}
 	return ConfigJson
 }
+
+var yamlLine = regexp.MustCompile(`line (\d+)`)
+
+// parseError adds the position of err within data, when known
+func parseError(path string, data []byte, err error) error {
+	pe := &ManifestParseError{Path: path, Err: err}
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		pe.Line, pe.Column = offsetPosition(data, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		pe.Line, pe.Column = offsetPosition(data, typeErr.Offset)
+	default:
+		// yaml only reports lines, e.g. "yaml: line 3: did not find expected key"
+		if m := yamlLine.FindStringSubmatch(err.Error()); m != nil {
+			pe.Line, _ = strconv.Atoi(m[1])
+		}
+	}
+	return pe
+}
+
+func offsetPosition(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
@@ -0,0 +1,213 @@
+package config_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/testutil"
+)
+
+// memFileSystem serves files from memory, with /project/app as working directory
+func memFileSystem(files map[string]string) MockFileSystem {
+	mfs := fstest.MapFS{}
+	for name, content := range files {
+		mfs[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return MockFileSystem{
+		GetwdFunc: func() (string, error) { return "/project/app", nil },
+		StatFunc: func(name string) (os.FileInfo, error) {
+			return fs.Stat(mfs, strings.TrimPrefix(name, "/"))
+		},
+		ReadFileFunc: func(name string) ([]byte, error) {
+			return fs.ReadFile(mfs, strings.TrimPrefix(name, "/"))
+		},
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	conf, err := config.LoadConfig(config.WithFileSystem(memFileSystem(map[string]string{
+		"project/protomok/pmok.yaml": "version: \"0.01\"\nproject:\n  name: test\n",
+	})))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conf.Manifest.Project.Name != "test" {
+		t.Fatalf("expected project test, but got %s", conf.Manifest.Project.Name)
+	}
+	if conf.GetProjectDir() != "/project" {
+		t.Fatalf("expected project dir /project, but got %s", conf.GetProjectDir())
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		check func(error) bool
+	}{
+		{
+			name:  "no project",
+			files: map[string]string{"project/app/main.go": ""},
+			check: func(err error) bool { return errors.Is(err, config.ErrProjectNotFound) },
+		},
+		{
+			name:  "yaml parse error",
+			files: map[string]string{"project/protomok/pmok.yaml": "version: \"0.01\"\nproject:\n  name: [test\n"},
+			check: func(err error) bool {
+				var pe *config.ManifestParseError
+				return errors.As(err, &pe) && pe.Line > 0
+			},
+		},
+		{
+			name:  "json parse error",
+			files: map[string]string{"project/protomok/pmok.json": "{\n  \"version\": \"0.01\",\n  \"project\": {\"name\": 1}\n}"},
+			check: func(err error) bool {
+				var pe *config.ManifestParseError
+				return errors.As(err, &pe) && pe.Line == 3
+			},
+		},
+		{
+			name:  "unsupported version",
+			files: map[string]string{"project/protomok/pmok.yaml": "version: \"9.99\"\nproject:\n  name: test\n"},
+			check: func(err error) bool {
+				var ve *config.UnsupportedVersionError
+				return errors.As(err, &ve) && ve.Version == "9.99"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.LoadConfig(config.WithFileSystem(memFileSystem(tt.files)))
+			if !tt.check(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCommitDetectsConcurrentChanges(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml": "version: \"0.01\"\nproject:\n  name: test\nfunctions: {}\n",
+	})
+	a, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	a.Manifest.Functions["users"] = config.Function{HttpPathname: "/users", Entrypoint: "index.ts", AllowedMethods: []string{"GET"}}
+	if err := a.Commit(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b.Manifest.Functions["orders"] = config.Function{HttpPathname: "/orders", Entrypoint: "index.ts", AllowedMethods: []string{"GET"}}
+	if err := b.Commit(); !errors.Is(err, config.ErrManifestChanged) {
+		t.Fatalf("expected ErrManifestChanged, but got %v", err)
+	}
+
+	// a keeps committing on top of its own writes
+	a.Manifest.Project.Name = "renamed"
+	if err := a.Commit(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := conf.Manifest.Functions["users"]; !ok || conf.Manifest.Project.Name != "renamed" {
+		t.Fatalf("expected the committed manifest, but got %+v", conf.Manifest)
+	}
+}
+
+func TestCommitKeepsYAMLComments(t *testing.T) {
+	manifest := `# demo project
+version: "0.01"
+project:
+  name: test # shown in logs
+functions:
+  # the users api
+  users:
+    path: /users
+    entrypoint: index.ts
+    methods: [GET]
+`
+	root := testutil.NewProject(t, map[string]string{"pmok.yaml": manifest})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conf.Manifest.Functions["accounts"] = config.Function{HttpPathname: "/accounts", Entrypoint: "index.ts", AllowedMethods: []string{"GET"}}
+	if err := conf.Commit(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := manifest + `  accounts:
+    path: /accounts
+    entrypoint: index.ts
+    methods:
+      - GET
+`
+	b, _ := os.ReadFile(filepath.Join(root, config.DeploymentManifestYaml))
+	if string(b) != want {
+		t.Fatalf("expected\n%s\nbut got\n%s", want, b)
+	}
+}
+
+func TestCommitSortsJSONFunctions(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.json": `{"version": "0.01", "project": {"name": "test"}, "functions": {}}`,
+	})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"zeta", "alpha", "mid"} {
+		conf.Manifest.Functions[name] = config.Function{HttpPathname: "/" + name, Entrypoint: "index.ts", AllowedMethods: []string{"GET"}}
+	}
+	if err := conf.Commit(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(root, config.DeploymentManifestJson))
+	s := string(b)
+	if a, m, z := strings.Index(s, `"alpha"`), strings.Index(s, `"mid"`), strings.Index(s, `"zeta"`); !(a < m && m < z) {
+		t.Fatalf("expected functions sorted by name, but got %s", s)
+	}
+}
+
+func TestCommitKeepsFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows has no unix file modes")
+	}
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml": "version: \"0.01\"\nproject:\n  name: test\nfunctions: {}\n",
+	})
+	p := filepath.Join(root, config.DeploymentManifestYaml)
+	if err := os.Chmod(p, 0600); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conf.Manifest.Project.Name = "renamed"
+	if err := conf.Commit(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, but got %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/protomoks/pmok/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrTargetExists is returned by Convert when a manifest in the target format
+// already exists
+var ErrTargetExists = errors.New("a manifest in the target format already exists")
+
+// ConvertResult describes a manifest conversion
+type ConvertResult struct {
+	From string
+	To   string
+	// LostComments is set when the converted yaml manifest had comments,
+	// json cannot hold them
+	LostComments bool
+}
+
+// Convert rewrites the manifest of cfg in another format and removes the
+// old file. An existing manifest in the target format is only replaced with
+// overwrite. ErrManifestChanged is returned when the manifest changed since
+// cfg was loaded
+func Convert(cfg *Config, to ConfigFormat, overwrite bool) (*ConvertResult, error) {
+	if cfg.Profile != "" {
+		return nil, fmt.Errorf("%w: %s", ErrProfileActive, cfg.Profile)
+	}
+	if to != ConfigYaml && to != ConfigJson {
+		return nil, fmt.Errorf("unknown format %q, expected yaml or json", to)
+	}
+	from := cfg.Manifest.ConfigPath()
+	if cfg.Manifest.format == to {
+		return &ConvertResult{From: from, To: from}, nil
+	}
+
+	m := cfg.Manifest.Copy()
+	m.format = to
+	res := &ConvertResult{From: from, To: m.ConfigPath()}
+	if cfg.Manifest.format == ConfigYaml {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(cfg.raw, &doc); err == nil {
+			res.LostComments = hasComments(&doc)
+		}
+	}
+
+	// the file is converted rather than the loaded manifest, which has its
+	// ${VAR} variables expanded
+	data, err := convertDocument(cfg.raw, to)
+	if err != nil {
+		return nil, err
+	}
+	// a json manifest wins over a yaml one, so each step leaves one manifest
+	// in effect: json to yaml switches when the json manifest is removed,
+	// yaml to json when the json manifest is written. A leftover manifest
+	// only causes a warning on load
+	err = withManifestLock(m.rootDir, func() error {
+		if err := checkUnchanged(from, cfg.raw); err != nil {
+			return err
+		}
+		_, err := os.Stat(res.To)
+		existed := err == nil
+		if existed && !overwrite {
+			return fmt.Errorf("%s: %w", res.To, ErrTargetExists)
+		}
+		// the converted manifest keeps the mode of the old one, which may
+		// hold secrets
+		perm := os.FileMode(0644)
+		if info, err := os.Stat(from); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := utils.WriteFileAtomic(res.To, data, perm); err != nil {
+			return err
+		}
+		if err := os.Remove(from); err != nil {
+			// put the project back the way it was, unless an existing
+			// manifest was overwritten
+			if !existed {
+				os.Remove(res.To)
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg.Manifest = *m
+	cfg.Name = ConfigFileName + "." + string(to)
+	cfg.raw = data
+	return res, nil
+}
+
+// convertDocument converts a yaml or json manifest document to the format to,
+// keeping its values as written and the order of its keys
+func convertDocument(raw []byte, to ConfigFormat) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, errors.New("the manifest is empty")
+	}
+	if to == ConfigYaml {
+		// json documents are read as flow yaml
+		blockStyle(&doc)
+		return yaml.Marshal(&doc)
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, doc.Content[0]); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "\t"); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// blockStyle drops the styles of n, the encoder quotes the strings that need
+// it
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return writeJSON(buf, n.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(n.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, c := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, c); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+func hasComments(n *yaml.Node) bool {
+	if n.HeadComment != "" || n.LineComment != "" || n.FootComment != "" {
+		return true
+	}
+	for _, c := range n.Content {
+		if hasComments(c) {
+			return true
+		}
+	}
+	return false
+}
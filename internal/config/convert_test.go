@@ -0,0 +1,143 @@
+package config_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/testutil"
+)
+
+func TestConvert(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml": "# the demo project\nversion: \"0.01\"\nproject:\n  name: test\nfunctions: {}\n",
+	})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := config.Convert(conf, config.ConfigJson, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.LostComments {
+		t.Fatalf("expected the yaml comments to be reported as lost")
+	}
+	if _, err := os.Stat(filepath.Join(root, config.DeploymentManifestYaml)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the yaml manifest to be removed, but got %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(root, config.DeploymentManifestJson))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var m config.ManifestConfig
+	if err := json.Unmarshal(b, &m); err != nil || m.Project.Name != "test" {
+		t.Fatalf("expected a json manifest for project test, but got %s (%v)", b, err)
+	}
+
+	if conf, err = config.ReadConfig(root); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conf.Manifest.Encoding() != config.ConfigJson {
+		t.Fatalf("expected the project to load as json, but got %s", conf.Manifest.Encoding())
+	}
+}
+
+func TestConvertTargetExists(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.json": `{"version": "0.01", "project": {"name": "json"}, "functions": {}}`,
+		"pmok.yaml": "version: \"0.01\"\nproject:\n  name: yaml\n",
+	})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conf.Warnings) != 1 {
+		t.Fatalf("expected a warning about both manifests, but got %v", conf.Warnings)
+	}
+	if _, err := config.Convert(conf, config.ConfigYaml, false); !errors.Is(err, config.ErrTargetExists) {
+		t.Fatalf("expected ErrTargetExists, but got %v", err)
+	}
+}
+
+func TestConvertDetectsConcurrentChanges(t *testing.T) {
+	const manifest = "version: \"0.01\"\nproject:\n  name: test\nfunctions: {}\n"
+	root := testutil.NewProject(t, map[string]string{"pmok.yaml": manifest})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	changed := manifest + "scenarios:\n  polling: done\n"
+	testutil.WriteFiles(t, root, map[string]string{config.DeploymentManifestYaml: changed})
+
+	if _, err := config.Convert(conf, config.ConfigJson, false); !errors.Is(err, config.ErrManifestChanged) {
+		t.Fatalf("expected ErrManifestChanged, but got %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, config.DeploymentManifestYaml)); string(b) != changed {
+		t.Fatalf("expected the changed manifest to be kept, but got %s", b)
+	}
+	if _, err := os.Stat(filepath.Join(root, config.DeploymentManifestJson)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no json manifest, but got %v", err)
+	}
+	// the manifest lock lives outside of the project
+	entries, _ := os.ReadDir(filepath.Join(root, config.ProtomokDir))
+	for _, e := range entries {
+		if e.Name() != "pmok.yaml" {
+			t.Fatalf("expected only the manifest in the project, but got %s", e.Name())
+		}
+	}
+}
+
+func TestConvertKeepsVariables(t *testing.T) {
+	t.Setenv("PMOK_TEST_PORT", "9100")
+	t.Setenv("PMOK_TEST_SECRET", "hunter2")
+	const manifest = "version: \"0.01\"\nproject:\n  name: test\nserver:\n  port: ${PMOK_TEST_PORT}\n  env:\n    TOKEN: ${PMOK_TEST_SECRET}\n    REGION: ${PMOK_TEST_REGION:-eu}\n"
+	root := testutil.NewProject(t, map[string]string{"pmok.yaml": manifest})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := config.Convert(conf, config.ConfigJson, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(root, config.DeploymentManifestJson))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`"port": "${PMOK_TEST_PORT}"`, `"TOKEN": "${PMOK_TEST_SECRET}"`, `"REGION": "${PMOK_TEST_REGION:-eu}"`} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %s in the json manifest, but got\n%s", want, b)
+		}
+	}
+	if strings.Contains(string(b), "hunter2") {
+		t.Fatalf("expected no expanded secret in the json manifest, but got\n%s", b)
+	}
+
+	// and back, the variables still expand
+	if conf, err = config.ReadConfig(root); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conf.Manifest.Server.Port != 9100 {
+		t.Fatalf("expected port 9100, but got %d", conf.Manifest.Server.Port)
+	}
+	if _, err := config.Convert(conf, config.ConfigYaml, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err = os.ReadFile(filepath.Join(root, config.DeploymentManifestYaml)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(b), "hunter2") || !strings.Contains(string(b), "${PMOK_TEST_REGION:-eu}") {
+		t.Fatalf("expected the variables in the yaml manifest, but got\n%s", b)
+	}
+	if conf, err = config.ReadConfig(root); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, b)
+	}
+	if conf.Manifest.Server.Env["REGION"] != "eu" || conf.Manifest.Server.Port != 9100 || conf.Manifest.Project.Name != "test" {
+		t.Fatalf("expected the converted manifest to load the same values, but got %+v\n%s", conf.Manifest.Server, b)
+	}
+}
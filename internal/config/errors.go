@@ -0,0 +1,65 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrProjectNotFound is returned when no protomok directory exists in the
+	// working directory or any of its parents
+	ErrProjectNotFound = errors.New("unable to find protomok project directory")
+)
+
+// ManifestReadError is returned when the manifest exists but cannot be read
+type ManifestReadError struct {
+	Path string
+	Err  error
+}
+
+func (e *ManifestReadError) Error() string {
+	return fmt.Sprintf("unable to read manifest %s: %v", e.Path, e.Err)
+}
+
+func (e *ManifestReadError) Unwrap() error {
+	return e.Err
+}
+
+// ManifestParseError is returned when the manifest is not valid yaml or json.
+// Line and Column are 1-based and 0 when the position is unknown
+type ManifestParseError struct {
+	Path   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ManifestParseError) Error() string {
+	loc := e.Path
+	if e.Line > 0 {
+		loc += fmt.Sprintf(":%d", e.Line)
+		if e.Column > 0 {
+			loc += fmt.Sprintf(":%d", e.Column)
+		}
+	}
+	return fmt.Sprintf("%s: %s", loc, strings.TrimPrefix(e.Err.Error(), "yaml: "))
+}
+
+func (e *ManifestParseError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedVersionError is returned for manifests written by a version of
+// pmok this build does not know about
+type UnsupportedVersionError struct {
+	Path    string
+	Version string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("%s: manifest has no version", e.Path)
+	}
+	return fmt.Sprintf("%s: unsupported manifest version %q, upgrade pmok to load it", e.Path, e.Version)
+}
@@ -8,6 +8,7 @@ type FileSystem interface {
 	Mkdir(name string, perm os.FileMode) error
 	WriteFile(name string, data []byte, perm os.FileMode) error
 	Open(name string) (*os.File, error)
+	ReadFile(name string) ([]byte, error)
 }
 
 type realFileSystem struct{}
@@ -27,18 +28,26 @@ func (realFileSystem) WriteFile(name string, data []byte, perm os.FileMode) erro
 func (realFileSystem) Open(name string) (*os.File, error) {
 	return os.Open(name)
 }
+func (realFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
 
 type Options struct {
 	FileSystem FileSystem
+	// Profile selects the pmok.<profile>.yaml overlay applied by LoadConfig
+	Profile string
+	// StrictEnv fails loading on ${VAR} references to unset variables
+	StrictEnv bool
 }
 
 func DefaultOptions() Options {
 	return Options{
 		FileSystem: realFileSystem{},
+		StrictEnv:  os.Getenv(StrictEnvEnv) == "true" || os.Getenv(StrictEnvEnv) == "1",
 	}
 }
 
-// Option is a functional option for configuring InitializeProject
+// Option is a functional option for configuring InitializeProject and LoadConfig
 type Option func(*Options)
 
 // WithFileSystem allows overriding the FileSystem dependency. Only used for testing
@@ -47,3 +56,18 @@ func WithFileSystem(fs FileSystem) Option {
 		o.FileSystem = fs
 	}
 }
+
+// WithProfile selects the manifest overlay to apply. Configs loaded with a
+// profile are read-only
+func WithProfile(profile string) Option {
+	return func(o *Options) {
+		o.Profile = profile
+	}
+}
+
+// WithStrictEnv fails loading on references to unset environment variables
+func WithStrictEnv(strict bool) Option {
+	return func(o *Options) {
+		o.StrictEnv = strict
+	}
+}
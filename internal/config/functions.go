@@ -2,12 +2,20 @@ package config
 
 import (
 	"encoding/json"
+
+	"github.com/protomoks/pmok/internal/mockspec"
 )
 
 type Function struct {
 	HttpPathname   string   `json:"path" yaml:"path"`
 	Entrypoint     string   `json:"entrypoint" yaml:"entrypoint"`
 	AllowedMethods []string `json:"methods" yaml:"methods"`
+	// Priority decides between overlapping routes, higher wins. Defaults to 0
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// Faults overrides the global faults of the manifest for this function
+	Faults *mockspec.Faults `json:"faults,omitempty" yaml:"faults,omitempty"`
+	// Disabled functions are not served, e.g. turned off by a profile
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
 }
 
 type FunctionConfig map[string]Function
@@ -15,3 +23,14 @@ type FunctionConfig map[string]Function
 func (f FunctionConfig) ToJSON() ([]byte, error) {
 	return json.Marshal(&f)
 }
+
+// Enabled returns the functions that are not disabled
+func (f FunctionConfig) Enabled() FunctionConfig {
+	out := make(FunctionConfig, len(f))
+	for name, fn := range f {
+		if !fn.Disabled {
+			out[name] = fn
+		}
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StrictEnvEnv turns on strict interpolation when no --strict-env flag is given
+const StrictEnvEnv = "PMOK_STRICT_ENV"
+
+// UndefinedVariableError is returned in strict mode for a ${VAR} without
+// default whose variable is not set
+type UndefinedVariableError struct {
+	Path     string
+	Line     int
+	Variable string
+}
+
+func (e *UndefinedVariableError) Error() string {
+	return fmt.Sprintf("%s:%d: environment variable %s is not set", e.Path, e.Line, e.Variable)
+}
+
+// variables matches $${VAR} escapes, ${VAR} and ${VAR:-default}
+var variables = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandString replaces the variables of s. It returns the first undefined
+// variable without default
+func expandString(s string) (string, string) {
+	var undefined string
+	out := variables.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		m := variables.FindStringSubmatch(match)
+		value, ok := os.LookupEnv(m[1])
+		if ok && value != "" {
+			return value
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		if !ok && undefined == "" {
+			undefined = m[1]
+		}
+		return value
+	})
+	return out, undefined
+}
+
+func hasVariables(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+// interpolate expands the variables in the values of a manifest. Keys are
+// left alone. Files without variables are returned as they are. Others are
+// returned re-encoded as yaml, which reads typed values such as ports from
+// either format, so parse errors may report shifted lines
+func interpolate(path string, data []byte, format ConfigFormat, strict bool) ([]byte, ConfigFormat, error) {
+	if !hasVariables(string(data)) {
+		return data, format, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, format, parseError(path, data, err)
+	}
+	if err := expandNode(path, &doc, strict); err != nil {
+		return nil, format, err
+	}
+	b, err := yaml.Marshal(&doc)
+	return b, ConfigYaml, err
+}
+
+// ExpandVariables expands the variables in the values of a parsed manifest
+// in place, keeping node positions
+func ExpandVariables(path string, n *yaml.Node, strict bool) error {
+	return expandNode(path, n, strict)
+}
+
+func expandNode(path string, n *yaml.Node, strict bool) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if !hasVariables(n.Value) {
+			return nil
+		}
+		whole := variables.FindString(n.Value) == n.Value && !strings.HasPrefix(n.Value, "$$")
+		value, undefined := expandString(n.Value)
+		if strict && undefined != "" {
+			return &UndefinedVariableError{Path: path, Line: n.Line, Variable: undefined}
+		}
+		n.Value = value
+		if whole {
+			// a value that is a single variable takes the type of its
+			// expansion, port: ${PORT} is a number
+			n.Style, n.Tag = 0, ""
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := expandNode(path, n.Content[i], strict); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, c := range n.Content {
+			if err := expandNode(path, c, strict); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// keepVariables returns updated with the values that still equal the
+// expansion of their original replaced by the original, so commits do not
+// write expanded values back
+func keepVariables(original, updated any) any {
+	switch u := updated.(type) {
+	case map[string]any:
+		o, _ := original.(map[string]any)
+		for k, v := range u {
+			u[k] = keepVariables(o[k], v)
+		}
+		return u
+	case []any:
+		o, _ := original.([]any)
+		if len(o) != len(u) {
+			return u
+		}
+		for i := range u {
+			u[i] = keepVariables(o[i], u[i])
+		}
+		return u
+	}
+	if s, ok := original.(string); ok && hasVariables(s) {
+		if expanded, _ := expandString(s); expanded == fmt.Sprint(updated) {
+			return s
+		}
+	}
+	return updated
+}
@@ -0,0 +1,77 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/testutil"
+)
+
+const interpolatedManifest = `version: "0.01"
+project:
+  name: ${PROJECT:-demo}
+functions: {}
+server:
+  port: ${PMOK_TEST_PORT}
+  image: deno:$${TAG}
+`
+
+func TestInterpolation(t *testing.T) {
+	t.Setenv("PMOK_TEST_PORT", "9000")
+	root := testutil.NewProject(t, map[string]string{"pmok.yaml": interpolatedManifest})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := conf.Manifest
+	if m.Project.Name != "demo" || m.Server.Port != 9000 || m.Server.Image != "deno:${TAG}" {
+		t.Fatalf("expected expanded values, but got %+v %+v", m.Project, m.Server)
+	}
+
+	m.Functions["users"] = config.Function{HttpPathname: "/users", Entrypoint: "index.ts", AllowedMethods: []string{"GET"}}
+	conf.Manifest = m
+	if err := conf.Commit(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(root, config.DeploymentManifestYaml))
+	for _, want := range []string{"${PROJECT:-demo}", "${PMOK_TEST_PORT}", "$${TAG}"} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %s to be kept, but got\n%s", want, b)
+		}
+	}
+}
+
+func TestInterpolationJSON(t *testing.T) {
+	t.Setenv("PMOK_TEST_PORT", "9000")
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.json": `{"version": "0.01", "project": {"name": "test"}, "functions": {}, "server": {"port": "${PMOK_TEST_PORT}"}}`,
+	})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conf.Manifest.Server.Port != 9000 {
+		t.Fatalf("expected port 9000, but got %d", conf.Manifest.Server.Port)
+	}
+	conf.Manifest.Project.Name = "renamed"
+	if err := conf.Commit(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(root, config.DeploymentManifestJson))
+	if !strings.Contains(string(b), "${PMOK_TEST_PORT}") || !strings.Contains(string(b), "renamed") {
+		t.Fatalf("expected the variable to be kept, but got\n%s", b)
+	}
+}
+
+func TestInterpolationStrict(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{"pmok.yaml": interpolatedManifest})
+	_, err := config.ReadConfig(root, config.WithStrictEnv(true))
+	var ue *config.UndefinedVariableError
+	if !errors.As(err, &ue) || ue.Variable != "PMOK_TEST_PORT" {
+		t.Fatalf("expected PMOK_TEST_PORT to be reported as undefined, but got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrManifestChanged is returned by Commit when the manifest file was
+// changed by someone else since the config was loaded
+var ErrManifestChanged = errors.New("manifest changed on disk since it was loaded, run the command again")
+
+// lockPath returns the advisory lock taken around the manifest writes of the
+// project rooted at root. The manifest itself is replaced on every write and
+// cannot hold the lock, and a lock inside the project would end up in its
+// version control, so it is kept in the user cache directory
+func lockPath(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, "pmok", "locks", hex.EncodeToString(sum[:8])+".lock"), nil
+}
+
+// withManifestLock runs fn while holding the manifest lock of the project
+// rooted at root. The lock blocks other pmok processes only.
+//
+// Change detection is optimistic: the lock is not held between loading a
+// config and committing it. Writers compare the manifest on disk with the
+// one they loaded under the lock and fail with ErrManifestChanged when it
+// differs, so a concurrent change is never overwritten
+func withManifestLock(root string, fn func() error) error {
+	p, err := lockPath(root)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+// checkUnchanged fails with ErrManifestChanged when the manifest at p is not
+// raw anymore, the manifest as it was loaded. Callers hold the manifest lock
+func checkUnchanged(p string, raw []byte) error {
+	if raw == nil {
+		return nil
+	}
+	current, err := os.ReadFile(p)
+	if err != nil {
+		return &ManifestReadError{Path: p, Err: err}
+	}
+	if !bytes.Equal(current, raw) {
+		return fmt.Errorf("%s: %w", p, ErrManifestChanged)
+	}
+	return nil
+}
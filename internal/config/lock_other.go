@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package config
+
+import "os"
+
+// file locks are not available, writes are still atomic
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
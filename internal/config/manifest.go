@@ -5,9 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
+	"sort"
 
+	"github.com/protomoks/pmok/internal/mockspec"
 	"github.com/protomoks/pmok/internal/utils/constants"
 	"gopkg.in/yaml.v3"
 )
@@ -36,6 +37,63 @@ type ManifestConfig struct {
 	Version   string         `json:"version" yaml:"version"`
 	Project   Project        `json:"project" yaml:"project"`
 	Functions FunctionConfig `json:"functions" yaml:"functions"`
+	// Scenarios selects the active state of each mock scenario by name
+	Scenarios map[string]string `json:"scenarios,omitempty" yaml:"scenarios,omitempty"`
+	// Faults applies to every route without faults of its own
+	Faults  *mockspec.Faults `json:"faults,omitempty" yaml:"faults,omitempty"`
+	Server  *ServerConfig    `json:"server,omitempty" yaml:"server,omitempty"`
+	Grpc    *GrpcConfig      `json:"grpc,omitempty" yaml:"grpc,omitempty"`
+	Graphql *GraphqlConfig   `json:"graphql,omitempty" yaml:"graphql,omitempty"`
+}
+
+// GraphqlConfig declares the GraphQL endpoint of the mocked API. Operations
+// sent to it without a mock are answered with data generated from the schema
+type GraphqlConfig struct {
+	// Path is the GraphQL endpoint, /graphql by default
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Schema is an SDL file, relative to the protomok directory. Without a
+	// schema only the mocks of the endpoint answer
+	Schema string `json:"schema,omitempty" yaml:"schema,omitempty"`
+}
+
+// GraphqlPath returns the GraphQL endpoint, applying the default
+func (g *GraphqlConfig) GraphqlPath() string {
+	if g == nil || g.Path == "" {
+		return constants.GraphqlDefaultPath
+	}
+	return g.Path
+}
+
+// GrpcConfig registers the gRPC services pmok serve mocks next to the
+// mock server container
+type GrpcConfig struct {
+	// Port is the host port of the gRPC mock server, 50051 by default
+	Port int `json:"port,omitempty" yaml:"port,omitempty"`
+	// ImportPaths are searched for the imports of the protos, relative to
+	// the protomok directory. The directory of each proto is searched first
+	ImportPaths []string `json:"importPaths,omitempty" yaml:"importPaths,omitempty"`
+	// Services maps full service names, e.g. helloworld.Greeter, to the
+	// proto that defines them
+	Services map[string]GrpcService `json:"services" yaml:"services"`
+}
+
+type GrpcService struct {
+	// Proto is the .proto file, relative to the protomok directory
+	Proto string `json:"proto" yaml:"proto"`
+}
+
+// ServerConfig configures the mock server container of pmok serve
+type ServerConfig struct {
+	// Port is the host port of the mock server, 8000 by default
+	Port int `json:"port,omitempty" yaml:"port,omitempty"`
+	// Image overrides the Deno image the runtime runs in
+	Image string `json:"image,omitempty" yaml:"image,omitempty"`
+	// Env is added to the environment of the runtime
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	// StreamSpeed scales the timing of replayed event streams and WebSocket
+	// conversations, 2 replays twice as fast and 0 without delays. 1 when
+	// unset
+	StreamSpeed *float64 `json:"streamSpeed,omitempty" yaml:"streamSpeed,omitempty"`
 }
 
 // initialize a default Manifest
@@ -63,10 +121,39 @@ func (c *ManifestConfig) Copy() *ManifestConfig {
 	m.Version = c.Version
 	m.Project = c.Project
 	m.Functions = c.Functions
+	m.Scenarios = c.Scenarios
+	m.Faults = c.Faults
+	m.Server = c.Server
+	m.Grpc = c.Grpc
+	m.Graphql = c.Graphql
 
 	return &m
 }
 
+// ValidateFaults checks the global and the per function faults
+func (c *ManifestConfig) ValidateFaults() error {
+	if c.Faults != nil {
+		if err := c.Faults.Validate(); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(c.Functions))
+	for name := range c.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fn := c.Functions[name]
+		if fn.Faults == nil {
+			continue
+		}
+		if err := fn.Faults.Validate(); err != nil {
+			return fmt.Errorf("function %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
 func (c ManifestConfig) String() string {
 	b, err := json.Marshal(&c)
 	if err != nil {
@@ -118,19 +205,25 @@ func HasProject(opts ...Option) (string, error) {
 	return p, nil
 }
 
+// ResolveProjectDir returns the project root currentDir belongs to, the
+// first of currentDir and its parents that contains a protomok directory
 func ResolveProjectDir(currentDir string) (string, error) {
+	return resolveProjectDir(realFileSystem{}, currentDir)
+}
+
+func resolveProjectDir(fs FileSystem, currentDir string) (string, error) {
 	start := currentDir
 
 	for {
 		target := filepath.Join(start, ProtomokDir)
-		if info, err := os.Stat(target); err == nil && info.IsDir() {
+		if info, err := fs.Stat(target); err == nil && info.IsDir() {
 			return filepath.Dir(target), nil
 		}
 		// move up
-		parent := path.Dir(start)
+		parent := filepath.Dir(start)
 		// check if we reached "/"
 		if parent == start {
-			return "", fmt.Errorf("unable to find protomok project directory")
+			return "", ErrProjectNotFound
 		}
 		start = parent
 	}
@@ -204,6 +297,11 @@ func createProtomokFiles(c *ManifestConfig, fs FileSystem) (string, error) {
 	return c.rootDir, nil
 }
 
+// Marshal encodes the manifest in its format
+func (c *ManifestConfig) Marshal() ([]byte, error) {
+	return marshal(c)
+}
+
 func marshal(c *ManifestConfig) ([]byte, error) {
 	if c.format == ConfigJson {
 		return json.MarshalIndent(c, "", "\t")
@@ -17,6 +17,7 @@ type MockFileSystem struct {
 	MkdirFunc     func(name string, perm os.FileMode) error
 	WriteFileFunc func(name string, data []byte, perm os.FileMode) error
 	OpenFunc      func(name string) (*os.File, error)
+	ReadFileFunc  func(name string) ([]byte, error)
 }
 
 func (m MockFileSystem) Stat(name string) (os.FileInfo, error) {
@@ -37,6 +38,9 @@ func (m MockFileSystem) WriteFile(name string, data []byte, perm os.FileMode) er
 func (m MockFileSystem) Open(name string) (*os.File, error) {
 	return m.OpenFunc(name)
 }
+func (m MockFileSystem) ReadFile(name string) ([]byte, error) {
+	return m.ReadFileFunc(name)
+}
 
 func TestInitializeProject(t *testing.T) {
 
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/protomoks/pmok/internal/utils"
+	"github.com/protomoks/pmok/internal/utils/constants"
+	"gopkg.in/yaml.v3"
+)
+
+// Migration upgrades a raw manifest document from one version to the next
+type Migration struct {
+	From        string
+	To          string
+	Description string
+	Migrate     func(doc map[string]any) error
+}
+
+// Migrations are applied in order, each one starting at the version the
+// previous one produced. The last one must end at
+// constants.DefaultManifestVersion, the version new manifests are written
+// with. A change of the manifest format bumps the version and adds the
+// migration from the previous one here
+var Migrations = []Migration{}
+
+// migrationsFrom returns the migrations that bring version up to date, or
+// false if the version is unknown
+func migrationsFrom(version string) ([]Migration, bool) {
+	if version == constants.DefaultManifestVersion {
+		return nil, true
+	}
+	for i, m := range Migrations {
+		if m.From == version {
+			return Migrations[i:], true
+		}
+	}
+	return nil, false
+}
+
+// migrate decodes data, brings it to the current version and decodes the
+// result into m. It returns the migrations that were applied
+func migrate(path string, data []byte, format ConfigFormat, m *ManifestConfig) ([]Migration, error) {
+	var doc map[string]any
+	var err error
+	if format == ConfigJson {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, parseError(path, data, err)
+	}
+	version, _ := doc["version"].(string)
+	migrations, ok := migrationsFrom(version)
+	if !ok {
+		return nil, &UnsupportedVersionError{Path: path, Version: version}
+	}
+	if len(migrations) == 0 {
+		if err := unmarshal(data, m, format); err != nil {
+			return nil, parseError(path, data, err)
+		}
+		return nil, nil
+	}
+	for _, mig := range migrations {
+		if err := mig.Migrate(doc); err != nil {
+			return nil, fmt.Errorf("%s: migrating from %s to %s: %w", path, mig.From, mig.To, err)
+		}
+		doc["version"] = mig.To
+	}
+	// the migrated document has no positions left to report
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, &ManifestParseError{Path: path, Err: err}
+	}
+	return migrations, nil
+}
+
+// MigrationResult describes the upgrade of a manifest file
+type MigrationResult struct {
+	Path       string
+	Applied    []Migration
+	Before     []byte
+	After      []byte
+	BackupPath string
+}
+
+// Migrate upgrades the manifest of cfg on disk to the current version. The
+// previous file is kept next to it with the old version as suffix, e.g.
+// pmok.yaml.0.01.bak. With dryRun nothing is written
+func Migrate(cfg *Config, dryRun bool) (*MigrationResult, error) {
+	path := cfg.Manifest.ConfigPath()
+	before, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ManifestReadError{Path: path, Err: err}
+	}
+	// variables are expanded to decode typed values and kept when writing
+	expanded, parseFormat, err := interpolate(path, before, cfg.Manifest.format, false)
+	if err != nil {
+		return nil, err
+	}
+	var m ManifestConfig
+	applied, err := migrate(path, expanded, parseFormat, &m)
+	if err != nil {
+		return nil, err
+	}
+	res := &MigrationResult{Path: path, Applied: applied, Before: before, After: before}
+	if len(applied) == 0 {
+		return res, nil
+	}
+	m.format = cfg.Manifest.format
+	m.rootDir = cfg.Manifest.rootDir
+	if res.After, err = encodeManifest(before, &m); err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return res, nil
+	}
+
+	res.BackupPath = fmt.Sprintf("%s.%s.bak", path, applied[0].From)
+	err = withManifestLock(cfg.Manifest.rootDir, func() error {
+		current, err := os.ReadFile(path)
+		if err != nil {
+			return &ManifestReadError{Path: path, Err: err}
+		}
+		if !bytes.Equal(current, before) {
+			return fmt.Errorf("%s: %w", path, ErrManifestChanged)
+		}
+		if err := os.WriteFile(res.BackupPath, before, 0644); err != nil {
+			return err
+		}
+		return utils.WriteFileAtomic(path, res.After, 0644)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg.Manifest = m
+	cfg.Migrations = nil
+	cfg.raw = res.After
+	return res, nil
+}
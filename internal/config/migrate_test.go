@@ -0,0 +1,113 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/testutil"
+	"github.com/protomoks/pmok/internal/utils/constants"
+)
+
+const manifestV000 = `version: "0.00"
+project:
+  name: test
+functions:
+  users:
+    path: /users
+    entrypoint: index.ts
+    methods: [get, post]
+`
+
+// withTestMigration replaces the migrations with one from version 0.00 that
+// upper cases function methods
+func withTestMigration(t *testing.T) {
+	t.Helper()
+	migrations := config.Migrations
+	t.Cleanup(func() {
+		config.Migrations = migrations
+	})
+	config.Migrations = []config.Migration{{
+		From:        "0.00",
+		To:          constants.DefaultManifestVersion,
+		Description: "upper case function methods",
+		Migrate: func(doc map[string]any) error {
+			functions, _ := doc["functions"].(map[string]any)
+			for _, v := range functions {
+				fn, _ := v.(map[string]any)
+				methods, _ := fn["methods"].([]any)
+				for i, m := range methods {
+					methods[i] = strings.ToUpper(m.(string))
+				}
+			}
+			return nil
+		},
+	}}
+}
+
+func TestMigrationsEndAtCurrentVersion(t *testing.T) {
+	for i := 1; i < len(config.Migrations); i++ {
+		if config.Migrations[i].From != config.Migrations[i-1].To {
+			t.Fatalf("expected migration %d to start at %s, but got %s", i, config.Migrations[i-1].To, config.Migrations[i].From)
+		}
+	}
+	if n := len(config.Migrations); n > 0 && config.Migrations[n-1].To != constants.DefaultManifestVersion {
+		t.Fatalf("expected the last migration to end at %s, but got %s", constants.DefaultManifestVersion, config.Migrations[n-1].To)
+	}
+}
+
+func TestLoadConfigMigratesInMemory(t *testing.T) {
+	withTestMigration(t)
+	conf, err := config.LoadConfig(config.WithFileSystem(memFileSystem(map[string]string{
+		"project/protomok/pmok.yaml": manifestV000,
+	})))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conf.Manifest.Version != constants.DefaultManifestVersion {
+		t.Fatalf("expected version %s, but got %s", constants.DefaultManifestVersion, conf.Manifest.Version)
+	}
+	fn := conf.Manifest.Functions["users"]
+	if strings.Join(fn.AllowedMethods, ",") != "GET,POST" {
+		t.Fatalf("expected a migrated function, but got %+v", fn)
+	}
+	if len(conf.Migrations) != 1 {
+		t.Fatalf("expected 1 applied migration, but got %d", len(conf.Migrations))
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	withTestMigration(t)
+	root := testutil.NewProject(t, map[string]string{"pmok.yaml": manifestV000})
+	manifest := filepath.Join(root, config.DeploymentManifestYaml)
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := config.Migrate(conf, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, _ := os.ReadFile(manifest); string(b) != manifestV000 {
+		t.Fatalf("expected a dry run to leave the manifest untouched, but got %s", b)
+	}
+	if !strings.Contains(string(res.After), "version: \""+constants.DefaultManifestVersion+"\"") {
+		t.Fatalf("expected the migrated manifest to have the current version, but got %s", res.After)
+	}
+
+	if res, err = config.Migrate(conf, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, _ := os.ReadFile(res.BackupPath); string(b) != manifestV000 {
+		t.Fatalf("expected a backup of the old manifest, but got %s", b)
+	}
+	if b, _ := os.ReadFile(manifest); string(b) != string(res.After) {
+		t.Fatalf("expected the migrated manifest to be written, but got %s", b)
+	}
+	if res, _ = config.Migrate(conf, false); len(res.Applied) != 0 {
+		t.Fatalf("expected no migrations on an up to date manifest, but got %d", len(res.Applied))
+	}
+}
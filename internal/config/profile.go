@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileEnv selects a profile for the commands that only read the manifest,
+// when no --profile flag is given
+const ProfileEnv = "PMOK_PROFILE"
+
+// ErrProfileActive is returned when writing a manifest that has a profile
+// merged in, the result would leak the profile into the base manifest
+var ErrProfileActive = errors.New("the manifest is read-only while a profile is active")
+
+// ProfilePath returns the overlay file of a profile, pmok.<profile>.yaml or
+// pmok.<profile>.json in the protomok directory of root
+func ProfilePath(fs FileSystem, root, profile string) (string, error) {
+	for _, ext := range []ConfigFormat{ConfigYaml, ConfigJson} {
+		p := filepath.Join(root, ProtomokDir, ConfigFileName+"."+profile+"."+string(ext))
+		if _, err := fs.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	p := filepath.Join(root, ProtomokDir, ConfigFileName+"."+profile+".yaml")
+	return "", &ManifestReadError{Path: p, Err: fmt.Errorf("profile %s: %w", profile, os.ErrNotExist)}
+}
+
+// applyProfile merges the overlay of profile into m. Mappings are merged key
+// by key, any other value of the overlay replaces the base value
+func applyProfile(fs FileSystem, root, profile string, strict bool, m *ManifestConfig) error {
+	p, err := ProfilePath(fs, root, profile)
+	if err != nil {
+		return err
+	}
+	data, err := fs.ReadFile(p)
+	if err != nil {
+		return &ManifestReadError{Path: p, Err: err}
+	}
+	if data, _, err = interpolate(p, data, ConfigYaml, strict); err != nil {
+		return err
+	}
+	// json is valid yaml, one parser reads both overlay formats
+	var overlay map[string]any
+	if err := yaml.Unmarshal(data, &overlay); err != nil {
+		return parseError(p, data, err)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var base map[string]any
+	if err := json.Unmarshal(b, &base); err != nil {
+		return err
+	}
+	merged := mergeValues(base, overlay)
+	if b, err = json.Marshal(merged); err != nil {
+		return err
+	}
+	var out ManifestConfig
+	if err := json.Unmarshal(b, &out); err != nil {
+		return &ManifestParseError{Path: p, Err: err}
+	}
+	*m = out
+	return nil
+}
+
+func mergeValues(base, overlay any) any {
+	bm, ok := base.(map[string]any)
+	if !ok {
+		return overlay
+	}
+	om, ok := overlay.(map[string]any)
+	if !ok {
+		return overlay
+	}
+	for k, v := range om {
+		bm[k] = mergeValues(bm[k], v)
+	}
+	return bm
+}
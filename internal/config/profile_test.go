@@ -0,0 +1,84 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/testutil"
+)
+
+const baseManifest = `version: "0.01"
+project:
+  name: test
+functions:
+  users:
+    path: /users
+    entrypoint: index.ts
+    methods: [GET]
+  orders:
+    path: /orders
+    entrypoint: index.ts
+    methods: [GET]
+server:
+  port: 8000
+  env:
+    LOG: debug
+`
+
+func TestProfile(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml": baseManifest,
+		"pmok.ci.yaml": `functions:
+  orders:
+    disabled: true
+server:
+  port: 9000
+faults:
+  latency:
+    fixedMs: 100
+`,
+	})
+	conf, err := config.ReadConfig(root, config.WithProfile("ci"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := conf.Manifest
+	if m.Server.Port != 9000 || m.Server.Env["LOG"] != "debug" {
+		t.Fatalf("expected the overlay server merged into the base, but got %+v", m.Server)
+	}
+	if m.Faults == nil || m.Faults.Latency.FixedMs != 100 {
+		t.Fatalf("expected the overlay faults, but got %+v", m.Faults)
+	}
+	if !m.Functions["orders"].Disabled || m.Functions["orders"].HttpPathname != "/orders" {
+		t.Fatalf("expected orders to be disabled and keep its path, but got %+v", m.Functions["orders"])
+	}
+	if _, ok := m.Functions.Enabled()["orders"]; ok {
+		t.Fatalf("expected orders not to be enabled")
+	}
+	if err := conf.Commit(); !errors.Is(err, config.ErrProfileActive) {
+		t.Fatalf("expected ErrProfileActive, but got %v", err)
+	}
+}
+
+func TestProfileEnvIgnored(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{"pmok.yaml": baseManifest})
+	// commands that read the manifest select the profile of PMOK_PROFILE,
+	// loading stays on the base manifest so it can be committed
+	t.Setenv(config.ProfileEnv, "demo")
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conf.Profile != "" {
+		t.Fatalf("expected no profile, but got %s", conf.Profile)
+	}
+	if err := conf.Commit(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = config.ReadConfig(root, config.WithProfile("demo"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the missing demo profile to be reported, but got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mergeYAML encodes m into the yaml document original. Keys keep their order
+// and comments, new keys are appended and removed keys are dropped
+func mergeYAML(original []byte, m *ManifestConfig) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(original, &doc); err != nil || len(doc.Content) == 0 {
+		// nothing worth preserving
+		return marshal(m)
+	}
+	var updated yaml.Node
+	if err := updated.Encode(m); err != nil {
+		return nil, err
+	}
+	mergeNode(doc.Content[0], &updated)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(detectIndent(original))
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeNode updates dst to the value of src, keeping the comments and the
+// formatting of dst where the value did not change
+func mergeNode(dst, src *yaml.Node) {
+	if dst.Kind != src.Kind {
+		replaceNode(dst, src)
+		return
+	}
+	switch dst.Kind {
+	case yaml.MappingNode:
+		mergeMapping(dst, src)
+	case yaml.SequenceNode:
+		if len(dst.Content) != len(src.Content) {
+			if len(dst.Content) == 0 || len(src.Content) == 0 {
+				dst.Style = src.Style
+			}
+			dst.Content = src.Content
+			return
+		}
+		for i := range dst.Content {
+			mergeNode(dst.Content[i], src.Content[i])
+		}
+	case yaml.ScalarNode:
+		if dst.Value == src.Value && dst.Tag == src.Tag {
+			return
+		}
+		if hasVariables(dst.Value) {
+			if expanded, _ := expandString(dst.Value); expanded == src.Value {
+				return
+			}
+		}
+		if dst.Tag != src.Tag {
+			// the old style may change the type of the new value
+			dst.Style = src.Style
+		}
+		dst.Value, dst.Tag = src.Value, src.Tag
+	default:
+		replaceNode(dst, src)
+	}
+}
+
+func mergeMapping(dst, src *yaml.Node) {
+	values := make(map[string]*yaml.Node, len(src.Content)/2)
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		values[src.Content[i].Value] = src.Content[i+1]
+	}
+
+	if len(dst.Content) == 0 || len(src.Content) == 0 {
+		// {} is written inline, a filled mapping as a block
+		dst.Style = src.Style
+	}
+	content := make([]*yaml.Node, 0, len(src.Content))
+	seen := make(map[string]bool, len(values))
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		key := dst.Content[i].Value
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		seen[key] = true
+		mergeNode(dst.Content[i+1], value)
+		content = append(content, dst.Content[i], dst.Content[i+1])
+	}
+	// src keys are sorted, new keys are appended in a stable order
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		if !seen[src.Content[i].Value] {
+			content = append(content, src.Content[i], src.Content[i+1])
+		}
+	}
+	dst.Content = content
+}
+
+// replaceNode swaps the value of dst for src but keeps the comments of dst
+func replaceNode(dst, src *yaml.Node) {
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+	*dst = *src
+	dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+}
+
+// detectIndent returns the indentation of the first nested line of a yaml
+// document, or 4 as used by yaml.Marshal
+func detectIndent(b []byte) int {
+	for _, line := range strings.Split(string(b), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if n := len(line) - len(trimmed); n >= 2 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return n
+		}
+	}
+	return 4
+}
@@ -10,7 +10,6 @@ import (
 	"path/filepath"
 
 	"github.com/protomoks/pmok/internal/config"
-	"github.com/protomoks/pmok/internal/utils"
 )
 
 type AddFunctionCommand struct {
@@ -39,9 +38,9 @@ func AddFunction(c AddFunctionCommand) error {
 		return err
 	}
 	// get the config
-	conf := config.GetConfig()
-	if conf == nil {
-		return utils.ConfigNotFound()
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return err
 	}
 	// don't allow potentially overwriting existing functions
 	if _, ok := conf.Manifest.Functions[c.Name]; ok {
@@ -0,0 +1,39 @@
+package add_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/functions/add"
+	"github.com/protomoks/pmok/internal/testutil"
+)
+
+func TestAddFunctionWithProfileEnv(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml":       "version: \"0.01\"\nproject:\n  name: test\nfunctions: {}\n",
+		"pmok.ci.yaml":    "server:\n  port: 9000\n",
+		"functions/.keep": "",
+	})
+	testutil.Chdir(t, root)
+	t.Setenv(config.ProfileEnv, "ci")
+
+	err := add.AddFunction(add.AddFunctionCommand{Name: "users", HttpPath: "/users", AllowedMethods: []string{"GET"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, config.FunctionsDir, "users", "index.ts")); err != nil {
+		t.Fatalf("expected the function to be created, but got %v", err)
+	}
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conf.Manifest.Functions["users"].HttpPathname != "/users" {
+		t.Fatalf("expected users in the manifest, but got %+v", conf.Manifest.Functions)
+	}
+	if conf.Manifest.Server != nil {
+		t.Fatalf("expected the profile not to leak into the manifest, but got %+v", conf.Manifest.Server)
+	}
+}
@@ -0,0 +1,134 @@
+package add
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/grpcmock"
+	"github.com/protomoks/pmok/internal/mockspec"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type AddGrpcCommand struct {
+	// Proto is the .proto file defining the services
+	Proto string
+	// Services limits the registered services by name, all services of the
+	// proto when empty
+	Services []string
+}
+
+func (a AddGrpcCommand) Valid() error {
+	if a.Proto == "" {
+		return errors.New("proto is required")
+	}
+	if filepath.Ext(a.Proto) != ".proto" {
+		return fmt.Errorf("%s is not a .proto file", a.Proto)
+	}
+	return nil
+}
+
+// AddGrpc registers the services of a proto in the manifest and creates a
+// mock spec for every method that has none. Returns the registered services
+func AddGrpc(c AddGrpcCommand) ([]string, error) {
+	if err := c.Valid(); err != nil {
+		return nil, err
+	}
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(conf.GetProjectDir(), config.ProtomokDir)
+	abs, err := filepath.Abs(c.Proto)
+	if err != nil {
+		return nil, err
+	}
+	// protos are stored relative to the protomok directory
+	proto, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return nil, err
+	}
+
+	g := conf.Manifest.Grpc
+	if g == nil {
+		g = &config.GrpcConfig{}
+	}
+	files, err := grpcmock.Compile(dir, g.ImportPaths, proto)
+	if err != nil {
+		return nil, err
+	}
+	var services []protoreflect.ServiceDescriptor
+	for _, svc := range grpcmock.Services(files[0]) {
+		if len(c.Services) == 0 || contains(c.Services, string(svc.FullName()), string(svc.Name())) {
+			services = append(services, svc)
+		}
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services to add in %s", c.Proto)
+	}
+
+	if g.Services == nil {
+		g.Services = make(map[string]config.GrpcService)
+	}
+	var names []string
+	for _, svc := range services {
+		name := string(svc.FullName())
+		g.Services[name] = config.GrpcService{Proto: filepath.ToSlash(proto)}
+		names = append(names, name)
+		if err := createGrpcMocks(conf.GetProjectDir(), svc); err != nil {
+			return nil, err
+		}
+	}
+	conf.Manifest.Grpc = g
+
+	return names, conf.Commit()
+}
+
+func contains(names []string, fullName, name string) bool {
+	for _, n := range names {
+		if n == fullName || n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// createGrpcMocks writes a spec answering every method of svc with an empty
+// message, specs that already exist are kept
+func createGrpcMocks(projectRoot string, svc protoreflect.ServiceDescriptor) error {
+	mocksDir := filepath.Join(projectRoot, config.MocksDir)
+	for i := 0; i < svc.Methods().Len(); i++ {
+		md := svc.Methods().Get(i)
+		p := filepath.Join(mocksDir, grpcmock.MockFileName(grpcmock.MethodPath(md)))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if _, err := os.Stat(p); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		msg, err := grpcmock.Template(md.Output())
+		if err != nil {
+			return err
+		}
+		spec := mockspec.Spec{
+			SpecVersion: mockspec.SpecVersion,
+			Request: mockspec.SpecRequest{
+				Method:      "POST",
+				RequestPath: grpcmock.MethodPath(md),
+			},
+			Grpc: &mockspec.SpecGrpc{Messages: []json.RawMessage{msg}},
+		}
+		b, err := json.MarshalIndent(spec, "", " ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, append(b, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
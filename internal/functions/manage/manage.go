@@ -0,0 +1,175 @@
+// Package manage lists, removes, renames and updates the functions of a
+// project, keeping the manifest and the functions directory consistent.
+package manage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/protomoks/pmok/internal/config"
+)
+
+// FunctionInfo is a function of the manifest or a directory of the functions
+// directory that is missing from the manifest
+type FunctionInfo struct {
+	Name string
+	config.Function
+	// InManifest is false for directories without a manifest entry
+	InManifest bool
+	// Problems are inconsistencies between the manifest and the directory
+	Problems []string
+}
+
+func functionDir(conf *config.Config, name string) string {
+	return filepath.Join(conf.GetProjectDir(), config.FunctionsDir, name)
+}
+
+// List returns the functions of the manifest and the orphaned function
+// directories, sorted by name
+func List(conf *config.Config) ([]FunctionInfo, error) {
+	var infos []FunctionInfo
+	for name, fn := range conf.Manifest.Functions {
+		info := FunctionInfo{Name: name, Function: fn, InManifest: true}
+		dir := functionDir(conf, name)
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			info.Problems = append(info.Problems, fmt.Sprintf("directory %s does not exist", filepath.Join(config.FunctionsDir, name)))
+		} else if _, err := os.Stat(filepath.Join(dir, fn.Entrypoint)); errors.Is(err, os.ErrNotExist) {
+			info.Problems = append(info.Problems, fmt.Sprintf("entrypoint %s does not exist", filepath.Join(config.FunctionsDir, name, fn.Entrypoint)))
+		}
+		infos = append(infos, info)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(conf.GetProjectDir(), config.FunctionsDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, ok := conf.Manifest.Functions[e.Name()]; ok {
+			continue
+		}
+		infos = append(infos, FunctionInfo{
+			Name:     e.Name(),
+			Problems: []string{"not in the manifest"},
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos, nil
+}
+
+// ValidName checks that a function name can be used as a directory name
+func ValidName(name string) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	return nil
+}
+
+// Remove deletes a function from the manifest and removes its directory.
+// Orphaned directories can be removed too. With keepFiles the directory is
+// left on disk
+func Remove(conf *config.Config, name string, keepFiles bool) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	dir := functionDir(conf, name)
+	_, inManifest := conf.Manifest.Functions[name]
+	if !inManifest {
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("function %s does not exist", name)
+		}
+	} else {
+		delete(conf.Manifest.Functions, name)
+		// commit first, a conflicting manifest must not lose the code
+		if err := conf.Commit(); err != nil {
+			return err
+		}
+	}
+	if keepFiles {
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
+
+// Rename renames a function and its directory
+func Rename(conf *config.Config, from, to string) error {
+	for _, name := range []string{from, to} {
+		if err := ValidName(name); err != nil {
+			return err
+		}
+	}
+	fn, ok := conf.Manifest.Functions[from]
+	if !ok {
+		return fmt.Errorf("function %s does not exist", from)
+	}
+	if _, ok := conf.Manifest.Functions[to]; ok {
+		return fmt.Errorf("function with name %s already exists", to)
+	}
+	fromDir, toDir := functionDir(conf, from), functionDir(conf, to)
+	if _, err := os.Stat(toDir); err == nil {
+		return fmt.Errorf("directory %s already exists", filepath.Join(config.FunctionsDir, to))
+	}
+
+	moved := false
+	if _, err := os.Stat(fromDir); err == nil {
+		if err := os.Rename(fromDir, toDir); err != nil {
+			return err
+		}
+		moved = true
+	}
+	delete(conf.Manifest.Functions, from)
+	conf.Manifest.Functions[to] = fn
+	if err := conf.Commit(); err != nil {
+		// keep the directory in line with the unchanged manifest
+		if moved {
+			os.Rename(toDir, fromDir)
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateFunctionCommand holds the fields to change, empty fields are kept
+type UpdateFunctionCommand struct {
+	Name           string
+	HttpPath       string
+	AllowedMethods []string
+}
+
+// Update changes the path or the methods of a function
+func Update(conf *config.Config, c UpdateFunctionCommand) error {
+	fn, ok := conf.Manifest.Functions[c.Name]
+	if !ok {
+		return fmt.Errorf("function %s does not exist", c.Name)
+	}
+	if c.HttpPath == "" && len(c.AllowedMethods) == 0 {
+		return errors.New("nothing to update, set a path or methods")
+	}
+	if c.HttpPath != "" {
+		if !strings.HasPrefix(c.HttpPath, "/") {
+			return fmt.Errorf("path %s must start with /", c.HttpPath)
+		}
+		fn.HttpPathname = c.HttpPath
+	}
+	if len(c.AllowedMethods) > 0 {
+		methods := make([]string, len(c.AllowedMethods))
+		for i, m := range c.AllowedMethods {
+			methods[i] = strings.ToUpper(m)
+		}
+		fn.AllowedMethods = methods
+	}
+	conf.Manifest.Functions[c.Name] = fn
+	return conf.Commit()
+}
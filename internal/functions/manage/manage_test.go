@@ -0,0 +1,111 @@
+package manage_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/functions/manage"
+	"github.com/protomoks/pmok/internal/testutil"
+)
+
+const manifest = `version: "0.01"
+project:
+  name: test
+functions:
+  users:
+    path: /users
+    entrypoint: index.ts
+    methods: [GET]
+  orders:
+    path: /orders
+    entrypoint: index.ts
+    methods: [GET]
+`
+
+func newProject(t *testing.T) (string, *config.Config) {
+	t.Helper()
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml":                manifest,
+		"functions/users/index.ts": "",
+		"functions/legacy/main.ts": "",
+	})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return root, conf
+}
+
+func TestList(t *testing.T) {
+	_, conf := newProject(t)
+	infos, err := manage.List(conf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, fn := range infos {
+		got = append(got, fn.Name+":"+strings.Join(fn.Problems, ","))
+	}
+	want := []string{
+		"legacy:not in the manifest",
+		"orders:directory protomok/functions/orders does not exist",
+		"users:",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected %v, but got %v", want, got)
+	}
+}
+
+func TestRename(t *testing.T) {
+	root, conf := newProject(t)
+	if err := manage.Rename(conf, "users", "accounts"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "protomok/functions/accounts/index.ts")); err != nil {
+		t.Fatalf("expected the directory to be renamed, but got %v", err)
+	}
+	conf, _ = config.ReadConfig(root)
+	if _, ok := conf.Manifest.Functions["accounts"]; !ok {
+		t.Fatalf("expected accounts in the manifest, but got %v", conf.Manifest.Functions)
+	}
+	if err := manage.Rename(conf, "accounts", "orders"); err == nil {
+		t.Fatalf("expected renaming onto an existing function to fail")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	root, conf := newProject(t)
+	if err := manage.Remove(conf, "users", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "protomok/functions/users")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the directory to be removed, but got %v", err)
+	}
+	if err := manage.Remove(conf, "legacy", false); err != nil {
+		t.Fatalf("expected orphaned directories to be removable, but got %v", err)
+	}
+	if err := manage.Remove(conf, "../protomok", false); err == nil {
+		t.Fatalf("expected an invalid name to be rejected")
+	}
+	conf, _ = config.ReadConfig(root)
+	if len(conf.Manifest.Functions) != 1 {
+		t.Fatalf("expected 1 function left, but got %v", conf.Manifest.Functions)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	root, conf := newProject(t)
+	err := manage.Update(conf, manage.UpdateFunctionCommand{Name: "users", AllowedMethods: []string{"get", "post"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conf, _ = config.ReadConfig(root)
+	fn := conf.Manifest.Functions["users"]
+	if fn.HttpPathname != "/users" || strings.Join(fn.AllowedMethods, ",") != "GET,POST" {
+		t.Fatalf("expected only the methods to change, but got %+v", fn)
+	}
+}
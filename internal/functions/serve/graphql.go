@@ -0,0 +1,50 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/graphqlmock"
+)
+
+// graphqlHost is the name of the host in the mock server container
+const graphqlHost = "host.docker.internal"
+
+// startGraphql serves the auto-mocks of the GraphQL schema of the manifest on
+// the host. It returns the URL the mock server container forwards operations
+// to, empty when the manifest has no schema, and a function that stops the
+// server
+func startGraphql(conf *config.Config) (string, func(), error) {
+	g := conf.Manifest.Graphql
+	if g == nil || g.Schema == "" {
+		return "", func() {}, nil
+	}
+	schema, err := graphqlmock.LoadSchema(filepath.Join(conf.GetProjectDir(), config.ProtomokDir, g.Schema))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid graphql schema: %w", err)
+	}
+	// the container reaches the host through its gateway, not through localhost
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return "", nil, err
+	}
+	server := &http.Server{Handler: schema}
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("GraphQL mock server stopped: %s\n", err)
+		}
+	}()
+
+	url := fmt.Sprintf("http://%s:%d", graphqlHost, l.Addr().(*net.TCPAddr).Port)
+	return url, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
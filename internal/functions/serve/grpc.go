@@ -0,0 +1,61 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/grpcmock"
+	"github.com/protomoks/pmok/internal/mockserver"
+	"github.com/protomoks/pmok/internal/utils/constants"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// startGrpc serves the gRPC mocks of the manifest on the host, next to the
+// mock server container. The returned function stops the server, it is a no-op
+// when the manifest has no gRPC services
+func startGrpc(conf *config.Config) (func(), error) {
+	g := conf.Manifest.Grpc
+	if g == nil || len(g.Services) == 0 {
+		return func() {}, nil
+	}
+	dir := filepath.Join(conf.GetProjectDir(), config.ProtomokDir)
+	reg, err := grpcmock.Load(dir, g)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grpc protos: %w", err)
+	}
+	h, err := mockserver.Load(filepath.Join(conf.GetProjectDir(), config.MocksDir), conf.Manifest.Scenarios)
+	if err != nil {
+		return nil, err
+	}
+	h.SetRegistry(reg)
+
+	port := g.Port
+	if port == 0 {
+		port = constants.GrpcDefaultPort
+	}
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: h2c.NewHandler(h, &http2.Server{})}
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("gRPC mock server stopped: %s\n", err)
+		}
+	}()
+	fmt.Printf("Serving %d gRPC methods on port %d\n", reg.Len(), port)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
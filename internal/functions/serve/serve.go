@@ -3,15 +3,18 @@ package serve
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/go-connections/nat"
 	"github.com/protomoks/pmok/internal/config"
 	"github.com/protomoks/pmok/internal/functions/serve/docker"
+	"github.com/protomoks/pmok/internal/mockspec"
 	"github.com/protomoks/pmok/internal/utils"
 	"github.com/protomoks/pmok/internal/utils/constants"
 )
@@ -19,23 +22,64 @@ import (
 //go:embed templates/local-main.ts
 var mainFunc string
 
-func Run(ctx context.Context, cm docker.ContainerManager) error {
-	conf := config.GetConfig()
-	if conf == nil {
-		return utils.ConfigNotFound()
+// Run starts the mock server container for conf. The runtime receives the
+// effective manifest, migrated and with its profile merged in
+func Run(ctx context.Context, cm docker.ContainerManager, conf *config.Config) error {
+	// fail early on broken mock specs and faults instead of inside the container
+	if err := conf.Manifest.ValidateFaults(); err != nil {
+		return err
+	}
+	if err := mockspec.CheckDir(filepath.Join(conf.GetProjectDir(), config.MocksDir)); err != nil {
+		return fmt.Errorf("invalid mocks: %w", err)
+	}
+	graphqlMockURL, stopGraphql, err := startGraphql(conf)
+	if err != nil {
+		return err
+	}
+	defer stopGraphql()
+	stopGrpc, err := startGrpc(conf)
+	if err != nil {
+		return err
 	}
+	defer stopGrpc()
 	// remove the container
 	_ = cm.KillAndRemoveContainer(ctx, constants.FunctionsServerContainer, container.RemoveOptions{
 		Force:         true,
 		RemoveVolumes: true,
 	})
+	server := config.ServerConfig{}
+	if conf.Manifest.Server != nil {
+		server = *conf.Manifest.Server
+	}
+	image := constants.DenoImage
+	if server.Image != "" {
+		image = server.Image
+	}
+	port := 8000
+	if server.Port != 0 {
+		port = server.Port
+	}
 	// pull the image
-	if err := cm.PullImage(ctx, constants.DenoImage, os.Stderr); err != nil {
+	if err := cm.PullImage(ctx, image, os.Stderr); err != nil {
 		return err
 	}
 
+	manifest := conf.Manifest.Copy()
+	manifest.Functions = manifest.Functions.Enabled()
+	effective, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
 	env := []string{
 		fmt.Sprintf("PROTOMOK_CONFIG_ENCODING=%s", string(conf.Manifest.Encoding())),
+		fmt.Sprintf("PROTOMOK_CONFIG=%s", effective),
+		fmt.Sprintf("PROTOMOK_SPEC_VERSION=%d", mockspec.SpecVersion),
+	}
+	if graphqlMockURL != "" {
+		env = append(env, "PROTOMOK_GRAPHQL_MOCK_URL="+graphqlMockURL)
+	}
+	for k, v := range server.Env {
+		env = append(env, k+"="+v)
 	}
 
 	cmd := []string{
@@ -57,18 +101,20 @@ EOF
 		&container.Config{
 			Env: env,
 			//Image: constants.EdgeRuntimeImage,
-			Image:        constants.DenoImage,
+			Image:        image,
 			Entrypoint:   entryPoint,
 			ExposedPorts: nat.PortSet{nat.Port(fmt.Sprintf("%d/tcp", 8000)): struct{}{}},
 			WorkingDir:   utils.Slashify(conf.GetProjectDir()),
 		},
 		&container.HostConfig{
 			Binds: createBinds(conf),
+			// lets the container reach the GraphQL auto-mocks on Linux too
+			ExtraHosts: []string{graphqlHost + ":host-gateway"},
 			PortBindings: nat.PortMap{
 				nat.Port(fmt.Sprintf("%d/tcp", 8000)): []nat.PortBinding{
 					{
 						HostIP:   "0.0.0.0",
-						HostPort: "8000",
+						HostPort: strconv.Itoa(port),
 					},
 				},
 			},
@@ -15,24 +15,91 @@ interface Function {
   path: string;
   entrypoint: string;
   methods: string[];
+  priority?: number;
+  faults?: Faults;
+  disabled?: boolean;
 }
 interface FunctionConfig {
   [name: string]: Function;
 }
+interface MockEvent {
+  // milliseconds after the response started
+  at: number;
+  data: string;
+}
+interface MockResponse {
+  status: number;
+  headers: Record<string, string[]>;
+  body?: any;
+  // the source text of body, set by parseMock. Bodies are served from it so
+  // that 64 bit numbers keep their digits and keys their order
+  rawBody?: string;
+  // the raw body, for responses that are not valid JSON
+  bodyText?: string;
+  // a file next to the spec that holds the body, for large or binary bodies
+  bodyFile?: string;
+  // the events of a recorded stream, sent at their recorded times
+  events?: MockEvent[];
+  // the Content-Encoding the body was recorded with, bodies are stored decoded
+  encoding?: string;
+  template?: boolean;
+}
+interface MockSequence {
+  mode?: "stick" | "loop";
+  responses: MockResponse[];
+}
+interface Faults {
+  latency?: { fixedMs?: number; minMs?: number; maxMs?: number };
+  errorRate?: number;
+  errorStatus?: number;
+  truncateRate?: number;
+  resetRate?: number;
+}
+interface MockMessage {
+  // milliseconds after the connection opened
+  at: number;
+  from: "client" | "server";
+  // text by default, binary data is base64 encoded
+  type?: "text" | "binary" | "close";
+  data?: string;
+  code?: number;
+}
+interface MockWebSocket {
+  messages?: MockMessage[];
+  rules?: { match?: string; reply: string }[];
+}
+// StaticMock follows mockspec.Spec and spec.schema.json in the pmok sources
 interface StaticMock {
+  specVersion?: number;
+  priority?: number;
+  faults?: Faults;
   request: {
     method: string;
     path: string;
     headers: Record<string, string[]>;
   };
-  response: {
-    status: number;
-    headers: Record<string, string[]>;
-    body?: any;
+  response: MockResponse;
+  scenario?: {
+    name: string;
+    states: Record<string, MockSequence>;
   };
+  websocket?: MockWebSocket;
+  // gRPC mocks are served by pmok itself, on the gRPC port of the manifest
+  grpc?: unknown;
+  graphql?: MockGraphql;
+}
+// MockGraphql narrows a mock to one GraphQL operation, and to its variables
+// when they are set
+interface MockGraphql {
+  operationName: string;
+  variables?: Record<string, unknown> | null;
 }
 
 const PROTOMOK_CONFIG_ENCODING = Deno.env.get("PROTOMOK_CONFIG_ENCODING")!;
+// the newest spec format pmok can read, specs without a version are version 1
+const PROTOMOK_SPEC_VERSION = Number(
+  Deno.env.get("PROTOMOK_SPEC_VERSION") ?? "1"
+);
 let functionConfig: FunctionConfig = {};
 
 type Methods = "GET" | "POST" | "PUT" | "DELETE" | "PATCH";
@@ -40,6 +107,47 @@ type Methods = "GET" | "POST" | "PUT" | "DELETE" | "PATCH";
 type NodeData = {
   [key in Methods]?: string[];
 };
+interface RadixMatch {
+  value: NodeData;
+  params: Record<string, string>;
+  pattern: string[];
+}
+
+// Route ordering. Keep in sync with internal/routing, which reports
+// ambiguous and shadowed routes in pmok check. Higher priorities come first,
+// then the most specific pattern: literal segments beat :params, which beat
+// * wildcards. On a tie functions come before mocks, then mocks for a GraphQL
+// operation come first
+interface RankedRoute {
+  priority: number;
+  pattern: string[];
+  kind: "function" | "mock";
+  // 1 for mocks of a GraphQL operation, 2 when they also name its variables
+  graphql?: number;
+}
+
+const segmentRank = (segment: string) =>
+  segment === "*" ? 2 : segment.startsWith(":") ? 1 : 0;
+
+const compareRoutes = (a: RankedRoute, b: RankedRoute): number => {
+  if (a.priority !== b.priority) {
+    return b.priority - a.priority;
+  }
+  const len = Math.min(a.pattern.length, b.pattern.length);
+  for (let i = 0; i < len; i++) {
+    const diff = segmentRank(a.pattern[i]) - segmentRank(b.pattern[i]);
+    if (diff !== 0) {
+      return diff;
+    }
+  }
+  if (a.pattern.length !== b.pattern.length) {
+    return b.pattern.length - a.pattern.length;
+  }
+  if (a.kind !== b.kind) {
+    return a.kind === "function" ? -1 : 1;
+  }
+  return (b.graphql || 0) - (a.graphql || 0);
+};
 class RadixNode {
   children: Record<string, RadixNode> = {};
   value: NodeData | null = null;
@@ -52,7 +160,9 @@ class RadixNode {
     value: {
       method: Methods;
       filePath: string;
-    }
+    },
+    // inserts the file path before existing ones so it is served first
+    front = false
   ): RadixNode {
     if (segments.length == 0) {
       if (!this.value) {
@@ -60,7 +170,15 @@ class RadixNode {
           [value.method]: [value.filePath],
         };
       } else if (this.value[value.method]) {
-        this.value[value.method]?.push(value.filePath);
+        const files = this.value[value.method]!.filter(
+          (f) => f !== value.filePath
+        );
+        if (front) {
+          files.unshift(value.filePath);
+        } else {
+          files.push(value.filePath);
+        }
+        this.value[value.method] = files;
       } else {
         this.value[value.method] = [value.filePath];
       }
@@ -73,20 +191,42 @@ class RadixNode {
       child = new RadixNode();
       this.children[segment] = child;
     }
-    return child.insert(rest, value);
+    return child.insert(rest, value, front);
   }
 
-  get(segments: string[]): NodeData | null {
+  // collects every node matching the segments. A * segment matches the rest
+  // of the path, one segment at least like URLPattern for functions
+  getAll(
+    segments: string[],
+    params: Record<string, string> = {},
+    pattern: string[] = [],
+    out: RadixMatch[] = []
+  ): RadixMatch[] {
+    const wildcard = this.children["*"];
+    if (wildcard?.value && segments.length > 0) {
+      out.push({ value: wildcard.value, params, pattern: [...pattern, "*"] });
+    }
     if (segments.length == 0) {
-      return this.value;
+      if (this.value) {
+        out.push({ value: this.value, params, pattern });
+      }
+      return out;
     }
 
     const [segment, ...rest] = segments;
-    const child = this.children[segment];
-    if (!child) {
-      return null;
+    for (const key in this.children) {
+      if (key === segment) {
+        this.children[key].getAll(rest, params, [...pattern, key], out);
+      } else if (key.startsWith(":")) {
+        this.children[key].getAll(
+          rest,
+          { ...params, [key.slice(1)]: decodeURIComponent(segment) },
+          [...pattern, key],
+          out
+        );
+      }
     }
-    return child.get(rest);
+    return out;
   }
 
   size(): number {
@@ -153,30 +293,168 @@ class Logger {
 
 const logger = new Logger();
 
+// Mocks added through the admin API only live in memory. They are stored in
+// the radix tree under a runtime: key instead of a file path
+interface LoadedMock {
+  method: string;
+  path: string;
+  source: string;
+  scenario?: string;
+}
+const loadedMocks: LoadedMock[] = [];
+const runtimeMocks = new Map<string, StaticMock>();
+const mockPriorities = new Map<string, number>();
+
+const registerMock = (
+  root: RadixNode,
+  mock: StaticMock,
+  source: string,
+  front = false
+) => {
+  const method = mock.request.method.toUpperCase();
+  root.insert(
+    mock.request.path.split("/"),
+    { method: method as Methods, filePath: source },
+    front
+  );
+  mockPriorities.set(source, mock.priority || 0);
+  if (mock.graphql) {
+    mockOperations.set(source, {
+      name: mock.graphql.operationName,
+      variables: canonicalVariables(mock.graphql.variables),
+    });
+  } else {
+    mockOperations.delete(source);
+  }
+  const existing = loadedMocks.findIndex((m) => m.source === source);
+  if (existing >= 0) {
+    loadedMocks.splice(existing, 1);
+  }
+  loadedMocks.push({
+    method,
+    path: mock.request.path,
+    source,
+    scenario: mock.scenario?.name,
+  });
+};
+
+// bodyPath reports whether a member path leads to the body of a response,
+// the response of a spec or of a scenario state
+const bodyPath = (path: string[]) =>
+  (path.length === 2 && path[0] === "response" && path[1] === "body") ||
+  (path.length === 6 &&
+    path[0] === "scenario" &&
+    path[1] === "states" &&
+    path[3] === "responses" &&
+    path[5] === "body");
+
+// rawBodies returns the source text of the response bodies of valid JSON,
+// keyed by member path
+const rawBodies = (text: string): [string[], string][] => {
+  const found: [string[], string][] = [];
+  let i = 0;
+  const space = () => {
+    while (i < text.length && " \t\n\r".includes(text[i])) i++;
+  };
+  const string = (): string => {
+    const start = i++;
+    while (text[i] !== '"') i += text[i] === "\\" ? 2 : 1;
+    i++;
+    return JSON.parse(text.slice(start, i));
+  };
+  const value = (path: string[]) => {
+    space();
+    const start = i;
+    if (text[i] === "{") {
+      i++;
+      space();
+      while (text[i] !== "}") {
+        const key = string();
+        space();
+        i++; // :
+        value([...path, key]);
+        space();
+        if (text[i] === ",") i++;
+        space();
+      }
+      i++;
+    } else if (text[i] === "[") {
+      i++;
+      space();
+      for (let n = 0; text[i] !== "]"; n++) {
+        value([...path, String(n)]);
+        space();
+        if (text[i] === ",") i++;
+        space();
+      }
+      i++;
+    } else if (text[i] === '"') {
+      string();
+    } else {
+      while (i < text.length && !",}] \t\n\r".includes(text[i])) i++;
+    }
+    if (bodyPath(path)) {
+      found.push([path, text.slice(start, i)]);
+    }
+  };
+  value([]);
+  return found;
+};
+
+// parseMock parses a spec and keeps the source text of its response bodies in
+// rawBody, like json.RawMessage in mockspec.Spec
+const parseMock = (text: string): StaticMock => {
+  const mock = JSON.parse(text);
+  for (const [path, raw] of rawBodies(text)) {
+    let response = mock;
+    for (const key of path.slice(0, -1)) {
+      response = response[key];
+    }
+    response.rawBody = raw;
+  }
+  return mock;
+};
+
 const buildRadixTree = async (): Promise<RadixNode> => {
   const root = new RadixNode();
   const mockDir = posix.join(Deno.cwd(), "protomok/mocks");
+  // sort the files so that equally ranked mocks are always served in the
+  // same order
+  const files: string[] = [];
   for await (const entry of walk(mockDir, { exts: ["json"] })) {
+    files.push(entry.path);
+  }
+  files.sort();
+  for (const file of files) {
     const decoder = new TextDecoder();
-    const data = await Deno.readFile(entry.path);
-    const json = JSON.parse(decoder.decode(data));
-    const mockPath = json.request.path;
-    const mockMethod = json.request.method;
-    const mockFilePath = entry.path;
-    const segments = mockPath.split("/");
-    const node = root.insert(segments, {
-      method: mockMethod.toUpperCase(),
-      filePath: mockFilePath,
-    });
+    const data = await Deno.readFile(file);
+    const json: StaticMock = JSON.parse(decoder.decode(data));
+    if ((json.specVersion ?? 1) > PROTOMOK_SPEC_VERSION) {
+      logger.warn(
+        `Skipping ${file}, spec version ${json.specVersion} is newer than ${PROTOMOK_SPEC_VERSION}`
+      );
+      continue;
+    }
+    if (json.grpc) {
+      continue;
+    }
+    registerMock(root, json, file);
 
-    logger.debug(`Inserted ${mockPath} with method ${mockMethod}`);
-    logger.debug(`Node value`, node.value);
+    logger.debug(
+      `Inserted ${json.request.path} with method ${json.request.method}`
+    );
   }
 
   return root;
 };
 
 const readConfig = async () => {
+  // pmok serve passes the effective manifest, with its profile merged in
+  const effective = Deno.env.get("PROTOMOK_CONFIG");
+  if (effective) {
+    logger.debug("Using the manifest passed by pmok serve");
+    return JSON.parse(effective);
+  }
   const decoder = new TextDecoder();
   const configPath = posix.join(
     Deno.cwd(),
@@ -193,14 +471,23 @@ const readConfig = async () => {
   return json;
 };
 
+// functions sorted by route order, see compareRoutes
+let sortedFunctions: [string, Function][] = [];
+
+const sortFunctions = () => {
+  sortedFunctions = Object.entries(functionConfig).sort(
+    ([nameA, a], [nameB, b]) =>
+      compareRoutes(
+        { priority: a.priority || 0, pattern: a.path.split("/"), kind: "function" },
+        { priority: b.priority || 0, pattern: b.path.split("/"), kind: "function" }
+      ) || nameA.localeCompare(nameB)
+  );
+};
+
 const findFunctionMatch = (
   req: Request
 ): [string, Function | null, Record<string, string | undefined>] => {
-  let match: Function | null = null;
-  let key = "";
-  let params: Record<string, string | undefined> = {};
-  for (const name in functionConfig) {
-    const fn = functionConfig[name];
+  for (const [name, fn] of sortedFunctions) {
     // don't even consider the function if there is not match on the method
     if (
       fn.methods.indexOf("*") < 0 &&
@@ -212,32 +499,677 @@ const findFunctionMatch = (
     if (!patternMatch) {
       continue;
     }
-    params = patternMatch.pathname.groups;
-    match = fn;
-    key = name;
-    break;
+    return [name, fn, patternMatch.pathname.groups];
+  }
+  return ["", null, {}];
+};
+
+interface StaticMatch {
+  mock: StaticMock;
+  params: Record<string, string>;
+  source: string;
+  rank: RankedRoute;
+}
+
+// GraphQL. Keep in sync with internal/mockspec/graphql.go. All operations of
+// an API share its path, mocks tell them apart by operation name and variables
+interface GraphqlRequest {
+  query: string;
+  operationName?: string | null;
+  variables?: Record<string, unknown> | null;
+}
+// the operation and the canonical variables of the GraphQL mocks by source
+const mockOperations = new Map<string, { name: string; variables: string }>();
+
+const operationPattern =
+  /(?:^|[\s{}])(?:query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)/;
+
+// the operation name of a request, the first operation of the query when the
+// request does not name one
+const graphqlOperation = (g: GraphqlRequest) =>
+  g.operationName || g.query.match(operationPattern)?.[1] || "";
+
+// canonicalVariables sorts the keys of variables so equal variables compare
+// equal. Empty for no variables
+const canonicalVariables = (vars: unknown): string => {
+  if (vars === null || vars === undefined) {
+    return "";
+  }
+  if (
+    typeof vars === "object" &&
+    !Array.isArray(vars) &&
+    Object.keys(vars).length === 0
+  ) {
+    return "";
+  }
+  const sorted = (v: unknown): unknown => {
+    if (Array.isArray(v)) {
+      return v.map(sorted);
+    }
+    if (v && typeof v === "object") {
+      const o = v as Record<string, unknown>;
+      return Object.fromEntries(
+        Object.keys(o)
+          .sort()
+          .map((k) => [k, sorted(o[k])])
+      );
+    }
+    return v;
+  };
+  return JSON.stringify(sorted(vars));
+};
+
+// parseGraphqlRequest reads the operation of a JSON body or of the query
+// parameters, null for requests that are not GraphQL
+const parseGraphqlRequest = async (
+  req: Request
+): Promise<GraphqlRequest | null> => {
+  let g: GraphqlRequest | null = null;
+  const method = req.method.toUpperCase();
+  if (method === "GET") {
+    const params = new URL(req.url).searchParams;
+    try {
+      const variables = params.get("variables");
+      g = {
+        query: params.get("query") || "",
+        operationName: params.get("operationName"),
+        variables: variables ? JSON.parse(variables) : null,
+      };
+    } catch {
+      return null;
+    }
+  } else if (method === "POST") {
+    const contentType = (req.headers.get("content-type") || "")
+      .split(";")[0]
+      .trim()
+      .toLowerCase();
+    if (contentType === "application/graphql") {
+      g = { query: await req.clone().text() };
+    } else if (contentType === "application/json") {
+      g = await req
+        .clone()
+        .json()
+        .catch(() => null);
+    }
   }
-  return [key, match, params];
+  if (!g || typeof g.query !== "string" || g.query.trim() === "") {
+    return null;
+  }
+  return g;
+};
+
+const matchesOperation = (
+  operation: { name: string; variables: string },
+  g: GraphqlRequest
+) =>
+  operation.name === graphqlOperation(g) &&
+  (operation.variables === "" ||
+    operation.variables === canonicalVariables(g.variables));
+
+// Operations sent to the GraphQL path without a mock are auto-mocked from the
+// schema by internal/graphqlmock, which pmok serve runs next to the container
+let graphqlPath = "/graphql";
+const graphqlMockUrl = Deno.env.get("PROTOMOK_GRAPHQL_MOCK_URL") || "";
+
+// graphqlMock forwards an operation to the auto-mocks
+const graphqlMock = async (req: Request): Promise<Response> => {
+  const res = await fetch(graphqlMockUrl + new URL(req.url).search, {
+    method: req.method,
+    headers: { "content-type": req.headers.get("content-type") || "" },
+    body: req.method.toUpperCase() === "GET" ? null : await req.arrayBuffer(),
+  });
+  return new Response(res.body, {
+    status: res.status,
+    headers: { "content-type": "application/json" },
+  });
 };
 
 const findStaticMatch = async (
   req: Request,
   root: RadixNode
-): Promise<StaticMock | null> => {
-  const segments = new URL(req.url).pathname.split("/");
+): Promise<StaticMatch | null> => {
+  const pathname = new URL(req.url).pathname;
+  const segments = pathname.split("/");
   const method = req.method.toUpperCase() as Methods;
-  const value = root.get(segments);
-  if (value && req.method.toUpperCase() in value) {
-    const filePath = value[method] ? value[method][0] : null;
-    if (filePath) {
-      const data = await Deno.readFile(filePath);
-      const json = JSON.parse(new TextDecoder().decode(data));
-      return json;
+  const candidates: Omit<StaticMatch, "mock">[] = [];
+  // only requests to the GraphQL path are operations, they are parsed once a
+  // GraphQL mock is a candidate
+  let graphql: GraphqlRequest | null | undefined =
+    pathname === graphqlPath ? undefined : null;
+  for (const found of root.getAll(segments)) {
+    for (const source of found.value[method] || []) {
+      const operation = mockOperations.get(source);
+      if (operation) {
+        if (graphql === undefined) {
+          graphql = await parseGraphqlRequest(req);
+        }
+        if (!graphql || !matchesOperation(operation, graphql)) {
+          continue;
+        }
+      }
+      candidates.push({
+        params: found.params,
+        source,
+        rank: {
+          priority: mockPriorities.get(source) || 0,
+          pattern: found.pattern,
+          kind: "mock",
+          graphql: operation ? (operation.variables ? 2 : 1) : 0,
+        },
+      });
+    }
+  }
+  if (candidates.length === 0) {
+    return null;
+  }
+  // Array.prototype.sort is stable, runtime mocks stay ahead of files
+  candidates.sort((a, b) => compareRoutes(a.rank, b.rank));
+  const best = candidates[0];
+  if (runtimeMocks.has(best.source)) {
+    return { ...best, mock: runtimeMocks.get(best.source)! };
+  }
+  const data = await Deno.readFile(best.source);
+  return { ...best, mock: parseMock(new TextDecoder().decode(data)) };
+};
+
+// Scenario state. Every call to a sequenced mock advances a counter keyed by
+// scenario, state and mock file. The counters live until the server restarts
+// or a test suite resets them through the control endpoint
+const ADMIN_PREFIX = "/__pmok";
+const DEFAULT_SCENARIO_STATE = "default";
+let initialScenarioStates: Record<string, string> = {};
+let scenarioStates: Record<string, string> = {};
+const sequenceCalls = new Map<string, number>();
+
+const resolveScenario = (mock: StaticMock, filePath: string): StaticMock => {
+  if (!mock.scenario) {
+    return mock;
+  }
+  const { name, states } = mock.scenario;
+  const state = scenarioStates[name] || DEFAULT_SCENARIO_STATE;
+  const sequence = states[state];
+  // states without a sequence fall back to the plain response
+  if (!sequence || sequence.responses.length === 0) {
+    return mock;
+  }
+  const key = `${name}:${state}:${filePath}`;
+  const calls = sequenceCalls.get(key) || 0;
+  sequenceCalls.set(key, calls + 1);
+
+  const size = sequence.responses.length;
+  let index = calls;
+  if (index >= size) {
+    index = sequence.mode === "loop" ? index % size : size - 1;
+  }
+  logger.debug(`Scenario ${name} in state ${state} served response ${index}`);
+  return { ...mock, response: sequence.responses[index] };
+};
+
+const resetScenarios = () => {
+  sequenceCalls.clear();
+  scenarioStates = { ...initialScenarioStates };
+};
+
+const setScenarioState = (name: string, state: string) => {
+  scenarioStates[name] = state;
+  for (const key of sequenceCalls.keys()) {
+    if (key.startsWith(`${name}:`)) {
+      sequenceCalls.delete(key);
+    }
+  }
+};
+
+// Fault injection. Route faults (mock spec or function) replace the global
+// faults of the manifest. Rates are percentages between 0 and 100
+let faultsEnabled = true;
+let globalFaults: Faults | null = null;
+// scales the timing of replayed event streams and WebSocket conversations,
+// see server.streamSpeed. 0 replays without delays
+let streamSpeed = 1;
+
+const chance = (percentage?: number) =>
+  !!percentage && Math.random() * 100 < percentage;
+
+const sleep = (ms: number) => new Promise((r) => setTimeout(r, ms));
+
+// validateFaults returns why faults are invalid, null for valid faults. Keep
+// in sync with Faults.Validate in internal/mockspec/faults.go
+const validateFaults = (f: unknown): string | null => {
+  if (!f || typeof f !== "object" || Array.isArray(f)) {
+    return "faults: expected an object";
+  }
+  const faults = f as Record<string, unknown>;
+  const isNumber = (v: unknown) => v === undefined || typeof v === "number";
+  for (const name of ["errorRate", "truncateRate", "resetRate"]) {
+    const rate = faults[name];
+    if (!isNumber(rate) || (rate as number) < 0 || (rate as number) > 100) {
+      return `faults: ${name} must be between 0 and 100, got ${rate}`;
+    }
+  }
+  const status = faults.errorStatus;
+  if (
+    !isNumber(status) ||
+    (status !== undefined &&
+      status !== 0 &&
+      ((status as number) < 100 || (status as number) > 599))
+  ) {
+    return `faults: invalid errorStatus ${status}`;
+  }
+  if (faults.latency !== undefined) {
+    const l = faults.latency as Record<string, unknown>;
+    if (!l || typeof l !== "object" || Array.isArray(l)) {
+      return "faults: latency must be an object";
+    }
+    const { fixedMs = 0, minMs = 0, maxMs = 0 } = l;
+    if (
+      typeof fixedMs !== "number" ||
+      typeof minMs !== "number" ||
+      typeof maxMs !== "number" ||
+      fixedMs < 0 ||
+      minMs < 0 ||
+      maxMs < 0
+    ) {
+      return "faults: latency must not be negative";
+    }
+    if (minMs > 0 && maxMs === 0) {
+      return `faults: latency minMs ${minMs} needs maxMs`;
+    }
+    if (maxMs !== 0 && maxMs < minMs) {
+      return `faults: latency maxMs ${maxMs} is less than minMs ${minMs}`;
     }
   }
   return null;
 };
 
+// Deno.serve cannot close the connection of a request, a reset sends the
+// headers and aborts the body
+const abortedBody = (chunk?: Uint8Array) =>
+  new ReadableStream<Uint8Array>({
+    start(controller) {
+      if (chunk) {
+        controller.enqueue(chunk);
+      }
+      controller.error(new Error("connection reset by fault injection"));
+    },
+  });
+
+const applyFaults = async (
+  routeFaults: Faults | undefined,
+  respond: () => Promise<Response>
+): Promise<Response> => {
+  const faults = routeFaults || globalFaults;
+  if (!faultsEnabled || !faults) {
+    return await respond();
+  }
+  const { latency } = faults;
+  if (latency) {
+    let delay = latency.fixedMs || 0;
+    if (latency.maxMs) {
+      const min = latency.minMs || 0;
+      delay += min + Math.random() * (latency.maxMs - min);
+    }
+    await sleep(delay);
+  }
+  if (chance(faults.resetRate)) {
+    logger.debug("Fault injection: resetting connection");
+    return new Response(abortedBody());
+  }
+  if (chance(faults.errorRate)) {
+    const status = faults.errorStatus || 500;
+    logger.debug(`Fault injection: replacing response with ${status}`);
+    return Response.json({ message: "fault injected" }, { status });
+  }
+  const res = await respond();
+  if (chance(faults.truncateRate) && res.body) {
+    logger.debug("Fault injection: truncating response body");
+    const body = new Uint8Array(await res.arrayBuffer());
+    const headers = new Headers(res.headers);
+    headers.set("Content-Length", `${body.length}`);
+    return new Response(abortedBody(body.slice(0, body.length / 2)), {
+      status: res.status,
+      headers,
+    });
+  }
+  return res;
+};
+
+// Request journal. Keeps the most recent requests in memory so test suites
+// can verify what their clients sent
+interface JournalMatch {
+  type: "mock" | "function" | "none";
+  name?: string;
+}
+interface JournalEntry {
+  id: number;
+  time: string;
+  method: string;
+  path: string;
+  query: Record<string, string[]>;
+  headers: Record<string, string[]>;
+  body: string;
+  match: JournalMatch;
+  status: number;
+  durationMs: number;
+}
+const DEFAULT_JOURNAL_SIZE = 1000;
+
+// journalSize reads PMOK_JOURNAL_SIZE, the number of requests kept. 0 turns
+// the journal off
+const journalSize = (): number => {
+  const value = Deno.env.get("PMOK_JOURNAL_SIZE");
+  if (value === undefined || value === "") {
+    return DEFAULT_JOURNAL_SIZE;
+  }
+  const size = Number(value);
+  if (!Number.isInteger(size) || size < 0) {
+    logger.warn(
+      `Invalid PMOK_JOURNAL_SIZE ${value}, keeping ${DEFAULT_JOURNAL_SIZE} requests`
+    );
+    return DEFAULT_JOURNAL_SIZE;
+  }
+  return size;
+};
+const JOURNAL_SIZE = journalSize();
+// bodies larger than this are cut in the journal, not in the response
+const JOURNAL_MAX_BODY = 64 * 1024;
+let journal: JournalEntry[] = [];
+let journalSeq = 0;
+
+const record = (entry: Omit<JournalEntry, "id">) => {
+  journal.push({ id: ++journalSeq, ...entry });
+  while (journal.length > JOURNAL_SIZE) {
+    journal.shift();
+  }
+};
+
+const toMultiMap = (entries: Iterable<[string, string]>) => {
+  const out: Record<string, string[]> = {};
+  for (const [key, value] of entries) {
+    (out[key] ||= []).push(value);
+  }
+  return out;
+};
+
+// supports ?method=, ?path= (exact or URL pattern), ?match= and ?limit=.
+// Throws a TypeError for an invalid path pattern
+const queryJournal = (params: URLSearchParams): JournalEntry[] => {
+  const method = params.get("method")?.toUpperCase();
+  const path = params.get("path");
+  const pattern = path ? new URLPattern({ pathname: path }) : null;
+  const match = params.get("match");
+  const limit = parseInt(params.get("limit") || "0");
+
+  const entries = journal.filter(
+    (e) =>
+      (!method || e.method === method) &&
+      (!pattern || pattern.test({ pathname: e.path })) &&
+      (!match || e.match.type === match || e.match.name === match)
+  );
+  return limit > 0 ? entries.slice(-limit) : entries;
+};
+
+const handleAdmin = async (
+  req: Request,
+  url: URL,
+  root: RadixNode
+): Promise<Response> => {
+  const path = url.pathname.slice(ADMIN_PREFIX.length);
+  const method = req.method.toUpperCase();
+
+  if (path === "/mocks" && method === "GET") {
+    return Response.json(loadedMocks);
+  }
+  if (path === "/mocks" && method === "PUT") {
+    const mock: StaticMock | null = await req
+      .text()
+      .then(parseMock)
+      .catch(() => null);
+    if (!mock || !mock.request?.method || !mock.request?.path || !mock.response) {
+      return Response.json(
+        { message: "expected a mock spec with a request method and path" },
+        { status: 400 }
+      );
+    }
+    if ((mock.specVersion ?? 1) > PROTOMOK_SPEC_VERSION) {
+      return Response.json(
+        { message: `unsupported spec version ${mock.specVersion}` },
+        { status: 400 }
+      );
+    }
+    // GraphQL mocks share their path, the operation keeps them apart
+    let source = `runtime:${mock.request.method.toUpperCase()} ${mock.request.path}`;
+    if (mock.graphql) {
+      source = `${source} ${mock.graphql.operationName} ${canonicalVariables(
+        mock.graphql.variables
+      )}`.trimEnd();
+    }
+    runtimeMocks.set(source, mock);
+    registerMock(root, mock, source, true);
+    logger.info(`Registered runtime mock ${source}`);
+    return new Response(null, { status: 204 });
+  }
+  if (path === "/functions" && method === "GET") {
+    return Response.json(
+      Object.keys(functionConfig).map((name) => ({
+        name,
+        ...functionConfig[name],
+      }))
+    );
+  }
+  if (path === "/requests" && method === "GET") {
+    try {
+      return Response.json(queryJournal(url.searchParams));
+    } catch (e) {
+      return Response.json(
+        { message: `invalid path pattern: ${(e as Error).message}` },
+        { status: 400 }
+      );
+    }
+  }
+  if (path === "/requests" && method === "DELETE") {
+    journal = [];
+    return new Response(null, { status: 204 });
+  }
+
+  if (path === "/faults" && method === "GET") {
+    return Response.json({ enabled: faultsEnabled, faults: globalFaults });
+  }
+  if (path === "/faults" && method === "PUT") {
+    const body = await req.json().catch(() => null);
+    if (!body || typeof body !== "object") {
+      return Response.json({ message: "expected a JSON body" }, { status: 400 });
+    }
+    if ("enabled" in body && typeof body.enabled !== "boolean") {
+      return Response.json(
+        { message: "enabled must be a boolean" },
+        { status: 400 }
+      );
+    }
+    if ("faults" in body && body.faults !== null) {
+      const invalid = validateFaults(body.faults);
+      if (invalid) {
+        return Response.json({ message: invalid }, { status: 400 });
+      }
+    }
+    if (typeof body.enabled === "boolean") {
+      faultsEnabled = body.enabled;
+    }
+    if ("faults" in body) {
+      globalFaults = body.faults;
+    }
+    return Response.json({ enabled: faultsEnabled, faults: globalFaults });
+  }
+
+  if (path === "/scenarios" && method === "GET") {
+    return Response.json(scenarioStates);
+  }
+  if (path === "/scenarios/reset" && method === "POST") {
+    resetScenarios();
+    return new Response(null, { status: 204 });
+  }
+  const scenario = path.match(/^\/scenarios\/([^/]+)$/);
+  if (scenario && method === "PUT") {
+    const body = await req.json().catch(() => null);
+    if (!body || typeof body.state !== "string") {
+      return Response.json(
+        { message: "expected a JSON body with a state" },
+        { status: 400 }
+      );
+    }
+    setScenarioState(decodeURIComponent(scenario[1]), body.state);
+    return Response.json(scenarioStates);
+  }
+  return Response.json({ message: "not found" }, { status: 404 });
+};
+
+// Response templating. Keep in sync with internal/mockspec/template.go, which
+// validates the same syntax before the server starts
+interface TemplateData {
+  method: string;
+  path: string;
+  params: Record<string, string>;
+  query: URLSearchParams;
+  headers: Headers;
+  body: string;
+}
+
+const FAKER: Record<string, string[]> = {
+  firstName: ["Ada", "Alan", "Grace", "Linus", "Margaret", "Ken", "Barbara", "Dennis"],
+  lastName: ["Lovelace", "Turing", "Hopper", "Torvalds", "Hamilton", "Thompson", "Liskov", "Ritchie"],
+  city: ["Lisbon", "Nairobi", "Osaka", "Toronto", "Berlin", "Lima", "Oslo", "Austin"],
+  country: ["Portugal", "Kenya", "Japan", "Canada", "Germany", "Peru", "Norway", "USA"],
+  company: ["Acme", "Initech", "Globex", "Umbrella", "Hooli", "Stark Industries"],
+  word: ["alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel"],
+};
+
+const pick = (values: string[]) =>
+  values[Math.floor(Math.random() * values.length)];
+
+const fake = (kind: string): string => {
+  switch (kind) {
+    case "fullName":
+      return `${fake("firstName")} ${fake("lastName")}`;
+    case "email":
+      return `${fake("firstName")}.${fake("lastName")}@example.com`.toLowerCase();
+  }
+  return FAKER[kind] ? pick(FAKER[kind]) : "";
+};
+
+const lookupBody = (body: string, fields: string[]): string => {
+  let value: any;
+  try {
+    value = JSON.parse(body);
+  } catch {
+    return "";
+  }
+  for (const field of fields) {
+    if (value === null || typeof value !== "object") return "";
+    value = value[field];
+  }
+  if (value === undefined || value === null) return "";
+  return typeof value === "string" ? value : JSON.stringify(value);
+};
+
+const evalExpression = (expr: string, data: TemplateData): string => {
+  const [name, ...args] = (expr.match(/"[^"]*"|\S+/g) || []).map((a) =>
+    a.replace(/^"|"$/g, "")
+  );
+  switch (name) {
+    case "request.method":
+      return data.method;
+    case "request.path":
+      return data.path;
+    case "request.body":
+      return data.body;
+    case "uuid":
+      return crypto.randomUUID();
+    case "now":
+      if (args[0] === "unix") return `${Math.floor(Date.now() / 1000)}`;
+      if (args[0] === "unixMillis") return `${Date.now()}`;
+      return new Date().toISOString().replace(/\.\d{3}Z$/, "Z");
+    case "randomInt": {
+      const min = parseInt(args[0]);
+      const max = parseInt(args[1]);
+      return `${min + Math.floor(Math.random() * (max - min + 1))}`;
+    }
+  }
+  if (name.startsWith("request.params.")) {
+    return data.params[name.slice("request.params.".length)] || "";
+  }
+  if (name.startsWith("request.query.")) {
+    return data.query.get(name.slice("request.query.".length)) || "";
+  }
+  if (name.startsWith("request.headers.")) {
+    return data.headers.get(name.slice("request.headers.".length)) || "";
+  }
+  if (name.startsWith("request.body.")) {
+    return lookupBody(data.body, name.slice("request.body.".length).split("."));
+  }
+  if (name.startsWith("faker.")) {
+    return fake(name.slice("faker.".length));
+  }
+  logger.warn(`Unknown template expression ${name}`);
+  return "";
+};
+
+const renderTemplate = (template: string, data: TemplateData): string =>
+  template.replace(/{{(.*?)}}/g, (_, expr: string) =>
+    evalExpression(expr.trim(), data)
+  );
+
+// renderJsonStrings renders the string values of a JSON document. Keys, their
+// order and numbers are kept as written, like walkJSONStrings in mockspec
+const renderJsonStrings = (raw: string, data: TemplateData): string =>
+  raw.replace(/"(?:[^"\\]|\\.)*"(\s*:)?/g, (str: string, key?: string) =>
+    key ? str : JSON.stringify(renderTemplate(JSON.parse(str), data))
+  );
+
+const renderValue = (value: any, data: TemplateData): any => {
+  if (typeof value === "string") return renderTemplate(value, data);
+  if (Array.isArray(value)) return value.map((v) => renderValue(v, data));
+  if (value !== null && typeof value === "object") {
+    const out: Record<string, any> = {};
+    for (const key in value) {
+      out[key] = renderValue(value[key], data);
+    }
+    return out;
+  }
+  return value;
+};
+
+const renderStaticMock = async (
+  req: Request,
+  mock: StaticMock,
+  params: Record<string, string>
+): Promise<StaticMock> => {
+  if (!mock.response.template) {
+    return mock;
+  }
+  const url = new URL(req.url);
+  const data: TemplateData = {
+    method: req.method.toUpperCase(),
+    path: url.pathname,
+    params,
+    query: url.searchParams,
+    headers: req.headers,
+    body: await req.clone().text(),
+  };
+  return {
+    ...mock,
+    response: {
+      ...mock.response,
+      headers: renderValue(mock.response.headers, data),
+      body: renderValue(mock.response.body, data),
+      rawBody:
+        mock.response.rawBody === undefined
+          ? undefined
+          : renderJsonStrings(mock.response.rawBody, data),
+      bodyText: renderValue(mock.response.bodyText, data),
+      events: renderValue(mock.response.events, data),
+    },
+  };
+};
+
 const toHeaders = (headers: Record<string, string[]>) => {
   const h = new Headers();
   for (const key in headers) {
@@ -246,6 +1178,134 @@ const toHeaders = (headers: Record<string, string[]>) => {
   return h;
 };
 
+// replayEvents sends the events of a stream at their recorded times
+const replayEvents = (events: MockEvent[]) => {
+  const encoder = new TextEncoder();
+  let cancelled = false;
+  return new ReadableStream<Uint8Array>({
+    async start(controller) {
+      const start = Date.now();
+      for (const event of events) {
+        const wait = event.at / streamSpeed - (Date.now() - start);
+        if (streamSpeed > 0 && wait > 0) await sleep(wait);
+        // the client went away
+        if (cancelled) return;
+        controller.enqueue(encoder.encode(event.data));
+      }
+      controller.close();
+    },
+    cancel() {
+      cancelled = true;
+    },
+  });
+};
+
+// serveWebSocket replays the conversation of a WebSocket mock and answers
+// client messages with its rules. Server messages are sent at their recorded
+// times after the client message they follow
+const serveWebSocket = (req: Request, mock: MockWebSocket): Response => {
+  if (req.headers.get("upgrade")?.toLowerCase() !== "websocket") {
+    return new Response("Upgrade Required", { status: 426 });
+  }
+  const { socket, response } = Deno.upgradeWebSocket(req);
+  const rules = (mock.rules || []).map((rule) => ({
+    match: new RegExp(rule.match || ""),
+    reply: rule.reply,
+  }));
+  // client messages the conversation has not waited for yet
+  let received = 0;
+  let closed = false;
+  let wake: ((open: boolean) => void) | null = null;
+  const nextClientMessage = (): Promise<boolean> => {
+    if (received > 0) {
+      received--;
+      return Promise.resolve(true);
+    }
+    if (closed) return Promise.resolve(false);
+    return new Promise((resolve) => (wake = resolve));
+  };
+
+  socket.onmessage = (e) => {
+    if (typeof e.data === "string") {
+      for (const rule of rules) {
+        if (rule.match.test(e.data)) socket.send(rule.reply);
+      }
+    }
+    if (wake) {
+      const w = wake;
+      wake = null;
+      w(true);
+    } else {
+      received++;
+    }
+  };
+  socket.onclose = () => {
+    closed = true;
+    wake?.(false);
+    wake = null;
+  };
+  socket.onopen = async () => {
+    let start = Date.now();
+    let startAt = 0;
+    for (const m of mock.messages || []) {
+      if (m.from === "client") {
+        if (!(await nextClientMessage())) return;
+        start = Date.now();
+        startAt = m.at;
+        continue;
+      }
+      const wait = (m.at - startAt) / streamSpeed - (Date.now() - start);
+      if (streamSpeed > 0 && wait > 0) await sleep(wait);
+      if (closed) return;
+      if (m.type === "close") {
+        try {
+          socket.close(m.code, m.data);
+        } catch {
+          // codes such as 1005 cannot be sent by the server
+          socket.close();
+        }
+        return;
+      }
+      socket.send(
+        m.type === "binary"
+          ? Uint8Array.from(atob(m.data || ""), (c) => c.charCodeAt(0))
+          : m.data || ""
+      );
+    }
+  };
+  return response;
+};
+
+// mockBody returns the body of a mock, streaming body files from disk
+const mockBody = async (
+  mock: StaticMock,
+  source: string
+): Promise<BodyInit> => {
+  if (mock.response.events) {
+    return replayEvents(mock.response.events);
+  }
+  if (mock.response.bodyFile) {
+    const file = await Deno.open(
+      posix.join(posix.dirname(source), mock.response.bodyFile)
+    );
+    return file.readable;
+  }
+  return (
+    mock.response.bodyText ??
+    mock.response.rawBody ??
+    JSON.stringify(mock.response.body)
+  );
+};
+
+// toMockHeaders drops the headers that describe the recorded body, mocks are
+// stored decoded and templates change their length
+const toMockHeaders = (headers: Record<string, string[]>) => {
+  const h = toHeaders(headers);
+  h.delete("content-encoding");
+  h.delete("content-length");
+  return h;
+};
+
 const executeUserFunction = async (
   req: Request,
   params: Record<string, string | undefined>,
@@ -281,39 +1341,87 @@ const main = async () => {
   const config = await readConfig();
   logger.debug("Config");
   logger.debug(config);
-  functionConfig = config.functions;
+  functionConfig = Object.fromEntries(
+    Object.entries((config.functions || {}) as FunctionConfig).filter(
+      ([, fn]) => !fn.disabled
+    )
+  );
+  sortFunctions();
+  initialScenarioStates = config.scenarios || {};
+  globalFaults = config.faults || null;
+  streamSpeed = config.server?.streamSpeed ?? 1;
+  graphqlPath = config.graphql?.path || "/graphql";
+  if (graphqlMockUrl) {
+    logger.info(`Auto-mocking GraphQL operations on ${graphqlPath}`);
+  }
+  resetScenarios();
 
   const radixTree = await buildRadixTree();
 
-  Deno.serve({
-    handler: async (req: Request) => {
-      console.error("Received a request", req.url);
-      // look for a match
-      // 1. look if we have a static mock stored in our radix tree
-      const staticMatch = await findStaticMatch(req, radixTree);
-      if (staticMatch) {
-        logger.debug(`Matched a static mock for ${req.url}`);
-      }
-      // 2. look if we have a function match
-      const [name, fn, params] = findFunctionMatch(req);
-      // if we don't have a function match and we don't have a static match return 404
-      if (!fn && !staticMatch) {
-        // todo account of content-type header
-        return new Response("Not Found", {
-          status: 404,
-          statusText: "not found",
-        });
+  const handler = async (
+    req: Request,
+    match: JournalMatch
+  ): Promise<Response> => {
+    console.error("Received a request", req.url);
+    // look for a match
+    // 1. look if we have a static mock stored in our radix tree
+    const found = await findStaticMatch(req, radixTree);
+    let staticMatch: StaticMock | null = null;
+    if (found) {
+      logger.debug(`Matched a static mock for ${req.url}`);
+      staticMatch = resolveScenario(found.mock, found.source);
+      staticMatch = await renderStaticMock(req, staticMatch, found.params);
+    }
+    // 2. look if we have a function match
+    const [name, fn, params] = findFunctionMatch(req);
+    // if we don't have a function match and we don't have a static match,
+    // auto-mock GraphQL operations or return 404
+    if (!fn && !staticMatch) {
+      if (graphqlMockUrl && new URL(req.url).pathname === graphqlPath) {
+        if (await parseGraphqlRequest(req)) {
+          match.type = "mock";
+          match.name = "graphql schema";
+          return await graphqlMock(req);
+        }
       }
-      // if we don't have a function match, simply return the static match
-      if (!fn && staticMatch) {
-        return new Response(JSON.stringify(staticMatch.response.body), {
-          status: staticMatch.response.status,
-          headers: new Headers(toHeaders(staticMatch.response.headers)),
-        });
+      // todo account of content-type header
+      return new Response("Not Found", {
+        status: 404,
+        statusText: "not found",
+      });
+    }
+    // serve the static match if there is no function match, or if the mock
+    // outranks the function. Otherwise the function receives the static match
+    const mockWins =
+      !fn ||
+      (found !== null &&
+        compareRoutes(found.rank, {
+          priority: fn.priority || 0,
+          pattern: fn.path.split("/"),
+          kind: "function",
+        }) < 0);
+    if (mockWins && found && staticMatch) {
+      match.type = "mock";
+      match.name = found.source;
+      const mock = staticMatch;
+      if (mock.websocket) {
+        return serveWebSocket(req, mock.websocket);
       }
+      return await applyFaults(
+        mock.faults,
+        async () =>
+          new Response(await mockBody(mock, found.source), {
+            status: mock.response.status,
+            headers: new Headers(toMockHeaders(mock.response.headers)),
+          })
+      );
+    }
 
-      // if we have a function match, execute the function
-      if (fn) {
+    // if we have a function match, execute the function
+    if (fn) {
+      match.type = "function";
+      match.name = name;
+      return await applyFaults(fn.faults || staticMatch?.faults, async () => {
         const module = await importUserModule(name, fn.entrypoint);
         return await executeUserFunction(
           req,
@@ -321,17 +1429,45 @@ const main = async () => {
           module.default,
           staticMatch
         );
+      });
+    }
+    if (staticMatch) {
+      return new Response(JSON.stringify(staticMatch.response), {
+        status: staticMatch.response.status,
+        headers: new Headers(toHeaders(staticMatch.response.headers)),
+      });
+    }
+    return new Response("Not Found", {
+      status: 404,
+      statusText: "not found",
+    });
+  };
+
+  Deno.serve({
+    handler: async (req: Request) => {
+      const url = new URL(req.url);
+      if (url.pathname.startsWith(`${ADMIN_PREFIX}/`)) {
+        return await handleAdmin(req, url, radixTree);
       }
-      if (staticMatch) {
-        return new Response(JSON.stringify(staticMatch.response), {
-          status: staticMatch.response.status,
-          headers: new Headers(toHeaders(staticMatch.response.headers)),
-        });
+      const match: JournalMatch = { type: "none" };
+      if (JOURNAL_SIZE === 0) {
+        return await handler(req, match);
       }
-      return new Response("Not Found", {
-        status: 404,
-        statusText: "not found",
+      const started = Date.now();
+      const body = await req.clone().text();
+      const res = await handler(req, match);
+      record({
+        time: new Date(started).toISOString(),
+        method: req.method.toUpperCase(),
+        path: url.pathname,
+        query: toMultiMap(url.searchParams),
+        headers: toMultiMap(req.headers),
+        body: body.slice(0, JOURNAL_MAX_BODY),
+        match,
+        status: res.status,
+        durationMs: Date.now() - started,
       });
+      return res;
     },
     onListen: () => {
       console.log(ASCIIART);
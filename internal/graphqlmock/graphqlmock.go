@@ -0,0 +1,292 @@
+// Package graphqlmock answers GraphQL operations with data generated from an
+// SDL schema. It is the only auto-mock engine: pmok serve runs it for the Deno
+// runtime and pmoktest serves it directly. Every field is set, lists have two
+// items, abstract types resolve to their possible type that sorts first by
+// name and introspection describes the schema
+package graphqlmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Values of the built in scalars. Custom scalars get the string value
+const (
+	MockInt     = 42
+	MockFloat   = 4.2
+	MockString  = "Hello World"
+	MockID      = "1"
+	MockBoolean = true
+)
+
+// listSize is the number of items of generated lists
+const listSize = 2
+
+// Schema generates responses for the operations of a GraphQL schema
+type Schema struct {
+	schema *ast.Schema
+}
+
+// LoadSchema parses the SDL file at p
+func LoadSchema(p string) (*Schema, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchema(p, string(b))
+}
+
+// ParseSchema parses an SDL schema, name is used in errors
+func ParseSchema(name, sdl string) (*Schema, error) {
+	s, err := gqlparser.LoadSchema(&ast.Source{Name: name, Input: sdl})
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{schema: s}, nil
+}
+
+// Response is the body of a GraphQL response
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []Error         `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error
+type Error struct {
+	Message string `json:"message"`
+}
+
+func errorResponse(format string, args ...any) Response {
+	return Response{Errors: []Error{{Message: fmt.Sprintf(format, args...)}}}
+}
+
+// Mock answers an operation with generated data, or with the errors of an
+// operation that does not validate against the schema
+func (s *Schema) Mock(g mockspec.GraphqlRequest) Response {
+	doc, errs := gqlparser.LoadQuery(s.schema, g.Query)
+	if len(errs) > 0 {
+		res := Response{}
+		for _, err := range errs {
+			res.Errors = append(res.Errors, Error{Message: err.Message})
+		}
+		return res
+	}
+	op := doc.Operations.ForName(g.OperationName)
+	if op == nil {
+		return errorResponse("unknown operation %q", g.OperationName)
+	}
+	var vars map[string]any
+	if len(g.Variables) > 0 {
+		if err := json.Unmarshal(g.Variables, &vars); err != nil {
+			return errorResponse("variables must be an object")
+		}
+	}
+
+	root := s.schema.Query
+	switch op.Operation {
+	case ast.Mutation:
+		root = s.schema.Mutation
+	case ast.Subscription:
+		root = s.schema.Subscription
+	}
+	if root == nil {
+		return errorResponse("the schema does not support %s operations", op.Operation)
+	}
+	m := &mocker{schema: s.schema, vars: vars}
+	data, err := json.Marshal(m.object(root, []ast.SelectionSet{op.SelectionSet}))
+	if err != nil {
+		return errorResponse("%s", err)
+	}
+	return Response{Data: data}
+}
+
+type mocker struct {
+	schema *ast.Schema
+	vars   map[string]any
+}
+
+// object is a JSON object keeping the order of the selection
+type object []member
+
+type member struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(m.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// object resolves the selections of an object type
+func (m *mocker) object(def *ast.Definition, sets []ast.SelectionSet) object {
+	var keys []string
+	fields := make(map[string][]*ast.Field)
+	for _, set := range sets {
+		m.collect(def, set, &keys, fields)
+	}
+	out := make(object, 0, len(keys))
+	for _, key := range keys {
+		f := fields[key]
+		var value any
+		switch f[0].Name {
+		case "__typename":
+			value = def.Name
+		case "__schema":
+			value = m.introspect(f[0].Definition.Type, selections(f), schemaValue{schema: m.schema})
+		case "__type":
+			name, _ := f[0].ArgumentMap(m.vars)["name"].(string)
+			if t := m.schema.Types[name]; t != nil {
+				value = m.introspect(f[0].Definition.Type, selections(f), typeValue{schema: m.schema, def: t})
+			}
+		default:
+			value = m.value(f[0].Definition.Type, selections(f))
+		}
+		out = append(out, member{key: key, value: value})
+	}
+	return out
+}
+
+// selections returns the selection sets of the fields sharing a response key
+func selections(fields []*ast.Field) []ast.SelectionSet {
+	var sets []ast.SelectionSet
+	for _, f := range fields {
+		sets = append(sets, f.SelectionSet)
+	}
+	return sets
+}
+
+// collect groups the fields of a selection set by response key, in the order
+// they are first selected, following the fragments that apply to def
+func (m *mocker) collect(def *ast.Definition, set ast.SelectionSet, keys *[]string, fields map[string][]*ast.Field) {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if !m.included(sel.Directives) {
+				continue
+			}
+			key := sel.Alias
+			if key == "" {
+				key = sel.Name
+			}
+			if _, ok := fields[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			fields[key] = append(fields[key], sel)
+		case *ast.InlineFragment:
+			if m.included(sel.Directives) && m.applies(def, sel.TypeCondition) {
+				m.collect(def, sel.SelectionSet, keys, fields)
+			}
+		case *ast.FragmentSpread:
+			if m.included(sel.Directives) && m.applies(def, sel.Definition.TypeCondition) {
+				m.collect(def, sel.Definition.SelectionSet, keys, fields)
+			}
+		}
+	}
+}
+
+// included evaluates the @skip and @include directives
+func (m *mocker) included(directives ast.DirectiveList) bool {
+	if d := directives.ForName("skip"); d != nil && d.ArgumentMap(m.vars)["if"] == true {
+		return false
+	}
+	if d := directives.ForName("include"); d != nil && d.ArgumentMap(m.vars)["if"] == false {
+		return false
+	}
+	return true
+}
+
+// applies reports whether a fragment on condition applies to def
+func (m *mocker) applies(def *ast.Definition, condition string) bool {
+	if condition == "" || condition == def.Name {
+		return true
+	}
+	for _, t := range m.schema.GetImplements(def) {
+		if t.Name == condition {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mocker) value(t *ast.Type, sets []ast.SelectionSet) any {
+	if t.Elem != nil {
+		list := make([]any, listSize)
+		for i := range list {
+			list[i] = m.value(t.Elem, sets)
+		}
+		return list
+	}
+	def := m.schema.Types[t.NamedType]
+	switch def.Kind {
+	case ast.Scalar:
+		switch def.Name {
+		case "Int":
+			return MockInt
+		case "Float":
+			return MockFloat
+		case "ID":
+			return MockID
+		case "Boolean":
+			return MockBoolean
+		}
+		return MockString
+	case ast.Enum:
+		return def.EnumValues[0].Name
+	case ast.Interface, ast.Union:
+		return m.object(m.resolve(def), sets)
+	}
+	return m.object(def, sets)
+}
+
+// resolve picks the possible type of an abstract type that sorts first
+func (m *mocker) resolve(def *ast.Definition) *ast.Definition {
+	types := append([]*ast.Definition(nil), m.schema.GetPossibleTypes(def)...)
+	if len(types) == 0 {
+		return def
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+	return types[0]
+}
+
+// ServeHTTP answers the GraphQL operation of a request with generated data
+func (s *Schema) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g, ok := mockspec.ParseGraphqlRequest(r, body)
+	if !ok {
+		http.Error(w, "not a GraphQL operation", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Mock(g))
+}
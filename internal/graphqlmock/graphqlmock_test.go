@@ -0,0 +1,184 @@
+package graphqlmock_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/graphqlmock"
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+const sdl = `
+type Query {
+  user(id: ID!): User
+  search(term: String!): [SearchResult!]!
+  node(id: ID!): Node
+}
+
+type Mutation {
+  rename(id: ID!, name: String!): User!
+}
+
+interface Node {
+  id: ID!
+}
+
+enum Role {
+  ADMIN
+  MEMBER
+}
+
+scalar Date
+
+type User implements Node {
+  id: ID!
+  name: String!
+  age: Int
+  score: Float
+  active: Boolean!
+  role: Role!
+  joined: Date
+  friends: [User!]!
+}
+
+type Post implements Node {
+  id: ID!
+  title: String!
+}
+
+union SearchResult = User | Post
+`
+
+func TestMock(t *testing.T) {
+	s, err := graphqlmock.ParseSchema("schema.graphql", sdl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name string
+		req  mockspec.GraphqlRequest
+		want string
+	}{
+		{
+			name: "scalars, enums and aliases",
+			req:  mockspec.GraphqlRequest{Query: `query GetUser { user(id: "7") { id name age score active role joined me: name } }`},
+			want: `{"data":{"user":{"id":"1","name":"Hello World","age":42,"score":4.2,"active":true,"role":"ADMIN","joined":"Hello World","me":"Hello World"}}}`,
+		},
+		{
+			name: "lists and merged fields",
+			req:  mockspec.GraphqlRequest{Query: `{ user(id: "1") { friends { id } friends { name } } }`},
+			want: `{"data":{"user":{"friends":[{"id":"1","name":"Hello World"},{"id":"1","name":"Hello World"}]}}}`,
+		},
+		{
+			name: "unions resolve to the first type by name",
+			req:  mockspec.GraphqlRequest{Query: `{ search(term: "x") { __typename ... on User { name } ... on Post { title } } }`},
+			want: `{"data":{"search":[{"__typename":"Post","title":"Hello World"},{"__typename":"Post","title":"Hello World"}]}}`,
+		},
+		{
+			name: "fragments on interfaces",
+			req:  mockspec.GraphqlRequest{Query: `query N { node(id: "1") { ...NodeID } } fragment NodeID on Node { id __typename }`},
+			want: `{"data":{"node":{"id":"1","__typename":"Post"}}}`,
+		},
+		{
+			name: "skip and include",
+			req: mockspec.GraphqlRequest{
+				Query:     `query Q($s: Boolean!) { user(id: "1") { id @skip(if: $s) name @include(if: false) age } }`,
+				Variables: json.RawMessage(`{"s": true}`),
+			},
+			want: `{"data":{"user":{"age":42}}}`,
+		},
+		{
+			name: "mutations and the operation name",
+			req: mockspec.GraphqlRequest{
+				Query:         `query A { user(id: "1") { id } } mutation B { rename(id: "1", name: "x") { name } }`,
+				OperationName: "B",
+			},
+			want: `{"data":{"rename":{"name":"Hello World"}}}`,
+		},
+		{
+			name: "schema introspection",
+			req:  mockspec.GraphqlRequest{Query: `{ __schema { queryType { name } mutationType { name } subscriptionType { name } } }`},
+			want: `{"data":{"__schema":{"queryType":{"name":"Query"},"mutationType":{"name":"Mutation"},"subscriptionType":null}}}`,
+		},
+		{
+			name: "type introspection",
+			req:  mockspec.GraphqlRequest{Query: `{ __type(name: "User") { kind name interfaces { name } fields { name type { kind name ofType { kind name } } } } }`},
+			want: `{"data":{"__type":{"kind":"OBJECT","name":"User","interfaces":[{"name":"Node"}],"fields":[` +
+				`{"name":"id","type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"SCALAR","name":"ID"}}},` +
+				`{"name":"name","type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"SCALAR","name":"String"}}},` +
+				`{"name":"age","type":{"kind":"SCALAR","name":"Int","ofType":null}},` +
+				`{"name":"score","type":{"kind":"SCALAR","name":"Float","ofType":null}},` +
+				`{"name":"active","type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"SCALAR","name":"Boolean"}}},` +
+				`{"name":"role","type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"ENUM","name":"Role"}}},` +
+				`{"name":"joined","type":{"kind":"SCALAR","name":"Date","ofType":null}},` +
+				`{"name":"friends","type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"LIST","name":null}}}]}}}`,
+		},
+		{
+			name: "enum values and possible types",
+			req:  mockspec.GraphqlRequest{Query: `{ role: __type(name: "Role") { enumValues { name isDeprecated } } result: __type(name: "SearchResult") { kind possibleTypes { name } } missing: __type(name: "Missing") { name } }`},
+			want: `{"data":{"role":{"enumValues":[{"name":"ADMIN","isDeprecated":false},{"name":"MEMBER","isDeprecated":false}]},"result":{"kind":"UNION","possibleTypes":[{"name":"User"},{"name":"Post"}]},"missing":null}}`,
+		},
+		{
+			name: "invalid operations",
+			req:  mockspec.GraphqlRequest{Query: `{ user(id: "1") { missing } }`},
+			want: `{"errors":[{"message":"Cannot query field \"missing\" on type \"User\"."}]}`,
+		},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(s.Mock(tt.req))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if string(b) != tt.want {
+			t.Fatalf("%s: expected %s, but got %s", tt.name, tt.want, b)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	s, err := graphqlmock.ParseSchema("schema.graphql", sdl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	post := func() (*http.Response, error) {
+		return http.Post(srv.URL, "application/json", strings.NewReader(`{"query":"{ user(id: \"1\") { id } }"}`))
+	}
+	get := func() (*http.Response, error) {
+		return http.Get(srv.URL + "?query=" + url.QueryEscape(`{ __type(name: "Role") { kind } }`))
+	}
+	notGraphql := func() (*http.Response, error) {
+		return http.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+	}
+	tests := []struct {
+		name   string
+		do     func() (*http.Response, error)
+		status int
+		want   string
+	}{
+		{name: "post", do: post, status: http.StatusOK, want: `{"data":{"user":{"id":"1"}}}`},
+		{name: "get", do: get, status: http.StatusOK, want: `{"data":{"__type":{"kind":"ENUM"}}}`},
+		{name: "not graphql", do: notGraphql, status: http.StatusBadRequest, want: "not a GraphQL operation"},
+	}
+	for _, tt := range tests {
+		res, err := tt.do()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		b, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Fatalf("%s: expected status %d, but got %d", tt.name, tt.status, res.StatusCode)
+		}
+		if got := strings.TrimSpace(string(b)); got != tt.want {
+			t.Fatalf("%s: expected %s, but got %s", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package graphqlmock
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// introspected is a value of an introspection type. It resolves the fields of
+// that type, lists are []introspected or []string
+type introspected interface {
+	field(name string, args map[string]any) any
+}
+
+// introspect resolves a value of the introspection type t
+func (m *mocker) introspect(t *ast.Type, sets []ast.SelectionSet, v any) any {
+	switch v := v.(type) {
+	case []introspected:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = m.introspect(t.Elem, sets, item)
+		}
+		return list
+	case introspected:
+		def := m.schema.Types[t.Name()]
+		var keys []string
+		fields := make(map[string][]*ast.Field)
+		for _, set := range sets {
+			m.collect(def, set, &keys, fields)
+		}
+		out := make(object, 0, len(keys))
+		for _, key := range keys {
+			f := fields[key]
+			var value any
+			if f[0].Name == "__typename" {
+				value = def.Name
+			} else {
+				value = m.introspect(f[0].Definition.Type, selections(f), v.field(f[0].Name, f[0].ArgumentMap(m.vars)))
+			}
+			out = append(out, member{key: key, value: value})
+		}
+		return out
+	}
+	return v
+}
+
+// optional is null for empty strings
+func optional(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// deprecation returns whether directives deprecate a definition, and why
+func deprecation(directives ast.DirectiveList) (bool, any) {
+	d := directives.ForName("deprecated")
+	if d == nil {
+		return false, nil
+	}
+	if arg := d.Arguments.ForName("reason"); arg != nil && arg.Value != nil {
+		return true, arg.Value.Raw
+	}
+	return true, "No longer supported"
+}
+
+// includeDeprecated reports whether a definition is listed, deprecated ones
+// only when the includeDeprecated argument is set
+func includeDeprecated(args map[string]any, directives ast.DirectiveList) bool {
+	deprecated, _ := deprecation(directives)
+	return !deprecated || args["includeDeprecated"] == true
+}
+
+type schemaValue struct {
+	schema *ast.Schema
+}
+
+func (s schemaValue) named(def *ast.Definition) introspected {
+	if def == nil {
+		return nil
+	}
+	return typeValue{schema: s.schema, def: def}
+}
+
+func (s schemaValue) field(name string, args map[string]any) any {
+	switch name {
+	case "description":
+		return optional(s.schema.Description)
+	case "types":
+		names := make([]string, 0, len(s.schema.Types))
+		for name := range s.schema.Types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		types := make([]introspected, len(names))
+		for i, name := range names {
+			types[i] = s.named(s.schema.Types[name])
+		}
+		return types
+	case "queryType":
+		return s.named(s.schema.Query)
+	case "mutationType":
+		if s.schema.Mutation == nil {
+			return nil
+		}
+		return s.named(s.schema.Mutation)
+	case "subscriptionType":
+		if s.schema.Subscription == nil {
+			return nil
+		}
+		return s.named(s.schema.Subscription)
+	case "directives":
+		names := make([]string, 0, len(s.schema.Directives))
+		for name := range s.schema.Directives {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		directives := make([]introspected, len(names))
+		for i, name := range names {
+			directives[i] = directiveValue{schema: s.schema, def: s.schema.Directives[name]}
+		}
+		return directives
+	}
+	return nil
+}
+
+// typeRef is a type as it is used by a field or an argument, it wraps a named
+// type in lists and non nulls
+type typeRef struct {
+	schema *ast.Schema
+	t      *ast.Type
+}
+
+func (r typeRef) field(name string, args map[string]any) any {
+	switch {
+	case r.t.NonNull:
+		inner := *r.t
+		inner.NonNull = false
+		return wrapperField(name, "NON_NULL", typeRef{schema: r.schema, t: &inner})
+	case r.t.Elem != nil:
+		return wrapperField(name, "LIST", typeRef{schema: r.schema, t: r.t.Elem})
+	}
+	return typeValue{schema: r.schema, def: r.schema.Types[r.t.NamedType]}.field(name, args)
+}
+
+func wrapperField(name, kind string, ofType introspected) any {
+	switch name {
+	case "kind":
+		return kind
+	case "ofType":
+		return ofType
+	}
+	return nil
+}
+
+type typeValue struct {
+	schema *ast.Schema
+	def    *ast.Definition
+}
+
+var kinds = map[ast.DefinitionKind]string{
+	ast.Scalar:      "SCALAR",
+	ast.Object:      "OBJECT",
+	ast.Interface:   "INTERFACE",
+	ast.Union:       "UNION",
+	ast.Enum:        "ENUM",
+	ast.InputObject: "INPUT_OBJECT",
+}
+
+func (t typeValue) field(name string, args map[string]any) any {
+	def := t.def
+	switch name {
+	case "kind":
+		return kinds[def.Kind]
+	case "name":
+		return def.Name
+	case "description":
+		return optional(def.Description)
+	case "specifiedByURL":
+		if d := def.Directives.ForName("specifiedBy"); d != nil {
+			if arg := d.Arguments.ForName("url"); arg != nil && arg.Value != nil {
+				return arg.Value.Raw
+			}
+		}
+		return nil
+	case "fields":
+		if def.Kind != ast.Object && def.Kind != ast.Interface {
+			return nil
+		}
+		fields := []introspected{}
+		for _, f := range def.Fields {
+			if !strings.HasPrefix(f.Name, "__") && includeDeprecated(args, f.Directives) {
+				fields = append(fields, fieldValue{schema: t.schema, def: f})
+			}
+		}
+		return fields
+	case "interfaces":
+		if def.Kind != ast.Object && def.Kind != ast.Interface {
+			return nil
+		}
+		interfaces := []introspected{}
+		for _, name := range def.Interfaces {
+			interfaces = append(interfaces, typeValue{schema: t.schema, def: t.schema.Types[name]})
+		}
+		return interfaces
+	case "possibleTypes":
+		if !def.IsAbstractType() {
+			return nil
+		}
+		types := []introspected{}
+		for _, p := range t.schema.GetPossibleTypes(def) {
+			types = append(types, typeValue{schema: t.schema, def: p})
+		}
+		return types
+	case "enumValues":
+		if def.Kind != ast.Enum {
+			return nil
+		}
+		values := []introspected{}
+		for _, v := range def.EnumValues {
+			if includeDeprecated(args, v.Directives) {
+				values = append(values, enumValue{def: v})
+			}
+		}
+		return values
+	case "inputFields":
+		if def.Kind != ast.InputObject {
+			return nil
+		}
+		fields := []introspected{}
+		for _, f := range def.Fields {
+			if includeDeprecated(args, f.Directives) {
+				fields = append(fields, inputValue{schema: t.schema, name: f.Name, description: f.Description, t: f.Type, defaultValue: f.DefaultValue, directives: f.Directives})
+			}
+		}
+		return fields
+	case "isOneOf":
+		if def.Kind != ast.InputObject {
+			return nil
+		}
+		return def.Directives.ForName("oneOf") != nil
+	}
+	return nil
+}
+
+type fieldValue struct {
+	schema *ast.Schema
+	def    *ast.FieldDefinition
+}
+
+func (f fieldValue) field(name string, args map[string]any) any {
+	switch name {
+	case "name":
+		return f.def.Name
+	case "description":
+		return optional(f.def.Description)
+	case "args":
+		return arguments(f.schema, f.def.Arguments, args)
+	case "type":
+		return typeRef{schema: f.schema, t: f.def.Type}
+	case "isDeprecated":
+		deprecated, _ := deprecation(f.def.Directives)
+		return deprecated
+	case "deprecationReason":
+		_, reason := deprecation(f.def.Directives)
+		return reason
+	}
+	return nil
+}
+
+func arguments(schema *ast.Schema, defs ast.ArgumentDefinitionList, args map[string]any) []introspected {
+	values := []introspected{}
+	for _, a := range defs {
+		if includeDeprecated(args, a.Directives) {
+			values = append(values, inputValue{schema: schema, name: a.Name, description: a.Description, t: a.Type, defaultValue: a.DefaultValue, directives: a.Directives})
+		}
+	}
+	return values
+}
+
+// inputValue is an argument or the field of an input object
+type inputValue struct {
+	schema       *ast.Schema
+	name         string
+	description  string
+	t            *ast.Type
+	defaultValue *ast.Value
+	directives   ast.DirectiveList
+}
+
+func (v inputValue) field(name string, args map[string]any) any {
+	switch name {
+	case "name":
+		return v.name
+	case "description":
+		return optional(v.description)
+	case "type":
+		return typeRef{schema: v.schema, t: v.t}
+	case "defaultValue":
+		if v.defaultValue == nil {
+			return nil
+		}
+		return v.defaultValue.String()
+	case "isDeprecated":
+		deprecated, _ := deprecation(v.directives)
+		return deprecated
+	case "deprecationReason":
+		_, reason := deprecation(v.directives)
+		return reason
+	}
+	return nil
+}
+
+type enumValue struct {
+	def *ast.EnumValueDefinition
+}
+
+func (v enumValue) field(name string, args map[string]any) any {
+	switch name {
+	case "name":
+		return v.def.Name
+	case "description":
+		return optional(v.def.Description)
+	case "isDeprecated":
+		deprecated, _ := deprecation(v.def.Directives)
+		return deprecated
+	case "deprecationReason":
+		_, reason := deprecation(v.def.Directives)
+		return reason
+	}
+	return nil
+}
+
+type directiveValue struct {
+	schema *ast.Schema
+	def    *ast.DirectiveDefinition
+}
+
+func (d directiveValue) field(name string, args map[string]any) any {
+	switch name {
+	case "name":
+		return d.def.Name
+	case "description":
+		return optional(d.def.Description)
+	case "isRepeatable":
+		return d.def.IsRepeatable
+	case "locations":
+		locations := make([]string, len(d.def.Locations))
+		for i, l := range d.def.Locations {
+			locations[i] = string(l)
+		}
+		return locations
+	case "args":
+		return arguments(d.schema, d.def.Arguments, args)
+	}
+	return nil
+}
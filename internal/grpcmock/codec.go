@@ -0,0 +1,146 @@
+package grpcmock
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ContentType is the content type of gRPC requests and responses
+const ContentType = "application/grpc"
+
+// gRPC status codes used by the mock server
+const (
+	CodeOK            = 0
+	CodeInternal      = 13
+	CodeUnimplemented = 12
+)
+
+// maxMessageSize caps the length prefix of a message, the default of gRPC
+const maxMessageSize = 4 << 20
+
+// IsGrpc reports whether a content type is gRPC, including its subtypes like
+// application/grpc+proto. gRPC-Web is not included
+func IsGrpc(contentType string) bool {
+	return contentType == ContentType || strings.HasPrefix(contentType, ContentType+"+") ||
+		strings.HasPrefix(contentType, ContentType+";")
+}
+
+// ReadMessages reads length-prefixed messages until r ends. Compressed
+// messages are decoded with encoding, the grpc-encoding of the stream
+func ReadMessages(r io.Reader, encoding string) ([][]byte, error) {
+	var msgs [][]byte
+	var prefix [5]byte
+	for {
+		if _, err := io.ReadFull(r, prefix[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return msgs, nil
+			}
+			return nil, err
+		}
+		n := binary.BigEndian.Uint32(prefix[1:])
+		if n > maxMessageSize {
+			return nil, fmt.Errorf("grpc: message of %d bytes is too large", n)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		if prefix[0] == 1 {
+			d, err := mockspec.NewDecoder(encoding, bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			if b, err = io.ReadAll(d); err != nil {
+				return nil, err
+			}
+		}
+		msgs = append(msgs, b)
+	}
+}
+
+// WriteMessage writes an uncompressed length-prefixed message
+func WriteMessage(w io.Writer, b []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(b)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// Encode transcodes a JSON message to protobuf
+func Encode(md protoreflect.MessageDescriptor, msg json.RawMessage) ([]byte, error) {
+	m := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal(msg, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", md.FullName(), err)
+	}
+	return proto.Marshal(m)
+}
+
+// Decode transcodes a protobuf message to JSON
+func Decode(md protoreflect.MessageDescriptor, b []byte) (json.RawMessage, error) {
+	m := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", md.FullName(), err)
+	}
+	js, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	// protojson varies its whitespace on purpose, compact it so recordings
+	// are stable
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, js); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Template returns a JSON message with every field of md set to its default
+func Template(md protoreflect.MessageDescriptor) (json.RawMessage, error) {
+	js, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(dynamicpb.NewMessage(md))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, js); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeStatusMessage percent-encodes a grpc-message trailer
+func EncodeStatusMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// DecodeStatusMessage decodes a grpc-message trailer
+func DecodeStatusMessage(msg string) string {
+	s, err := url.PathUnescape(msg)
+	if err != nil {
+		return msg
+	}
+	return s
+}
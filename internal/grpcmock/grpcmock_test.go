@@ -0,0 +1,291 @@
+package grpcmock_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/grpcmock"
+	"github.com/protomoks/pmok/internal/mockserver"
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/protomoks/pmok/internal/testutil"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const greeter = `syntax = "proto3";
+package helloworld;
+
+import "google/protobuf/timestamp.proto";
+
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+  rpc StreamHellos (HelloRequest) returns (stream HelloReply);
+}
+
+message HelloRequest {
+  string name = 1;
+}
+
+message HelloReply {
+  string message = 1;
+  int32 count = 2;
+  google.protobuf.Timestamp at = 3;
+}
+`
+
+func loadRegistry(t *testing.T) *grpcmock.Registry {
+	t.Helper()
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{"protos/greeter.proto": greeter})
+	reg, err := grpcmock.Load(dir, &config.GrpcConfig{
+		Services: map[string]config.GrpcService{"helloworld.Greeter": {Proto: "protos/greeter.proto"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return reg
+}
+
+func TestLoad(t *testing.T) {
+	reg := loadRegistry(t)
+	if reg.Len() != 2 {
+		t.Fatalf("expected 2 methods, but got %d", reg.Len())
+	}
+	md, ok := reg.Method("/helloworld.Greeter/StreamHellos")
+	if !ok || !md.IsStreamingServer() {
+		t.Fatalf("expected the server streaming method StreamHellos")
+	}
+
+	_, err := grpcmock.Load(t.TempDir(), &config.GrpcConfig{
+		Services: map[string]config.GrpcService{"helloworld.Greeter": {Proto: "missing.proto"}},
+	})
+	if err == nil {
+		t.Fatalf("expected an error for a missing proto")
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	reg := loadRegistry(t)
+	md, _ := reg.Method("/helloworld.Greeter/SayHello")
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: `{"message":"hi","count":2}`, want: `{"message":"hi","count":2}`},
+		{in: `{"at":"2025-01-01T00:00:00Z"}`, want: `{"at":"2025-01-01T00:00:00Z"}`},
+		{in: `{}`, want: `{}`},
+		{in: `{"unknown":1}`, err: true},
+		{in: `{"count":"x"}`, err: true},
+	}
+	for _, tt := range tests {
+		b, err := grpcmock.Encode(md.Output(), json.RawMessage(tt.in))
+		if tt.err {
+			if err == nil {
+				t.Fatalf("expected an error for %s", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, err := grpcmock.Decode(md.Output(), b)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(got) != tt.want {
+			t.Fatalf("expected %s, but got %s", tt.want, got)
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	var buf bytes.Buffer
+	for _, msg := range []string{"a", "", "bc"} {
+		if err := grpcmock.WriteMessage(&buf, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs, err := grpcmock.ReadMessages(&buf, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(msgs) != 3 || string(msgs[0]) != "a" || len(msgs[1]) != 0 || string(msgs[2]) != "bc" {
+		t.Fatalf("expected 3 messages, but got %q", msgs)
+	}
+	if _, err := grpcmock.ReadMessages(bytes.NewReader([]byte{0, 0, 0, 0, 5, 'a'}), ""); err == nil {
+		t.Fatalf("expected an error for a truncated message")
+	}
+}
+
+func TestStatusMessage(t *testing.T) {
+	for _, msg := range []string{"not found", "100% done", "línea\nnueva"} {
+		enc := grpcmock.EncodeStatusMessage(msg)
+		if got := grpcmock.DecodeStatusMessage(enc); got != msg {
+			t.Fatalf("expected %q, but got %q from %q", msg, got, enc)
+		}
+	}
+}
+
+// h2cClient speaks HTTP/2 without TLS, as gRPC clients do
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+func call(t *testing.T, client *http.Client, base, path string) (*http.Response, [][]byte) {
+	t.Helper()
+	var body bytes.Buffer
+	grpcmock.WriteMessage(&body, nil)
+	req, _ := http.NewRequest(http.MethodPost, base+path, &body)
+	req.Header.Set("Content-Type", grpcmock.ContentType)
+	req.Header.Set("Te", "trailers")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	msgs, err := grpcmock.ReadMessages(res.Body, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return res, msgs
+}
+
+func TestServe(t *testing.T) {
+	reg := loadRegistry(t)
+	h, err := mockserver.Load(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetRegistry(reg)
+	h.Add("unary", mockspec.Spec{
+		Request:  mockspec.SpecRequest{Method: "POST", RequestPath: "/helloworld.Greeter/SayHello"},
+		Response: mockspec.SpecBodyResponse{SpecResponse: mockspec.SpecResponse{Headers: http.Header{"X-Mock": []string{"1"}}}},
+		Grpc: &mockspec.SpecGrpc{Messages: []json.RawMessage{
+			json.RawMessage(`{"message":"hello"}`),
+			json.RawMessage(`{"message":"ignored"}`),
+		}},
+	})
+	h.Add("stream", mockspec.Spec{
+		Request: mockspec.SpecRequest{Method: "POST", RequestPath: "/helloworld.Greeter/StreamHellos"},
+		Grpc: &mockspec.SpecGrpc{
+			Messages: []json.RawMessage{json.RawMessage(`{"count":1}`), json.RawMessage(`{"count":2}`)},
+			Code:     5,
+			Message:  "no more hellos",
+		},
+	})
+	server := httptest.NewServer(h2c.NewHandler(h, &http2.Server{}))
+	defer server.Close()
+	client := h2cClient()
+	md, _ := reg.Method("/helloworld.Greeter/SayHello")
+
+	tests := []struct {
+		path    string
+		want    []string
+		status  string
+		message string
+	}{
+		{path: "/helloworld.Greeter/SayHello", want: []string{`{"message":"hello"}`}, status: "0"},
+		{path: "/helloworld.Greeter/StreamHellos", want: []string{`{"count":1}`, `{"count":2}`}, status: "5", message: "no more hellos"},
+		{path: "/helloworld.Greeter/Missing", status: "12", message: "method /helloworld.Greeter/Missing is not mocked"},
+	}
+	for _, tt := range tests {
+		res, msgs := call(t, client, server.URL, tt.path)
+		if ct := res.Header.Get("Content-Type"); ct != grpcmock.ContentType {
+			t.Fatalf("expected content type %s, but got %s", grpcmock.ContentType, ct)
+		}
+		if tt.status == "0" && res.Header.Get("X-Mock") != "1" {
+			t.Fatalf("expected the headers of the spec, but got %v", res.Header)
+		}
+		if len(msgs) != len(tt.want) {
+			t.Fatalf("%s: expected %d messages, but got %d", tt.path, len(tt.want), len(msgs))
+		}
+		for i, b := range msgs {
+			got, err := grpcmock.Decode(md.Output(), b)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want[i] {
+				t.Fatalf("%s: expected %s, but got %s", tt.path, tt.want[i], got)
+			}
+		}
+		if got := res.Trailer.Get("Grpc-Status"); got != tt.status {
+			t.Fatalf("%s: expected status %s, but got %q", tt.path, tt.status, got)
+		}
+		if got := grpcmock.DecodeStatusMessage(res.Trailer.Get("Grpc-Message")); got != tt.message {
+			t.Fatalf("%s: expected message %q, but got %q", tt.path, tt.message, got)
+		}
+	}
+}
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+func TestWriter(t *testing.T) {
+	reg := loadRegistry(t)
+	md, _ := reg.Method("/helloworld.Greeter/StreamHellos")
+	var body bytes.Buffer
+	for _, msg := range []string{`{"count":1}`, `{"message":"bye"}`} {
+		b, err := grpcmock.Encode(md.Output(), json.RawMessage(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		grpcmock.WriteMessage(&body, b)
+	}
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{grpcmock.ContentType}, "X-Request-Id": []string{"1"}},
+		Trailer:    http.Header{"Grpc-Status": []string{"9"}, "Grpc-Message": []string{"failed%20precondition"}},
+		Body:       io.NopCloser(&body),
+		Request:    &http.Request{URL: &url.URL{Path: "/helloworld.Greeter/StreamHellos"}},
+	}
+	var out buffer
+	w := grpcmock.NewWriter(&out, md)
+	if err := w.WriteResponse(res); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, err := mockspec.Load(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("expected a valid spec, but got %v", err)
+	}
+	if s.Request.Method != "POST" || s.Request.RequestPath != "/helloworld.Greeter/StreamHellos" {
+		t.Fatalf("expected POST /helloworld.Greeter/StreamHellos, but got %+v", s.Request)
+	}
+	if s.Grpc == nil || len(s.Grpc.Messages) != 2 {
+		t.Fatalf("expected 2 messages, but got %+v", s.Grpc)
+	}
+	var got bytes.Buffer
+	json.Compact(&got, s.Grpc.Messages[1])
+	if got.String() != `{"message":"bye"}` {
+		t.Fatalf("expected {\"message\":\"bye\"}, but got %s", got.String())
+	}
+	if s.Grpc.Code != 9 || s.Grpc.Message != "failed precondition" {
+		t.Fatalf("expected status 9 failed precondition, but got %d %s", s.Grpc.Code, s.Grpc.Message)
+	}
+	if s.Response.Headers.Get("Content-Type") != "" || s.Response.Headers.Get("X-Request-Id") != "1" {
+		t.Fatalf("expected only the custom headers, but got %v", s.Response.Headers)
+	}
+}
@@ -0,0 +1,150 @@
+// Package grpcmock mocks gRPC services described by .proto files. Messages
+// are kept as JSON in the mock specs and transcoded to protobuf with
+// descriptors parsed from the protos of the manifest
+package grpcmock
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/mockspec"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Registry resolves gRPC method paths, /package.Service/Method, to their
+// descriptors
+type Registry struct {
+	methods map[string]protoreflect.MethodDescriptor
+}
+
+// Compile parses protos, relative to dir, and their imports. Imports are
+// searched in the directory of each proto and in importPaths, relative to dir
+func Compile(dir string, importPaths []string, protos ...string) ([]protoreflect.FileDescriptor, error) {
+	var paths []string
+	for _, p := range importPaths {
+		paths = append(paths, filepath.Join(dir, p))
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, proto := range protos {
+		name, importPath := sourceName(filepath.Join(dir, proto), paths)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+		paths = append(paths, importPath)
+	}
+
+	c := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: paths}),
+	}
+	files, err := c.Compile(context.Background(), names...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]protoreflect.FileDescriptor, len(files))
+	for i, f := range files {
+		res[i] = f
+	}
+	return res, nil
+}
+
+// sourceName returns the name a proto is compiled as, relative to the import
+// path containing it. Protos outside the import paths are named relative to
+// their own directory, so the imports of other protos resolve to the same file
+func sourceName(proto string, importPaths []string) (string, string) {
+	for _, p := range importPaths {
+		rel, err := filepath.Rel(p, proto)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel), p
+		}
+	}
+	return filepath.Base(proto), filepath.Dir(proto)
+}
+
+// Load compiles the protos of the services in conf, dir is the protomok
+// directory. Only the methods of the registered services are resolved
+func Load(dir string, conf *config.GrpcConfig) (*Registry, error) {
+	r := &Registry{methods: make(map[string]protoreflect.MethodDescriptor)}
+	if conf == nil || len(conf.Services) == 0 {
+		return r, nil
+	}
+	var protos []string
+	for _, svc := range conf.Services {
+		protos = append(protos, filepath.FromSlash(svc.Proto))
+	}
+	sort.Strings(protos)
+	files, err := Compile(dir, conf.ImportPaths, protos...)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	for _, f := range files {
+		for _, svc := range Services(f) {
+			if _, ok := conf.Services[string(svc.FullName())]; !ok {
+				continue
+			}
+			found[string(svc.FullName())] = true
+			r.Add(svc)
+		}
+	}
+	for name, svc := range conf.Services {
+		if !found[name] {
+			return nil, fmt.Errorf("service %s is not defined in %s", name, svc.Proto)
+		}
+	}
+	return r, nil
+}
+
+// Services returns the services defined in a file
+func Services(f protoreflect.FileDescriptor) []protoreflect.ServiceDescriptor {
+	services := make([]protoreflect.ServiceDescriptor, f.Services().Len())
+	for i := range services {
+		services[i] = f.Services().Get(i)
+	}
+	return services
+}
+
+// Add registers the methods of a service
+func (r *Registry) Add(svc protoreflect.ServiceDescriptor) {
+	for i := 0; i < svc.Methods().Len(); i++ {
+		md := svc.Methods().Get(i)
+		r.methods[MethodPath(md)] = md
+	}
+}
+
+// Method returns the descriptor of the method at path
+func (r *Registry) Method(path string) (protoreflect.MethodDescriptor, bool) {
+	if r == nil {
+		return nil, false
+	}
+	md, ok := r.methods[path]
+	return md, ok
+}
+
+// Len returns the number of registered methods
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.methods)
+}
+
+// MethodPath returns the HTTP/2 path of a method, /package.Service/Method
+func MethodPath(md protoreflect.MethodDescriptor) string {
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
+
+// MockFileName returns the path of the spec of the method at path, relative to
+// the mocks directory. pmok add grpc and pmok record both store gRPC specs
+// there, so a recording replaces the generated spec
+func MockFileName(path string) string {
+	return filepath.Join("grpc", strings.TrimPrefix(mockspec.MockFileNameFromPath(path), "_"))
+}
@@ -0,0 +1,116 @@
+package grpcmock
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type writer struct {
+	w       io.WriteCloser
+	md      protoreflect.MethodDescriptor
+	maxSize int64
+}
+
+// Option configures a writer
+type Option func(*writer)
+
+// WithMaxSize fails with mockspec.ErrBodyTooLarge on response bodies larger
+// than n bytes. 0 means no limit
+func WithMaxSize(n int64) Option {
+	return func(w *writer) {
+		w.maxSize = n
+	}
+}
+
+// NewWriter returns a writer for the responses of a gRPC method. The response
+// messages are stored as JSON and the status is read from the trailers, or
+// from the headers of trailers-only responses
+func NewWriter(w io.WriteCloser, md protoreflect.MethodDescriptor, opts ...Option) mockspec.MockWriter {
+	wr := &writer{w: w, md: md}
+	for _, opt := range opts {
+		opt(wr)
+	}
+	return wr
+}
+
+// limitReader fails with mockspec.ErrBodyTooLarge once more than n bytes
+// were read
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, mockspec.ErrBodyTooLarge
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+func (w *writer) WriteResponse(res *http.Response) error {
+	defer res.Body.Close()
+	var body io.Reader = res.Body
+	limit := &limitReader{r: res.Body, n: w.maxSize}
+	if w.maxSize > 0 {
+		body = limit
+	}
+	msgs, err := ReadMessages(body, res.Header.Get("Grpc-Encoding"))
+	if limit.n < 0 {
+		return mockspec.ErrBodyTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	g := &mockspec.SpecGrpc{}
+	for _, b := range msgs {
+		msg, err := Decode(w.md.Output(), b)
+		if err != nil {
+			return err
+		}
+		g.Messages = append(g.Messages, msg)
+	}
+
+	status := res.Trailer
+	if status.Get("Grpc-Status") == "" {
+		status = res.Header
+	}
+	if code := status.Get("Grpc-Status"); code != "" {
+		if g.Code, err = strconv.Atoi(code); err != nil {
+			return err
+		}
+	}
+	g.Message = DecodeStatusMessage(status.Get("Grpc-Message"))
+
+	// the status is replayed from the spec, the headers the mock server sets
+	// itself are left out
+	header := res.Header.Clone()
+	for _, name := range []string{"Content-Type", "Grpc-Status", "Grpc-Message", "Grpc-Encoding", "Grpc-Accept-Encoding", "Trailer"} {
+		header.Del(name)
+	}
+	spec := mockspec.Spec{
+		SpecVersion: mockspec.SpecVersion,
+		Request: mockspec.SpecRequest{
+			Method:      http.MethodPost,
+			RequestPath: MethodPath(w.md),
+		},
+		Grpc: g,
+	}
+	spec.Response.Status = http.StatusOK
+	spec.Response.Headers = header
+
+	enc := json.NewEncoder(w.w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(" ", " ")
+	return enc.Encode(spec)
+}
+
+func (w *writer) Close() error {
+	return w.w.Close()
+}
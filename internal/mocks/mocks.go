@@ -0,0 +1,183 @@
+// Package mocks finds, edits, removes and compares the specs stored in the
+// mocks directory of a project.
+package mocks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/protomoks/pmok/internal/utils"
+)
+
+// Dir returns the mocks directory of the project
+func Dir(conf *config.Config) string {
+	return filepath.Join(conf.GetProjectDir(), config.MocksDir)
+}
+
+// List returns every spec of the project. Specs that cannot be read are left
+// out and reported in the error, next to the specs that could be read
+func List(conf *config.Config) ([]mockspec.File, error) {
+	return mockspec.ReadDir(Dir(conf))
+}
+
+// ContentType returns the content type of the recorded response
+func ContentType(s mockspec.Spec) string {
+	return s.Response.Headers.Get("Content-Type")
+}
+
+// Find returns the spec a route refers to. A route is a file relative to the
+// mocks directory, with or without .json, a request path such as /users/:id
+// or a method and a path such as "POST /users"
+func Find(conf *config.Config, route string) (mockspec.File, error) {
+	// the route may refer to a readable spec even when others are broken
+	files, readErr := List(conf)
+	if readErr != nil && files == nil {
+		return mockspec.File{}, readErr
+	}
+	method, path := "", route
+	if i := strings.IndexByte(route, ' '); i > 0 {
+		method, path = strings.ToUpper(route[:i]), strings.TrimSpace(route[i+1:])
+	}
+
+	var matches []mockspec.File
+	for _, f := range files {
+		if f.Path == route || strings.TrimSuffix(f.Path, ".json") == route {
+			return f, nil
+		}
+		if f.Spec.Request.RequestPath != path {
+			continue
+		}
+		if method != "" && !strings.EqualFold(f.Spec.Request.Method, method) {
+			continue
+		}
+		matches = append(matches, f)
+	}
+	switch len(matches) {
+	case 0:
+		if readErr != nil {
+			return mockspec.File{}, fmt.Errorf("no mock found for %s, some mocks could not be read: %w", route, readErr)
+		}
+		return mockspec.File{}, fmt.Errorf("no mock found for %s", route)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = fmt.Sprintf("%s (%s %s)", m.Path, m.Spec.Request.Method, m.Spec.Request.RequestPath)
+	}
+	return mockspec.File{}, fmt.Errorf("%s matches several mocks, use one of the files: %s", route, strings.Join(names, ", "))
+}
+
+// Remove deletes the spec a route refers to, with its body files, and
+// returns its file
+func Remove(conf *config.Config, route string) (mockspec.File, error) {
+	f, err := Find(conf, route)
+	if err != nil {
+		return f, err
+	}
+	p := filepath.Join(Dir(conf), f.Path)
+	for _, r := range f.Spec.Responses() {
+		if r.BodyFile == "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(filepath.Dir(p), filepath.FromSlash(r.BodyFile))); err != nil && !os.IsNotExist(err) {
+			return f, err
+		}
+	}
+	return f, os.Remove(p)
+}
+
+// Validate checks edited spec content before it is saved
+func Validate(b []byte) error {
+	var s mockspec.Spec
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return err
+	}
+	if s.Request.Method == "" || !strings.HasPrefix(s.Request.RequestPath, "/") {
+		return fmt.Errorf("request needs a method and a path starting with /")
+	}
+	return s.Validate()
+}
+
+// Diff returns a unified diff of two specs. Both are indented the same way
+// first so that only content changes show up, numbers and key order are kept
+// as written
+func Diff(conf *config.Config, a, b mockspec.File) (string, error) {
+	var lines [2][]string
+	for i, f := range []mockspec.File{a, b} {
+		raw, err := os.ReadFile(filepath.Join(Dir(conf), f.Path))
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, bytes.TrimSpace(raw), "", "  "); err != nil {
+			return "", fmt.Errorf("%s: %w", f.Path, err)
+		}
+		lines[i] = difflib.SplitLines(out.String() + "\n")
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        lines[0],
+		B:        lines[1],
+		FromFile: a.Path,
+		ToFile:   b.Path,
+		Context:  3,
+	})
+}
+
+// Edit opens the spec in editor, e.g. "code --wait", and saves the result
+// when it is valid. On invalid content retry is asked whether to edit again.
+// It reports whether the spec changed
+func Edit(conf *config.Config, f mockspec.File, editor string, retry func(error) bool) (bool, error) {
+	p := filepath.Join(Dir(conf), f.Path)
+	original, err := os.ReadFile(p)
+	if err != nil {
+		return false, err
+	}
+	// edit a copy, the spec is only replaced by valid content
+	tmp, err := os.CreateTemp("", "pmok-*-"+filepath.Base(f.Path))
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(original)
+	tmp.Close()
+	if err != nil {
+		return false, err
+	}
+
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		return false, fmt.Errorf("no editor set, set $EDITOR")
+	}
+	for {
+		cmd := exec.Command(args[0], append(args[1:], tmp.Name())...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return false, fmt.Errorf("editor %s: %w", editor, err)
+		}
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return false, err
+		}
+		if bytes.Equal(edited, original) {
+			return false, nil
+		}
+		if err := Validate(edited); err != nil {
+			if retry(err) {
+				continue
+			}
+			return false, err
+		}
+		return true, utils.WriteFileAtomic(p, edited, 0644)
+	}
+}
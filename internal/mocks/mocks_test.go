@@ -0,0 +1,152 @@
+package mocks_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/mocks"
+	"github.com/protomoks/pmok/internal/testutil"
+)
+
+func newProject(t *testing.T) *config.Config {
+	t.Helper()
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml":                 "version: \"0.01\"\nproject:\n  name: test\nfunctions: {}\n",
+		"mocks/_users.json":         `{"request": {"method": "GET", "path": "/users"}, "response": {"status": 200, "headers": {"Content-Type": ["application/json"]}, "body": {"n": 1}}}`,
+		"mocks/v2/_users.json":      `{"request": {"method": "GET", "path": "/users"}, "response": {"status": 200, "headers": {}, "body": {"n": 2}}}`,
+		"mocks/_users_post.json":    `{"request": {"method": "POST", "path": "/users"}, "response": {"status": 201, "headers": {}, "body": {}}}`,
+		"mocks/_orders_:id.json":    `{"request": {"method": "GET", "path": "/orders/:id"}, "response": {"status": 200, "headers": {}, "body": {}}}`,
+		"mocks/_not_a_mock.txt":     "ignored",
+		"mocks/nested/_health.json": `{"request": {"method": "GET", "path": "/health"}, "response": {"status": 204, "headers": {}, "body": null}}`,
+	})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return conf
+}
+
+func TestFind(t *testing.T) {
+	conf := newProject(t)
+	tests := []struct {
+		route string
+		want  string
+		err   bool
+	}{
+		{route: "_orders_:id.json", want: "_orders_:id.json"},
+		{route: "nested/_health", want: "nested/_health.json"},
+		{route: "/orders/:id", want: "_orders_:id.json"},
+		{route: "post /users", want: "_users_post.json"},
+		{route: "GET /users", err: true},
+		{route: "/missing", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			f, err := mocks.Find(conf, tt.route)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, but got %s", f.Path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if f.Path != tt.want {
+				t.Fatalf("expected %s, but got %s", tt.want, f.Path)
+			}
+		})
+	}
+}
+
+func TestListKeepsReadableSpecs(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml":          "version: \"0.01\"\nproject:\n  name: test\nfunctions: {}\n",
+		"mocks/_users.json":  `{"request": {"method": "GET", "path": "/users"}, "response": {"status": 200, "headers": {}, "body": {}}}`,
+		"mocks/_broken.json": `{"request": `,
+	})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	files, err := mocks.List(conf)
+	if err == nil || !strings.Contains(err.Error(), "_broken.json") {
+		t.Fatalf("expected an error for _broken.json, but got %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "_users.json" {
+		t.Fatalf("expected _users.json to be listed, but got %v", files)
+	}
+	if f, err := mocks.Find(conf, "/users"); err != nil || f.Path != "_users.json" {
+		t.Fatalf("expected _users.json to be found, but got %s %v", f.Path, err)
+	}
+	if _, err := mocks.Find(conf, "/missing"); err == nil || !strings.Contains(err.Error(), "_broken.json") {
+		t.Fatalf("expected the read error when no mock is found, but got %v", err)
+	}
+}
+
+func TestDiffKeepsContent(t *testing.T) {
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml":    "version: \"0.01\"\nproject:\n  name: test\nfunctions: {}\n",
+		"mocks/a.json": `{"request": {"method": "GET", "path": "/a"}, "response": {"status": 200, "headers": {}, "body": {"z": 1, "id": 9007199254740993}}}`,
+		"mocks/b.json": `{"request": {"method": "GET", "path": "/a"}, "response": {"status": 200, "headers": {}, "body": {"z": 2, "id": 9007199254740993}}}`,
+	})
+	conf, err := config.ReadConfig(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a, _ := mocks.Find(conf, "a")
+	b, _ := mocks.Find(conf, "b")
+	diff, err := mocks.Diff(conf, a, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(diff, `-      "z": 1,`) || !strings.Contains(diff, `"id": 9007199254740993`) {
+		t.Fatalf("expected numbers and key order as written, but got\n%s", diff)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	conf := newProject(t)
+	a, _ := mocks.Find(conf, "_users")
+	b, _ := mocks.Find(conf, "v2/_users")
+	diff, err := mocks.Diff(conf, a, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(diff, `-      "n": 1`) || !strings.Contains(diff, `+      "n": 2`) {
+		t.Fatalf("expected the body change in the diff, but got\n%s", diff)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	conf := newProject(t)
+	f, _ := mocks.Find(conf, "_users")
+	editor := filepath.Join(t.TempDir(), "editor.sh")
+	script := "#!/bin/sh\nsed -i.bak 's/\"status\": 200/\"status\": 202/' \"$1\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := mocks.Edit(conf, f, editor, func(error) bool { return false })
+	if err != nil || !changed {
+		t.Fatalf("expected the mock to change, but got %v %v", changed, err)
+	}
+	f, _ = mocks.Find(conf, "_users")
+	if f.Spec.Response.Status != 202 {
+		t.Fatalf("expected status 202, but got %d", f.Spec.Response.Status)
+	}
+
+	// invalid edits are not saved
+	script = "#!/bin/sh\necho '{' > \"$1\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mocks.Edit(conf, f, editor, func(error) bool { return false }); err == nil {
+		t.Fatalf("expected invalid content to be rejected")
+	}
+	if f, _ = mocks.Find(conf, "_users"); f.Spec.Response.Status != 202 {
+		t.Fatalf("expected the mock to be unchanged, but got %d", f.Spec.Response.Status)
+	}
+}
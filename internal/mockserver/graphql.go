@@ -0,0 +1,47 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/protomoks/pmok/internal/graphqlmock"
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+// SetGraphql sets the GraphQL path, /graphql by default. Only requests to path
+// are GraphQL operations. Operations without a spec are answered with data
+// generated from schema, if not nil
+func (h *Handler) SetGraphql(path string, schema *graphqlmock.Schema) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.graphqlPath = path
+	h.graphql = schema
+}
+
+// parseGraphql returns the GraphQL operation of a request to the GraphQL path
+func (h *Handler) parseGraphql(r *http.Request, body []byte) *mockspec.GraphqlRequest {
+	h.mu.Lock()
+	path := h.graphqlPath
+	h.mu.Unlock()
+	if r.URL.Path != path {
+		return nil
+	}
+	if g, ok := mockspec.ParseGraphqlRequest(r, body); ok {
+		return &g
+	}
+	return nil
+}
+
+// serveGraphql auto-mocks an operation. It reports whether the request was
+// answered, which needs a schema
+func (h *Handler) serveGraphql(w http.ResponseWriter, g mockspec.GraphqlRequest) bool {
+	h.mu.Lock()
+	schema := h.graphql
+	h.mu.Unlock()
+	if schema == nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schema.Mock(g))
+	return true
+}
@@ -0,0 +1,78 @@
+package mockserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/protomoks/pmok/internal/grpcmock"
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+// SetRegistry sets the descriptors gRPC specs are transcoded with
+func (h *Handler) SetRegistry(reg *grpcmock.Registry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.grpc = reg
+}
+
+// serveGrpc answers a gRPC call with the messages, the status and the response
+// headers of a spec. gRPC needs HTTP/2, the handler is served with h2c for
+// plain text clients
+func (h *Handler) serveGrpc(w http.ResponseWriter, r *http.Request, s mockspec.Spec) {
+	h.mu.Lock()
+	reg := h.grpc
+	h.mu.Unlock()
+
+	// the reply follows the request messages, like a unary server would
+	_, _ = io.Copy(io.Discard, r.Body)
+
+	for name, values := range s.Response.Headers {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Content-Type", grpcmock.ContentType)
+	spec := s.Grpc
+	md, ok := reg.Method(r.URL.Path)
+	if !ok || spec == nil {
+		writeGrpcStatus(w, grpcmock.CodeUnimplemented, fmt.Sprintf("method %s is not mocked", r.URL.Path))
+		return
+	}
+
+	msgs := spec.Messages
+	if !md.IsStreamingServer() && len(msgs) > 1 {
+		msgs = msgs[:1]
+	}
+	// transcode every message first, so broken specs fail with a status
+	// instead of a partial stream
+	out := make([][]byte, 0, len(msgs))
+	for _, msg := range msgs {
+		b, err := grpcmock.Encode(md.Output(), msg)
+		if err != nil {
+			writeGrpcStatus(w, grpcmock.CodeInternal, err.Error())
+			return
+		}
+		out = append(out, b)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for _, b := range out {
+		if err := grpcmock.WriteMessage(w, b); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	writeGrpcStatus(w, spec.Code, spec.Message)
+}
+
+// writeGrpcStatus sets the status trailers, the headers of trailers-only
+// responses when nothing was written yet
+func writeGrpcStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcmock.EncodeStatusMessage(msg))
+	}
+}
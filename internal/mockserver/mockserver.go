@@ -0,0 +1,409 @@
+// Package mockserver serves static mock specs natively in Go. It mirrors the
+// static mock handling of the Deno runtime (templates, scenarios and faults)
+// without functions, which need the Deno runtime. Unlike Deno it resets the
+// connection itself for reset faults, and it truncates event streams by
+// sending half of their events.
+package mockserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/protomoks/pmok/internal/graphqlmock"
+	"github.com/protomoks/pmok/internal/grpcmock"
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/protomoks/pmok/internal/routing"
+	"github.com/protomoks/pmok/internal/utils/constants"
+)
+
+// Handler is an http.Handler serving the mock specs of a directory
+type Handler struct {
+	mu            sync.Mutex
+	routes        []route
+	initialStates map[string]string
+	states        map[string]string
+	calls         map[string]int
+	streamSpeed   float64
+	faults        *mockspec.Faults
+	faultsOff     bool
+	grpc          *grpcmock.Registry
+	graphqlPath   string
+	graphql       *graphqlmock.Schema
+}
+
+type route struct {
+	method   string
+	segments []string
+	source   string
+	spec     mockspec.Spec
+}
+
+func (r route) rank() routing.Route {
+	rank := routing.MockRoute(r.source, r.spec)
+	rank.Methods = []string{r.method}
+	return rank
+}
+
+// Load reads every mock spec stored under dir. scenarios selects the initial
+// state of each scenario, as in the scenarios section of the manifest
+func Load(dir string, scenarios map[string]string) (*Handler, error) {
+	h := &Handler{initialStates: scenarios, streamSpeed: 1, graphqlPath: constants.GraphqlDefaultPath}
+	h.ResetScenarios()
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		s, err := mockspec.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		h.Add(p, s)
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Add registers a spec, replacing any spec with the same source
+func (h *Handler) Add(source string, s mockspec.Spec) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := route{
+		method:   strings.ToUpper(s.Request.Method),
+		segments: strings.Split(s.Request.RequestPath, "/"),
+		source:   source,
+		spec:     s,
+	}
+	for i := range h.routes {
+		if h.routes[i].source == source {
+			h.routes[i] = r
+			h.sortRoutes()
+			return
+		}
+	}
+	h.routes = append(h.routes, r)
+	h.sortRoutes()
+}
+
+// SetStreamSpeed scales the timing of replayed event streams and WebSocket
+// conversations, 2 replays twice as fast and 0 without delays
+func (h *Handler) SetStreamSpeed(speed float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.streamSpeed = speed
+}
+
+// SetFaults sets the global faults of the manifest. They apply to every spec
+// without faults of its own
+func (h *Handler) SetFaults(f *mockspec.Faults) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.faults = f
+}
+
+// EnableFaults turns fault injection on or off, it is on by default
+func (h *Handler) EnableFaults(enabled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.faultsOff = !enabled
+}
+
+// faultsOf returns the faults of a spec, the global faults when it has none
+// and nil when fault injection is off
+func (h *Handler) faultsOf(s mockspec.Spec) *mockspec.Faults {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.faultsOff {
+		return nil
+	}
+	if s.Faults != nil {
+		return s.Faults
+	}
+	return h.faults
+}
+
+// Len returns the number of loaded specs
+func (h *Handler) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.routes)
+}
+
+// sortRoutes orders routes the way the Deno runtime tries them
+func (h *Handler) sortRoutes() {
+	sort.SliceStable(h.routes, func(i, j int) bool {
+		return routing.Compare(h.routes[i].rank(), h.routes[j].rank()) < 0
+	})
+}
+
+// ResetScenarios restores the initial scenario states and rewinds every
+// sequence
+func (h *Handler) ResetScenarios() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.states = make(map[string]string, len(h.initialStates))
+	for k, v := range h.initialStates {
+		h.states[k] = v
+	}
+	h.calls = make(map[string]int)
+}
+
+// SetScenarioState switches a scenario to another state and rewinds its
+// sequences
+func (h *Handler) SetScenarioState(name, state string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.states[name] = state
+	for key := range h.calls {
+		if strings.HasPrefix(key, name+":") {
+			delete(h.calls, key)
+		}
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if grpcmock.IsGrpc(r.Header.Get("Content-Type")) {
+		rt, _, _ := h.match(r.Method, r.URL.Path, nil)
+		h.serveGrpc(w, r, rt.spec)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gql := h.parseGraphql(r, body)
+	rt, params, ok := h.match(r.Method, r.URL.Path, gql)
+	if !ok {
+		if gql != nil && h.serveGraphql(w, *gql) {
+			return
+		}
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if rt.spec.WebSocket != nil {
+		h.serveWebSocket(w, r, *rt.spec.WebSocket)
+		return
+	}
+	res, err := h.next(rt).Render(mockspec.TemplateData{
+		Method:  strings.ToUpper(r.Method),
+		Path:    r.URL.Path,
+		Params:  params,
+		Query:   r.URL.Query(),
+		Headers: r.Header,
+		Body:    body,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	faults := h.faultsOf(rt.spec)
+	if faults != nil && injectFault(w, r, *faults) {
+		return
+	}
+	truncate := faults != nil && chance(faults.TruncateRate)
+
+	for name, values := range res.Headers {
+		// bodies are stored decoded and templates change them, the recorded
+		// encoding and length no longer apply
+		if strings.EqualFold(name, "Content-Length") || strings.EqualFold(name, "Content-Encoding") {
+			continue
+		}
+		w.Header()[name] = values
+	}
+	status := res.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if len(res.Events) > 0 {
+		if truncate {
+			events := res.Events[:len(res.Events)/2]
+			w.WriteHeader(status)
+			h.replay(w, r, events)
+			abort(w)
+		}
+		w.WriteHeader(status)
+		h.replay(w, r, res.Events)
+		return
+	}
+	out, err := res.Open(rt.source)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer out.Close()
+	if truncate {
+		b, err := io.ReadAll(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the client expects the whole body and gets half of it
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.WriteHeader(status)
+		w.Write(b[:len(b)/2])
+		abort(w)
+	}
+	w.WriteHeader(status)
+	io.Copy(w, out)
+}
+
+// replay sends the events of a stream at their recorded times, scaled by
+// the stream speed. It stops when the client goes away
+func (h *Handler) replay(w http.ResponseWriter, r *http.Request, events []mockspec.SpecEvent) {
+	h.mu.Lock()
+	speed := h.streamSpeed
+	h.mu.Unlock()
+	flusher, _ := w.(http.Flusher)
+	start := time.Now()
+	for _, e := range events {
+		if speed > 0 {
+			wait := time.Duration(float64(e.At)/speed*float64(time.Millisecond)) - time.Since(start)
+			if wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// match returns the first route for a request in routing order. Specs for a
+// GraphQL operation only match that operation
+func (h *Handler) match(method, p string, gql *mockspec.GraphqlRequest) (route, map[string]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	segments := strings.Split(p, "/")
+	for _, rt := range h.routes {
+		if rt.method != strings.ToUpper(method) {
+			continue
+		}
+		if g := rt.spec.Graphql; g != nil && (gql == nil || !g.Matches(*gql)) {
+			continue
+		}
+		if params, ok := matchSegments(rt.segments, segments); ok {
+			return rt, params, true
+		}
+	}
+	return route{}, nil, false
+}
+
+func matchSegments(pattern, segments []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, s := range pattern {
+		// like URLPattern for functions, * needs at least one more segment
+		if s == "*" {
+			return params, i < len(segments)
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if strings.HasPrefix(s, ":") {
+			params[s[1:]] = segments[i]
+			continue
+		}
+		if s != segments[i] {
+			return nil, false
+		}
+	}
+	return params, len(pattern) == len(segments)
+}
+
+// next returns the response for the route, advancing its scenario sequence
+func (h *Handler) next(rt route) mockspec.SpecBodyResponse {
+	sc := rt.spec.Scenario
+	if sc == nil {
+		return rt.spec.Response
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.states[sc.Name]
+	if !ok {
+		state = mockspec.DefaultScenarioState
+	}
+	seq, ok := sc.States[state]
+	if !ok || len(seq.Responses) == 0 {
+		return rt.spec.Response
+	}
+	key := sc.Name + ":" + state + ":" + rt.source
+	n := h.calls[key]
+	h.calls[key] = n + 1
+	return seq.Next(n)
+}
+
+// injectFault applies the faults that replace a response: latency, resets
+// and errors, in the order of the Deno runtime. Truncation is applied while
+// the body is written. It reports whether the response was already written,
+// or the client went away
+func injectFault(w http.ResponseWriter, r *http.Request, f mockspec.Faults) bool {
+	if l := f.Latency; l != nil {
+		ms := l.FixedMs
+		if l.MaxMs != 0 {
+			ms += l.MinMs
+			if l.MaxMs > l.MinMs {
+				ms += rand.Intn(l.MaxMs - l.MinMs)
+			}
+		}
+		select {
+		case <-time.After(time.Duration(ms) * time.Millisecond):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+	if chance(f.ResetRate) {
+		// nothing was written, the client gets no response at all
+		panic(http.ErrAbortHandler)
+	}
+	if chance(f.ErrorRate) {
+		status := f.ErrorStatus
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"message":"fault injected"}`))
+		return true
+	}
+	return false
+}
+
+// chance reports true for percentage percent of the calls
+func chance(percentage float64) bool {
+	return percentage > 0 && rand.Float64()*100 < percentage
+}
+
+// abort resets the connection, or the stream of HTTP/2 requests, once what
+// was written reached the client
+func abort(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,171 @@
+package mockserver_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/protomoks/pmok/internal/mockserver"
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+func spec(method, path, body string, faults *mockspec.Faults) mockspec.Spec {
+	return mockspec.Spec{
+		Request: mockspec.SpecRequest{Method: method, RequestPath: path},
+		Response: mockspec.SpecBodyResponse{
+			SpecResponse: mockspec.SpecResponse{Status: http.StatusOK, Headers: http.Header{"Content-Type": []string{"application/json"}}},
+			Body:         json.RawMessage(body),
+		},
+		Faults: faults,
+	}
+}
+
+func newHandler(t *testing.T, specs map[string]mockspec.Spec) (*mockserver.Handler, *httptest.Server) {
+	t.Helper()
+	h, err := mockserver.Load(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for source, s := range specs {
+		h.Add(source, s)
+	}
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return h, server
+}
+
+func TestServeHTTP(t *testing.T) {
+	_, server := newHandler(t, map[string]mockspec.Spec{
+		"users":   spec("GET", "/users/:id", `{"id":1}`, nil),
+		"created": spec("POST", "/users", `{"created":true}`, nil),
+		"files":   spec("GET", "/files/*", `{"file":true}`, nil),
+	})
+	tests := []struct {
+		method string
+		path   string
+		status int
+		want   string
+	}{
+		{method: "GET", path: "/users/1", status: http.StatusOK, want: `{"id":1}`},
+		{method: "POST", path: "/users", status: http.StatusOK, want: `{"created":true}`},
+		{method: "GET", path: "/users", status: http.StatusNotFound, want: "Not Found\n"},
+		{method: "DELETE", path: "/users/1", status: http.StatusNotFound, want: "Not Found\n"},
+		{method: "GET", path: "/files/a/b", status: http.StatusOK, want: `{"file":true}`},
+		{method: "GET", path: "/files/", status: http.StatusOK, want: `{"file":true}`},
+		{method: "GET", path: "/files", status: http.StatusNotFound, want: "Not Found\n"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %v", tt.method, tt.path, err)
+		}
+		b, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.status || string(b) != tt.want {
+			t.Fatalf("%s %s: expected %d %s, but got %d %s", tt.method, tt.path, tt.status, tt.want, res.StatusCode, b)
+		}
+	}
+}
+
+func TestFaults(t *testing.T) {
+	unavailable := &mockspec.Faults{ErrorRate: 100, ErrorStatus: http.StatusServiceUnavailable}
+	tests := []struct {
+		name    string
+		global  *mockspec.Faults
+		faults  *mockspec.Faults
+		off     bool
+		status  int
+		want    string
+		wantErr bool
+	}{
+		{name: "no faults", status: http.StatusOK, want: `{"name":"pmok"}`},
+		{name: "spec faults", faults: unavailable, status: http.StatusServiceUnavailable, want: `{"message":"fault injected"}`},
+		{name: "global faults", global: unavailable, status: http.StatusServiceUnavailable, want: `{"message":"fault injected"}`},
+		{name: "spec faults replace global faults", global: unavailable, faults: &mockspec.Faults{}, status: http.StatusOK, want: `{"name":"pmok"}`},
+		{name: "error status defaults to 500", faults: &mockspec.Faults{ErrorRate: 100}, status: http.StatusInternalServerError, want: `{"message":"fault injected"}`},
+		{name: "disabled", global: unavailable, faults: unavailable, off: true, status: http.StatusOK, want: `{"name":"pmok"}`},
+		{name: "reset", faults: &mockspec.Faults{ResetRate: 100}, wantErr: true},
+		{name: "truncate", faults: &mockspec.Faults{TruncateRate: 100}, status: http.StatusOK, want: `{"name"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, server := newHandler(t, map[string]mockspec.Spec{
+				"user": spec("GET", "/user", `{"name":"pmok"}`, tt.faults),
+			})
+			h.SetFaults(tt.global)
+			h.EnableFaults(!tt.off)
+
+			res, err := http.Get(server.URL + "/user")
+			if err != nil {
+				if tt.wantErr && tt.status == 0 {
+					return
+				}
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer res.Body.Close()
+			b, err := io.ReadAll(res.Body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected a body error %v, but got %v", tt.wantErr, err)
+			}
+			if res.StatusCode != tt.status || string(b) != tt.want {
+				t.Fatalf("expected %d %s, but got %d %s", tt.status, tt.want, res.StatusCode, b)
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency mockspec.Latency
+		min     time.Duration
+	}{
+		{name: "fixed", latency: mockspec.Latency{FixedMs: 50}, min: 50 * time.Millisecond},
+		{name: "range", latency: mockspec.Latency{MinMs: 30, MaxMs: 60}, min: 30 * time.Millisecond},
+		{name: "equal min and max", latency: mockspec.Latency{MinMs: 50, MaxMs: 50}, min: 50 * time.Millisecond},
+		{name: "fixed and range", latency: mockspec.Latency{FixedMs: 20, MinMs: 30, MaxMs: 30}, min: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newHandler(t, map[string]mockspec.Spec{
+				"user": spec("GET", "/user", `{"name":"pmok"}`, &mockspec.Faults{Latency: &tt.latency}),
+			})
+			start := time.Now()
+			res, err := http.Get(server.URL + "/user")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			res.Body.Close()
+			// only the lower bound is asserted, a slow machine may take longer
+			if took := time.Since(start); took < tt.min {
+				t.Fatalf("expected a delay of at least %v, but took %v", tt.min, took)
+			}
+		})
+	}
+}
+
+func TestTruncateEvents(t *testing.T) {
+	s := spec("GET", "/events", "", &mockspec.Faults{TruncateRate: 100})
+	s.Response.Headers = http.Header{"Content-Type": []string{"text/event-stream"}}
+	s.Response.Events = []mockspec.SpecEvent{{Data: "data: 1\n\n"}, {Data: "data: 2\n\n"}, {Data: "data: 3\n\n"}, {Data: "data: 4\n\n"}}
+	h, server := newHandler(t, map[string]mockspec.Spec{"events": s})
+	h.SetStreamSpeed(0)
+
+	res, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err == nil {
+		t.Fatalf("expected the stream to be cut, but got %q", b)
+	}
+	if got := string(b); !strings.HasPrefix(got, "data: 1\n\ndata: 2\n\n") || strings.Contains(got, "data: 3") {
+		t.Fatalf("expected half of the events, but got %q", got)
+	}
+}
@@ -0,0 +1,102 @@
+package mockserver
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+var upgrader = websocket.Upgrader{
+	// mocks are served to any origin
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// serveWebSocket replays the conversation of a WebSocket spec and answers
+// client messages with its rules. Server messages are sent at their recorded
+// times after the client message they follow
+func (h *Handler) serveWebSocket(w http.ResponseWriter, r *http.Request, spec mockspec.SpecWebSocket) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "Upgrade Required", http.StatusUpgradeRequired)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	h.mu.Lock()
+	speed := h.streamSpeed
+	h.mu.Unlock()
+
+	// writes come from the conversation and from the rules
+	var mu sync.Mutex
+	write := func(typ int, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return conn.WriteMessage(typ, data)
+	}
+
+	// client messages the conversation has not waited for yet
+	received := make(chan struct{}, len(spec.Messages))
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if typ == websocket.TextMessage {
+				for _, rule := range spec.Rules {
+					if rule.Matches(string(data)) {
+						write(websocket.TextMessage, []byte(rule.Reply))
+					}
+				}
+			}
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	start, startAt := time.Now(), int64(0)
+	for _, m := range spec.Messages {
+		if m.From == mockspec.FromClient {
+			select {
+			case <-received:
+			case <-closed:
+				return
+			}
+			start, startAt = time.Now(), m.At
+			continue
+		}
+		if speed > 0 {
+			wait := time.Duration(float64(m.At-startAt)/speed*float64(time.Millisecond)) - time.Since(start)
+			if wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-closed:
+					return
+				}
+			}
+		}
+		if m.Type == mockspec.MessageClose {
+			write(websocket.CloseMessage, websocket.FormatCloseMessage(m.Code, m.Data))
+			return
+		}
+		typ := websocket.TextMessage
+		if m.Type == mockspec.MessageBinary {
+			typ = websocket.BinaryMessage
+		}
+		data, _ := m.Bytes()
+		if err := write(typ, data); err != nil {
+			return
+		}
+	}
+	// the connection stays open for the rules until the client closes it
+	<-closed
+}
@@ -0,0 +1,38 @@
+package mockspec
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// CheckDir validates every mock spec stored under dir. A missing directory
+// is not an error, projects start without any mocks
+func CheckDir(dir string) error {
+	var errs []error
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		s, err := ReadFile(p)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if err := s.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p, err))
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
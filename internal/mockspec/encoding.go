@@ -0,0 +1,48 @@
+package mockspec
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// NewDecoder returns a reader of the decoded body for a Content-Encoding
+// such as gzip, deflate, br or a list of them. Bodies are decoded while they
+// are read
+func NewDecoder(encoding string, r io.Reader) (io.Reader, error) {
+	// encodings are listed in the order they were applied
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		if r, err = decoder(strings.ToLower(strings.TrimSpace(codings[i])), r); err != nil {
+			return nil, fmt.Errorf("content encoding %s: %w", encoding, err)
+		}
+	}
+	return r, nil
+}
+
+func decoder(coding string, r io.Reader) (io.Reader, error) {
+	switch coding {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// deflate should be zlib wrapped, some servers send raw deflate.
+		// A zlib stream starts with 0x78
+		br := bufio.NewReader(r)
+		if b, err := br.Peek(1); err == nil && b[0] == 0x78 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return brotli.NewReader(r), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %s", coding)
+}
@@ -0,0 +1,73 @@
+package mockspec_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+func compress(t *testing.T, coding string, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	}
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestNewDecoder(t *testing.T) {
+	body := []byte(`[{"id": 1}]`)
+	cases := []struct {
+		name     string
+		encoding string
+		body     []byte
+		err      bool
+	}{
+		{name: "identity", body: body},
+		{name: "gzip", encoding: "gzip", body: compress(t, "gzip", body)},
+		{name: "deflate", encoding: "deflate", body: compress(t, "deflate", body)},
+		{name: "raw deflate", encoding: "deflate", body: compress(t, "raw deflate", body)},
+		{name: "brotli", encoding: "br", body: compress(t, "br", body)},
+		{name: "chained", encoding: "gzip, br", body: compress(t, "br", compress(t, "gzip", body))},
+		{name: "unsupported", encoding: "zstd", body: body, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := mockspec.NewDecoder(c.encoding, bytes.NewReader(c.body))
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(got, body) {
+				t.Fatalf("expected %s, but got %s", body, got)
+			}
+		})
+	}
+}
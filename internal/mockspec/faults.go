@@ -0,0 +1,61 @@
+package mockspec
+
+import "fmt"
+
+// Faults injects failures into responses to exercise client resilience.
+// Rates are percentages between 0 and 100. Faults are set globally in the
+// manifest, per function or per mock, the most specific one wins
+type Faults struct {
+	Latency *Latency `json:"latency,omitempty" yaml:"latency,omitempty"`
+	// ErrorRate is the percentage of responses replaced with ErrorStatus
+	ErrorRate float64 `json:"errorRate,omitempty" yaml:"errorRate,omitempty"`
+	// ErrorStatus is the status of injected errors. Defaults to 500
+	ErrorStatus int `json:"errorStatus,omitempty" yaml:"errorStatus,omitempty"`
+	// TruncateRate is the percentage of responses whose body is cut short
+	TruncateRate float64 `json:"truncateRate,omitempty" yaml:"truncateRate,omitempty"`
+	// ResetRate is the percentage of connections reset before the response is
+	// sent. The Deno runtime cannot close the connection of a request, it
+	// sends the headers and aborts the body instead
+	ResetRate float64 `json:"resetRate,omitempty" yaml:"resetRate,omitempty"`
+}
+
+// Latency delays responses by FixedMs plus a random delay between MinMs and
+// MaxMs when MaxMs is set. MinMs needs MaxMs
+type Latency struct {
+	FixedMs int `json:"fixedMs,omitempty" yaml:"fixedMs,omitempty"`
+	MinMs   int `json:"minMs,omitempty" yaml:"minMs,omitempty"`
+	MaxMs   int `json:"maxMs,omitempty" yaml:"maxMs,omitempty"`
+}
+
+// Validate checks the rates, the error status and the latency. Errors are
+// reported in the order of the fields
+func (f Faults) Validate() error {
+	rates := []struct {
+		name string
+		rate float64
+	}{
+		{"errorRate", f.ErrorRate},
+		{"truncateRate", f.TruncateRate},
+		{"resetRate", f.ResetRate},
+	}
+	for _, r := range rates {
+		if r.rate < 0 || r.rate > 100 {
+			return fmt.Errorf("faults: %s must be between 0 and 100, got %v", r.name, r.rate)
+		}
+	}
+	if f.ErrorStatus != 0 && (f.ErrorStatus < 100 || f.ErrorStatus > 599) {
+		return fmt.Errorf("faults: invalid errorStatus %d", f.ErrorStatus)
+	}
+	if l := f.Latency; l != nil {
+		if l.FixedMs < 0 || l.MinMs < 0 || l.MaxMs < 0 {
+			return fmt.Errorf("faults: latency must not be negative")
+		}
+		if l.MinMs > 0 && l.MaxMs == 0 {
+			return fmt.Errorf("faults: latency minMs %d needs maxMs", l.MinMs)
+		}
+		if l.MaxMs != 0 && l.MaxMs < l.MinMs {
+			return fmt.Errorf("faults: latency maxMs %d is less than minMs %d", l.MaxMs, l.MinMs)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package mockspec_test
+
+import (
+	"testing"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+func TestFaultsValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		faults mockspec.Faults
+		want   string
+	}{
+		{name: "empty", faults: mockspec.Faults{}},
+		{
+			name: "valid",
+			faults: mockspec.Faults{
+				Latency:     &mockspec.Latency{FixedMs: 10, MinMs: 5, MaxMs: 20},
+				ErrorRate:   50,
+				ErrorStatus: 503,
+				ResetRate:   100,
+			},
+		},
+		{
+			name:   "the first invalid rate is reported",
+			faults: mockspec.Faults{ErrorRate: 101, TruncateRate: -1, ResetRate: 200},
+			want:   "faults: errorRate must be between 0 and 100, got 101",
+		},
+		{
+			name:   "later rates",
+			faults: mockspec.Faults{TruncateRate: -1, ResetRate: 200},
+			want:   "faults: truncateRate must be between 0 and 100, got -1",
+		},
+		{name: "error status", faults: mockspec.Faults{ErrorStatus: 42}, want: "faults: invalid errorStatus 42"},
+		{
+			name:   "negative latency",
+			faults: mockspec.Faults{Latency: &mockspec.Latency{FixedMs: -1}},
+			want:   "faults: latency must not be negative",
+		},
+		{
+			name:   "minMs without maxMs",
+			faults: mockspec.Faults{Latency: &mockspec.Latency{MinMs: 100}},
+			want:   "faults: latency minMs 100 needs maxMs",
+		},
+		{
+			name:   "maxMs below minMs",
+			faults: mockspec.Faults{Latency: &mockspec.Latency{MinMs: 100, MaxMs: 50}},
+			want:   "faults: latency maxMs 50 is less than minMs 100",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.faults.Validate()
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != c.want {
+				t.Fatalf("expected error %q, but got %q", c.want, got)
+			}
+		})
+	}
+}
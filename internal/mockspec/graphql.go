@@ -0,0 +1,120 @@
+package mockspec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// SpecGraphql narrows the request of a spec to one GraphQL operation. All
+// operations of an API share its path, the operation name and the variables
+// tell them apart
+type SpecGraphql struct {
+	// OperationName is the operation the spec answers, empty for anonymous
+	// operations
+	OperationName string `json:"operationName"`
+	// Variables must equal the variables of the request when set, otherwise
+	// the spec answers the operation with any variables
+	Variables json.RawMessage `json:"variables,omitempty"`
+}
+
+// GraphqlRequest is a GraphQL operation sent over HTTP
+type GraphqlRequest struct {
+	Query         string          `json:"query"`
+	OperationName string          `json:"operationName,omitempty"`
+	Variables     json.RawMessage `json:"variables,omitempty"`
+}
+
+var operationPattern = regexp.MustCompile(`(?:^|[\s{}])(?:query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)`)
+
+// ParseGraphqlRequest reads the GraphQL operation of a request, sent as a JSON
+// body or as query parameters. body is the request body, read by the caller.
+// Any request with a query looks like an operation, callers only parse the
+// requests to the GraphQL path
+func ParseGraphqlRequest(r *http.Request, body []byte) (GraphqlRequest, bool) {
+	var g GraphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		g.Query = q.Get("query")
+		g.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			g.Variables = json.RawMessage(v)
+		}
+	case http.MethodPost:
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch contentType {
+		case "application/graphql":
+			g.Query = string(body)
+		case "application/json":
+			if err := json.Unmarshal(body, &g); err != nil {
+				return GraphqlRequest{}, false
+			}
+		}
+	}
+	if strings.TrimSpace(g.Query) == "" || (len(g.Variables) > 0 && !json.Valid(g.Variables)) {
+		return GraphqlRequest{}, false
+	}
+	return g, true
+}
+
+// Operation returns the name of the requested operation, the name of the first
+// operation of the query when the request does not name one
+func (g GraphqlRequest) Operation() string {
+	if g.OperationName != "" {
+		return g.OperationName
+	}
+	if m := operationPattern.FindStringSubmatch(g.Query); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Matches reports whether the spec answers a GraphQL request
+func (s SpecGraphql) Matches(g GraphqlRequest) bool {
+	if s.OperationName != g.Operation() {
+		return false
+	}
+	want := CanonicalVariables(s.Variables)
+	return want == "" || want == CanonicalVariables(g.Variables)
+}
+
+// CanonicalVariables returns variables as JSON with sorted keys, so equal
+// variables compare equal however they were written. Empty for no variables
+func CanonicalVariables(vars json.RawMessage) string {
+	var v any
+	if err := json.Unmarshal(vars, &v); err != nil || v == nil {
+		return ""
+	}
+	if m, ok := v.(map[string]any); ok && len(m) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// GraphqlFileName names the mock of a GraphQL operation after the operation and
+// a hash of its variables, _graphql.GetUser.3f2a9c1b.json for /graphql
+func GraphqlFileName(p string, g GraphqlRequest) string {
+	name := strings.TrimSuffix(MockFileNameFromPath(p), ".json") + "."
+	if op := g.Operation(); op != "" {
+		name += op
+	} else {
+		name += "anonymous"
+	}
+	if vars := CanonicalVariables(g.Variables); vars != "" {
+		sum := sha256.Sum256([]byte(vars))
+		name += "." + hex.EncodeToString(sum[:4])
+	}
+	return name + ".json"
+}
@@ -0,0 +1,86 @@
+package mockspec_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+func TestParseGraphqlRequest(t *testing.T) {
+	get := httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape("{ me { id } }")+"&variables="+url.QueryEscape(`{"a":1}`), nil)
+	tests := []struct {
+		name      string
+		r         *http.Request
+		body      string
+		ok        bool
+		operation string
+		variables string
+	}{
+		{name: "json", r: post("application/json"), body: `{"query": "query GetUser($id: ID) { user(id: $id) { id } }", "variables": {"id": 1}}`, ok: true, operation: "GetUser", variables: `{"id":1}`},
+		{name: "operation name wins", r: post("application/json; charset=utf-8"), body: `{"query": "query A { a } query B { b }", "operationName": "B"}`, ok: true, operation: "B"},
+		{name: "anonymous", r: post("application/json"), body: `{"query": "{ me { id } }"}`, ok: true},
+		{name: "graphql body", r: post("application/graphql"), body: `mutation Rename { rename }`, ok: true, operation: "Rename"},
+		{name: "query parameters", r: get, ok: true, variables: `{"a":1}`},
+		{name: "json without a query", r: post("application/json"), body: `{"name": "ada"}`},
+		{name: "other content types", r: post("text/plain"), body: `{"query": "{ me }"}`},
+	}
+	for _, tt := range tests {
+		g, ok := mockspec.ParseGraphqlRequest(tt.r, []byte(tt.body))
+		if ok != tt.ok {
+			t.Fatalf("%s: expected ok %v, but got %v", tt.name, tt.ok, ok)
+		}
+		if got := g.Operation(); got != tt.operation {
+			t.Fatalf("%s: expected operation %q, but got %q", tt.name, tt.operation, got)
+		}
+		if got := mockspec.CanonicalVariables(g.Variables); got != tt.variables {
+			t.Fatalf("%s: expected variables %s, but got %s", tt.name, tt.variables, got)
+		}
+	}
+}
+
+func post(contentType string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(""))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+func TestGraphqlMatches(t *testing.T) {
+	req := mockspec.GraphqlRequest{Query: "query GetUser { user { id } }", Variables: json.RawMessage(`{"b": [1, 2], "a": "x"}`)}
+	tests := []struct {
+		spec mockspec.SpecGraphql
+		want bool
+	}{
+		{spec: mockspec.SpecGraphql{OperationName: "GetUser"}, want: true},
+		{spec: mockspec.SpecGraphql{OperationName: "GetUser", Variables: json.RawMessage(`{"a":"x","b":[1,2]}`)}, want: true},
+		{spec: mockspec.SpecGraphql{OperationName: "GetUser", Variables: json.RawMessage(`{}`)}, want: true},
+		{spec: mockspec.SpecGraphql{OperationName: "GetUser", Variables: json.RawMessage(`{"a":"y","b":[1,2]}`)}},
+		{spec: mockspec.SpecGraphql{OperationName: "ListUsers"}},
+	}
+	for _, tt := range tests {
+		if got := tt.spec.Matches(req); got != tt.want {
+			t.Fatalf("expected %+v to match %v, but got %v", tt.spec, tt.want, got)
+		}
+	}
+}
+
+func TestGraphqlFileName(t *testing.T) {
+	tests := []struct {
+		req  mockspec.GraphqlRequest
+		want string
+	}{
+		{req: mockspec.GraphqlRequest{Query: "query GetUser { user { id } }"}, want: "_graphql.GetUser.json"},
+		{req: mockspec.GraphqlRequest{Query: "{ me }"}, want: "_graphql.anonymous.json"},
+		{req: mockspec.GraphqlRequest{Query: "query GetUser { user { id } }", Variables: json.RawMessage(`{"id": "1"}`)}, want: "_graphql.GetUser.5811967f.json"},
+		{req: mockspec.GraphqlRequest{Query: "query GetUser { user { id } }", Variables: json.RawMessage(`{ "id":"1" }`)}, want: "_graphql.GetUser.5811967f.json"},
+	}
+	for _, tt := range tests {
+		if got := mockspec.GraphqlFileName("/graphql", tt.req); got != tt.want {
+			t.Fatalf("expected %s, but got %s", tt.want, got)
+		}
+	}
+}
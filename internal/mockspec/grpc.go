@@ -0,0 +1,27 @@
+package mockspec
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SpecGrpc is the response of a gRPC method. The request path of the spec is
+// the method, /package.Service/Method, and its method is POST
+type SpecGrpc struct {
+	// Messages are the response messages as JSON, transcoded to protobuf with
+	// the descriptors of the protos in the manifest. Unary methods send the
+	// first message, server streaming methods send all of them
+	Messages []json.RawMessage `json:"messages,omitempty"`
+	// Code is the gRPC status code, 0 (OK) by default
+	Code int `json:"code,omitempty"`
+	// Message is the status message
+	Message string `json:"message,omitempty"`
+}
+
+// Validate checks the status code of the response
+func (g SpecGrpc) Validate() error {
+	if g.Code < 0 || g.Code > 16 {
+		return fmt.Errorf("grpc: invalid status code %d", g.Code)
+	}
+	return nil
+}
@@ -1,49 +1,165 @@
 package json
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unicode/utf8"
 
 	"github.com/protomoks/pmok/internal/mockspec"
 )
 
 type spec struct {
-	w        io.WriteCloser
-	Request  mockspec.SpecRequest      `json:"request"`
-	Response mockspec.SpecBodyResponse `json:"response"`
+	w io.WriteCloser
+	mockspec.Spec
+	// bodyFile is where large and binary bodies go, none if empty
+	bodyFile  string
+	maxInline int64
 }
 
-func New(w io.WriteCloser) mockspec.MockWriter {
-	return &spec{
-		w: w,
+type Option func(*spec)
+
+// WithBodyFile stores bodies larger than maxInline bytes, and bodies that are
+// not text, in the file at path instead of the spec
+func WithBodyFile(path string) Option {
+	return func(s *spec) {
+		s.bodyFile = path
 	}
 }
 
-func (s *spec) WriteResponse(res *http.Response) error {
-	s.Request.Headers = res.Header
-	s.Request.RequestPath = res.Request.URL.Path
-	s.Request.Method = res.Request.Method
-	s.Response.Headers = res.Header
+// WithGraphql narrows the spec to the operation and the variables of a GraphQL
+// request
+func WithGraphql(g mockspec.GraphqlRequest) Option {
+	return func(s *spec) {
+		s.Graphql = &mockspec.SpecGraphql{OperationName: g.Operation()}
+		if vars := mockspec.CanonicalVariables(g.Variables); vars != "" {
+			s.Graphql.Variables = json.RawMessage(vars)
+		}
+	}
+}
 
-	b, err := io.ReadAll(res.Body)
+// WithMaxInline sets the largest body stored in the spec itself, 1MB by
+// default
+func WithMaxInline(n int64) Option {
+	return func(s *spec) {
+		s.maxInline = n
+	}
+}
+
+func New(w io.WriteCloser, opts ...Option) mockspec.MockWriter {
+	s := &spec{
+		w:         w,
+		maxInline: 1 << 20,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *spec) WriteResponse(res *http.Response) error {
+	defer res.Body.Close()
+	encoding := res.Header.Get("Content-Encoding")
+	body, err := mockspec.NewDecoder(encoding, res.Body)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
-	var body map[string]any
-	if err := json.Unmarshal(b, &body); err != nil {
+	// only bodies up to maxInline are held in memory
+	b, err := io.ReadAll(io.LimitReader(body, s.maxInline+1))
+	if err != nil {
 		return err
 	}
+	size := int64(len(b))
 
-	s.Response.Body = body
+	// the body is stored as is, so key order and number precision survive.
+	// Bodies that are not valid JSON are kept as text
+	switch {
+	case size > s.maxInline || !utf8.Valid(b):
+		if s.bodyFile == "" {
+			return mockspec.ErrBodyTooLarge
+		}
+		if size, err = s.writeBodyFile(io.MultiReader(bytes.NewReader(b), body)); err != nil {
+			return err
+		}
+		s.Response.BodyFile = filepath.Base(s.bodyFile)
+	case len(bytes.TrimSpace(b)) == 0:
+	case json.Valid(b):
+		s.Response.Body = b
+	default:
+		s.Response.BodyText = string(b)
+	}
+
+	// bodies are stored decoded
+	header := res.Header.Clone()
+	if encoding != "" {
+		header.Del("Content-Encoding")
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	s.SpecVersion = mockspec.SpecVersion
+	s.Response.Encoding = encoding
+	s.Request.Headers = header
+	s.Request.RequestPath = res.Request.URL.Path
+	s.Request.Method = res.Request.Method
+	s.Response.Status = res.StatusCode
+	s.Response.Headers = header
 
 	enc := json.NewEncoder(s.w)
+	enc.SetEscapeHTML(false)
 	enc.SetIndent(" ", " ")
-	return enc.Encode(s)
+	if err := enc.Encode(s.Spec); err != nil {
+		return err
+	}
+	if s.Response.BodyFile == "" && s.bodyFile != "" {
+		// a body file from an earlier recording no longer applies
+		os.Remove(s.bodyFile)
+	}
+	return nil
+}
 
+// writeBodyFile replaces the body file once the whole body is written, a
+// failed write keeps the body file of an earlier recording
+func (s *spec) writeBodyFile(r io.Reader) (int64, error) {
+	f, err := os.CreateTemp(filepath.Dir(s.bodyFile), "."+filepath.Base(s.bodyFile)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, os.Rename(f.Name(), s.bodyFile)
 }
 
 func (s *spec) Close() error {
 	return s.w.Close()
 }
+
+type reader struct {
+	r io.ReadCloser
+}
+
+func NewReader(r io.ReadCloser) mockspec.MockReader {
+	return &reader{
+		r: r,
+	}
+}
+
+func (r *reader) ReadSpec() (mockspec.Spec, error) {
+	return mockspec.Load(r.r)
+}
+
+func (r *reader) Close() error {
+	return r.r.Close()
+}
@@ -0,0 +1,141 @@
+package json_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	stdjson "encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/protomoks/pmok/internal/mockspec/json"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+func TestWriteResponse(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		want     string
+		wantText string
+	}{
+		{name: "array", body: `[{"b": 1, "a": 2}]`, want: `[{"b":1,"a":2}]`},
+		{name: "number", body: `12345678901234567890`, want: `12345678901234567890`},
+		{name: "string", body: `"ok"`, want: `"ok"`},
+		{name: "null", body: `null`, want: `null`},
+		{name: "empty", body: ``, want: `null`},
+		{name: "invalid", body: `{"truncated":`, want: `null`, wantText: `{"truncated":`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out buffer
+			res := &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(c.body)),
+				Request:    &http.Request{Method: "GET", URL: &url.URL{Path: "/items"}},
+			}
+			if err := json.New(&out).WriteResponse(res); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			s, err := json.NewReader(&out).ReadSpec()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got bytes.Buffer
+			if len(s.Response.Body) > 0 {
+				if err := stdjson.Compact(&got, s.Response.Body); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				got.WriteString("null")
+			}
+			if got.String() != c.want || s.Response.BodyText != c.wantText {
+				t.Fatalf("expected %s %q, but got %s %q", c.want, c.wantText, got.String(), s.Response.BodyText)
+			}
+			if s.SpecVersion != mockspec.SpecVersion {
+				t.Fatalf("expected version %d, but got %d", mockspec.SpecVersion, s.SpecVersion)
+			}
+		})
+	}
+}
+
+func response(body []byte, header http.Header) *http.Response {
+	return &http.Response{
+		StatusCode: 200,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    &http.Request{Method: "GET", URL: &url.URL{Path: "/download"}},
+	}
+}
+
+func TestWriteResponseBodyFile(t *testing.T) {
+	body := []byte(`["` + strings.Repeat("a", 100) + `"]`)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(body)
+	w.Close()
+	header := http.Header{"Content-Encoding": []string{"gzip"}, "Content-Length": []string{"10"}}
+
+	bodyFile := filepath.Join(t.TempDir(), "_download.body")
+	var out buffer
+	mw := json.New(&out, json.WithMaxInline(16), json.WithBodyFile(bodyFile))
+	if err := mw.WriteResponse(response(gz.Bytes(), header)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, err := mockspec.Load(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Response.BodyFile != "_download.body" || s.Response.BodyText != "" {
+		t.Fatalf("expected the body in _download.body, but got %+v", s.Response)
+	}
+	got, err := os.ReadFile(bodyFile)
+	if err != nil || !bytes.Equal(got, body) {
+		t.Fatalf("expected the decoded body in the body file, but got %s %v", got, err)
+	}
+	if s.Response.Encoding != "gzip" || s.Response.Headers.Get("Content-Encoding") != "" || s.Response.Headers.Get("Content-Length") != "104" {
+		t.Fatalf("expected the headers to describe the decoded body, but got %v", s.Response.Headers)
+	}
+
+	// without a body file large bodies are not recorded
+	err = json.New(&buffer{}, json.WithMaxInline(16)).WriteResponse(response(body, http.Header{}))
+	if !errors.Is(err, mockspec.ErrBodyTooLarge) {
+		t.Fatalf("expected ErrBodyTooLarge, but got %v", err)
+	}
+}
+
+func TestWriteResponseGraphql(t *testing.T) {
+	var out buffer
+	g := mockspec.GraphqlRequest{Query: "query GetUser($id: ID) { user(id: $id) { id } }", Variables: stdjson.RawMessage(`{"id": "1"}`)}
+	res := response([]byte(`{"data": {"user": {"id": "1"}}}`), http.Header{"Content-Type": []string{"application/json"}})
+	if err := json.New(&out, json.WithGraphql(g)).WriteResponse(res); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, err := json.NewReader(&out).ReadSpec()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Graphql == nil || s.Graphql.OperationName != "GetUser" {
+		t.Fatalf("expected the GetUser operation, but got %+v", s.Graphql)
+	}
+	if got := mockspec.CanonicalVariables(s.Graphql.Variables); got != `{"id":"1"}` {
+		t.Fatalf("expected the variables of the request, but got %s", got)
+	}
+	if !s.Graphql.Matches(g) {
+		t.Fatalf("expected the spec to match its request")
+	}
+}
@@ -0,0 +1,44 @@
+package mockspec
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SpecVersion is the version of the spec format written by this build. Specs
+// without a version predate versioning and have the same format as version 1
+const SpecVersion = 1
+
+// Schema is the JSON schema of the spec format. The Spec types, the schema
+// and the Deno runtime follow the same definition
+//
+//go:embed spec.schema.json
+var Schema []byte
+
+// UnsupportedVersionError is returned for specs written by a newer pmok
+type UnsupportedVersionError struct {
+	Version int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported spec version %d, this pmok reads up to version %d", e.Version, SpecVersion)
+}
+
+type MockReader interface {
+	ReadSpec() (Spec, error)
+	Close() error
+}
+
+// Load decodes a spec and checks that its version can be read
+func Load(r io.Reader) (Spec, error) {
+	var s Spec
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return s, err
+	}
+	if s.SpecVersion > SpecVersion {
+		return s, &UnsupportedVersionError{Version: s.SpecVersion}
+	}
+	return s, nil
+}
@@ -0,0 +1,74 @@
+package mockspec_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    string
+		version int
+		err     bool
+	}{
+		{name: "unversioned", spec: `{"request": {"method": "GET", "path": "/"}, "response": {"headers": {}, "body": {}}}`},
+		{name: "current", spec: `{"specVersion": 1, "request": {"method": "GET", "path": "/"}, "response": {"headers": {}, "body": {}}}`, version: 1},
+		{name: "newer", spec: `{"specVersion": 2, "request": {"method": "GET", "path": "/"}, "response": {"headers": {}, "body": {}}}`, err: true},
+		{name: "malformed", spec: `{"request": `, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := mockspec.Load(strings.NewReader(c.spec))
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, but got %+v", s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s.SpecVersion != c.version {
+				t.Fatalf("expected version %d, but got %d", c.version, s.SpecVersion)
+			}
+		})
+	}
+
+	_, err := mockspec.Load(strings.NewReader(`{"specVersion": 3}`))
+	var ve *mockspec.UnsupportedVersionError
+	if !errors.As(err, &ve) || ve.Version != 3 {
+		t.Fatalf("expected an UnsupportedVersionError for version 3, but got %v", err)
+	}
+}
+
+// the schema documents every field of Spec
+func TestSchemaMatchesSpec(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(mockspec.Schema, &schema); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	typ := reflect.TypeOf(mockspec.Spec{})
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		want = append(want, name)
+	}
+	var got []string
+	for name := range schema.Properties {
+		got = append(got, name)
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected schema properties %v, but got %v", want, got)
+	}
+}
@@ -18,6 +18,9 @@ const (
 	ContentTypeZIP            = "application/zip"
 	ContentTypeSVG            = "image/svg+xml"
 	ContentTypeWebP           = "image/webp"
+	ContentTypeEventStream    = "text/event-stream"
+	ContentTypeNDJSON         = "application/x-ndjson"
+	ContentTypeJSONLines      = "application/jsonl"
 )
 
 // ExtensionToContentType is a map of file extensions to content types
@@ -1,7 +1,13 @@
 package mockspec
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -12,14 +18,107 @@ type SpecRequest struct {
 }
 
 type SpecResponse struct {
+	Status  int         `json:"status,omitempty"`
 	Headers http.Header `json:"headers"`
+	// Template enables {{ }} placeholders in the response headers and body
+	Template bool `json:"template,omitempty"`
 }
 
 type SpecBodyResponse struct {
 	SpecResponse
-	Body map[string]any `json:"body"`
+	// Body is kept as recorded, with its key order and number precision
+	Body json.RawMessage `json:"body"`
+	// BodyText replaces Body for responses that are not valid JSON
+	BodyText string `json:"bodyText,omitempty"`
+	// BodyFile replaces Body for large or binary responses. It names a file
+	// next to the spec that holds the body, see BodyFileName
+	BodyFile string `json:"bodyFile,omitempty"`
+	// Events replaces Body for event streams, each event is sent at the time
+	// it was recorded
+	Events []SpecEvent `json:"events,omitempty"`
+	// Encoding is the Content-Encoding the body was recorded with. Bodies are
+	// stored decoded and served without a Content-Encoding
+	Encoding string `json:"encoding,omitempty"`
 }
 
+// SpecEvent is an event of a recorded stream, such as a server-sent event or
+// a line of NDJSON
+type SpecEvent struct {
+	// At is the time the event was sent, in milliseconds after the response
+	// started
+	At int64 `json:"at"`
+	// Data is the event as it was sent, e.g. "data: {}\n\n"
+	Data string `json:"data"`
+}
+
+// Bytes returns the body as it is served. Bodies stored in a BodyFile are
+// read with Open
+func (r SpecBodyResponse) Bytes() []byte {
+	if r.BodyText != "" {
+		return []byte(r.BodyText)
+	}
+	return r.Body
+}
+
+// Spec is a mock as it is stored on disk, described by Schema
+type Spec struct {
+	// SpecVersion is the format version, see SpecVersion
+	SpecVersion int              `json:"specVersion,omitempty"`
+	Request     SpecRequest      `json:"request"`
+	Response    SpecBodyResponse `json:"response"`
+	// Priority decides between overlapping routes, higher wins. Defaults to 0
+	Priority int `json:"priority,omitempty"`
+	// Scenario optionally replaces Response with sequenced responses
+	Scenario *SpecScenario `json:"scenario,omitempty"`
+	// Faults overrides the global faults of the manifest for this mock
+	Faults *Faults `json:"faults,omitempty"`
+	// WebSocket replaces Response for WebSocket endpoints
+	WebSocket *SpecWebSocket `json:"websocket,omitempty"`
+	// Grpc replaces Response for gRPC methods
+	Grpc *SpecGrpc `json:"grpc,omitempty"`
+	// Graphql narrows the request to one GraphQL operation
+	Graphql *SpecGraphql `json:"graphql,omitempty"`
+}
+
+// Responses returns every response the spec can serve
+func (s Spec) Responses() []SpecBodyResponse {
+	res := []SpecBodyResponse{s.Response}
+	if s.Scenario != nil {
+		for _, seq := range s.Scenario.States {
+			res = append(res, seq.Responses...)
+		}
+	}
+	return res
+}
+
+// Validate checks the structure and the templates of the spec
+func (s Spec) Validate() error {
+	if s.Faults != nil {
+		if err := s.Faults.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Scenario != nil {
+		if err := s.Scenario.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.WebSocket != nil {
+		if err := s.WebSocket.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Grpc != nil {
+		if err := s.Grpc.Validate(); err != nil {
+			return err
+		}
+	}
+	return ValidateTemplates(s)
+}
+
+// ErrBodyTooLarge is returned by writers for bodies above their size limit
+var ErrBodyTooLarge = errors.New("body is too large to record")
+
 type MockWriter interface {
 	WriteResponse(res *http.Response) error
 	Close() error
@@ -28,3 +127,17 @@ type MockWriter interface {
 func MockFileNameFromPath(p string) string {
 	return strings.ReplaceAll(p, "/", "_") + ".json"
 }
+
+// BodyFileName returns the name of the body file of the spec stored at p
+func BodyFileName(p string) string {
+	return strings.TrimSuffix(p, ".json") + ".body"
+}
+
+// Open returns the body of a response whose spec is stored at p, reading
+// the BodyFile if it has one
+func (r SpecBodyResponse) Open(p string) (io.ReadCloser, error) {
+	if r.BodyFile == "" {
+		return io.NopCloser(bytes.NewReader(r.Bytes())), nil
+	}
+	return os.Open(filepath.Join(filepath.Dir(p), filepath.FromSlash(r.BodyFile)))
+}
@@ -0,0 +1,76 @@
+package mockspec
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// File is a spec stored in a mocks directory
+type File struct {
+	// Path is relative to the mocks directory, slash separated
+	Path string
+	Size int64
+	Spec Spec
+}
+
+// ReadFile reads the spec stored at p
+func ReadFile(p string) (Spec, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return Spec{}, err
+	}
+	defer f.Close()
+	s, err := Load(f)
+	if err != nil {
+		return s, fmt.Errorf("%s: %w", p, err)
+	}
+	return s, nil
+}
+
+// ReadDir reads every spec stored under dir, sorted by path. A missing
+// directory has no specs. A spec that cannot be read does not stop the
+// others, the specs read are returned along with the joined errors
+func ReadDir(dir string) ([]File, error) {
+	var files []File
+	var errs []error
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			// skips the unreadable directory
+			errs = append(errs, err)
+			return nil
+		}
+		if d.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		s, err := ReadFile(p)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{Path: filepath.ToSlash(rel), Size: info.Size(), Spec: s})
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package mockspec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultScenarioState is the state a scenario starts in unless the manifest
+// selects another one
+const DefaultScenarioState = "default"
+
+// SequenceMode controls what a sequence returns once every response was served
+type SequenceMode string
+
+var (
+	// SequenceStick keeps returning the last response. This is the default
+	SequenceStick SequenceMode = "stick"
+	// SequenceLoop starts over from the first response
+	SequenceLoop SequenceMode = "loop"
+)
+
+// SpecSequence is an ordered list of responses. Each call to the route
+// returns the next response in the list
+type SpecSequence struct {
+	Mode      SequenceMode       `json:"mode,omitempty"`
+	Responses []SpecBodyResponse `json:"responses"`
+}
+
+// SpecScenario groups sequences into named states. The manifest and the
+// control endpoint of the mock server switch between states by name
+type SpecScenario struct {
+	Name   string                  `json:"name"`
+	States map[string]SpecSequence `json:"states"`
+}
+
+// Next returns the response for the nth call (starting at 0) of the sequence
+func (s SpecSequence) Next(n int) SpecBodyResponse {
+	if n >= len(s.Responses) {
+		if s.Mode == SequenceLoop {
+			n = n % len(s.Responses)
+		} else {
+			n = len(s.Responses) - 1
+		}
+	}
+	return s.Responses[n]
+}
+
+func (s SpecScenario) Validate() error {
+	if s.Name == "" {
+		return errors.New("scenario: name is required")
+	}
+	if len(s.States) == 0 {
+		return fmt.Errorf("scenario %s: at least one state is required", s.Name)
+	}
+	for name, seq := range s.States {
+		if len(seq.Responses) == 0 {
+			return fmt.Errorf("scenario %s: state %s has no responses", s.Name, name)
+		}
+		switch seq.Mode {
+		case "", SequenceStick, SequenceLoop:
+		default:
+			return fmt.Errorf("scenario %s: state %s has unknown mode %q", s.Name, name, seq.Mode)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package mockspec_test
+
+import (
+	"testing"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+func sequence(mode mockspec.SequenceMode, statuses ...int) mockspec.SpecSequence {
+	seq := mockspec.SpecSequence{Mode: mode}
+	for _, s := range statuses {
+		seq.Responses = append(seq.Responses, mockspec.SpecBodyResponse{
+			SpecResponse: mockspec.SpecResponse{Status: s},
+		})
+	}
+	return seq
+}
+
+func TestSequenceNext(t *testing.T) {
+	cases := []struct {
+		name string
+		seq  mockspec.SpecSequence
+		want []int
+	}{
+		{name: "stick", seq: sequence(mockspec.SequenceStick, 202, 202, 200), want: []int{202, 202, 200, 200, 200}},
+		{name: "default mode sticks", seq: sequence("", 202, 200), want: []int{202, 200, 200}},
+		{name: "loop", seq: sequence(mockspec.SequenceLoop, 500, 200), want: []int{500, 200, 500, 200}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for i, want := range c.want {
+				if got := c.seq.Next(i).Status; got != want {
+					t.Fatalf("call %d: expected status %d, but got %d", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	cases := []struct {
+		name      string
+		scenario  mockspec.SpecScenario
+		wantError bool
+	}{
+		{
+			name: "valid",
+			scenario: mockspec.SpecScenario{Name: "polling", States: map[string]mockspec.SpecSequence{
+				"default": sequence(mockspec.SequenceStick, 202, 200),
+			}},
+		},
+		{name: "missing name", scenario: mockspec.SpecScenario{States: map[string]mockspec.SpecSequence{"default": sequence("", 200)}}, wantError: true},
+		{name: "no states", scenario: mockspec.SpecScenario{Name: "polling"}, wantError: true},
+		{name: "empty state", scenario: mockspec.SpecScenario{Name: "polling", States: map[string]mockspec.SpecSequence{"default": {}}}, wantError: true},
+		{name: "unknown mode", scenario: mockspec.SpecScenario{Name: "polling", States: map[string]mockspec.SpecSequence{"default": sequence("shuffle", 200)}}, wantError: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.scenario.Validate()
+			if c.wantError && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !c.wantError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Package stream records event streams, such as server-sent events and
+// NDJSON, as timestamped events
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/protomoks/pmok/internal/mockspec/mimetypes"
+)
+
+// IsStream reports whether a Content-Type is recorded as an event stream
+func IsStream(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case mimetypes.ContentTypeEventStream, mimetypes.ContentTypeNDJSON, mimetypes.ContentTypeJSONLines:
+		return true
+	}
+	return false
+}
+
+type spec struct {
+	w io.WriteCloser
+	mockspec.Spec
+	start   time.Time
+	maxSize int64
+}
+
+type Option func(*spec)
+
+// WithMaxSize sets the largest stream recorded, in bytes. Streams are not
+// limited by default
+func WithMaxSize(n int64) Option {
+	return func(s *spec) {
+		s.maxSize = n
+	}
+}
+
+// New returns a writer for a stream that starts now. WriteResponse should
+// read the body while it arrives, events are timestamped as they are read
+func New(w io.WriteCloser, opts ...Option) mockspec.MockWriter {
+	s := &spec{
+		w:     w,
+		start: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *spec) WriteResponse(res *http.Response) error {
+	defer res.Body.Close()
+	encoding := res.Header.Get("Content-Encoding")
+	body, err := mockspec.NewDecoder(encoding, res.Body)
+	if err != nil {
+		return err
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	// server-sent events end with a blank line, other streams are lines
+	sse := mediaType == mimetypes.ContentTypeEventStream
+
+	r := bufio.NewReader(body)
+	var size int64
+	var event strings.Builder
+	var events []mockspec.SpecEvent
+	for {
+		line, err := r.ReadString('\n')
+		event.WriteString(line)
+		size += int64(len(line))
+		if s.maxSize > 0 && size > s.maxSize {
+			return mockspec.ErrBodyTooLarge
+		}
+		end := err != nil || !sse || strings.TrimRight(line, "\r\n") == ""
+		if end && event.Len() > 0 {
+			events = append(events, mockspec.SpecEvent{
+				At:   time.Since(s.start).Milliseconds(),
+				Data: event.String(),
+			})
+			event.Reset()
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// streams are sent as events, the recorded length and encoding do not
+	// apply
+	header := res.Header.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	s.SpecVersion = mockspec.SpecVersion
+	s.Request.Headers = header
+	s.Request.RequestPath = res.Request.URL.Path
+	s.Request.Method = res.Request.Method
+	s.Response.Status = res.StatusCode
+	s.Response.Headers = header
+	s.Response.Encoding = encoding
+	s.Response.Events = events
+
+	enc := json.NewEncoder(s.w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(" ", " ")
+	return enc.Encode(s.Spec)
+}
+
+func (s *spec) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,110 @@
+package stream_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/protomoks/pmok/internal/mockspec/stream"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+func record(t *testing.T, contentType string, chunks []string, opts ...stream.Option) (mockspec.Spec, error) {
+	t.Helper()
+	pr, pw := io.Pipe()
+	go func() {
+		for _, c := range chunks {
+			time.Sleep(20 * time.Millisecond)
+			pw.Write([]byte(c))
+		}
+		pw.Close()
+	}()
+	res := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{contentType}, "Content-Length": []string{"10"}},
+		Body:       pr,
+		Request:    &http.Request{Method: "POST", URL: &url.URL{Path: "/chat"}},
+	}
+	var out buffer
+	if err := stream.New(&out, opts...).WriteResponse(res); err != nil {
+		return mockspec.Spec{}, err
+	}
+	return mockspec.Load(&out)
+}
+
+func TestWriteResponse(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		chunks      []string
+		want        []string
+	}{
+		{
+			name:        "server-sent events",
+			contentType: "text/event-stream; charset=utf-8",
+			// events can be split across chunks
+			chunks: []string{"event: token\ndata: a\n\n", "data: b\n", "\ndata: [DONE]\n\n"},
+			want:   []string{"event: token\ndata: a\n\n", "data: b\n\n", "data: [DONE]\n\n"},
+		},
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			chunks:      []string{`{"n":1}` + "\n", `{"n":2}` + "\n" + `{"n":3}`},
+			want:        []string{`{"n":1}` + "\n", `{"n":2}` + "\n", `{"n":3}`},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := record(t, c.contentType, c.chunks)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events := s.Response.Events
+			if len(events) != len(c.want) {
+				t.Fatalf("expected %d events, but got %+v", len(c.want), events)
+			}
+			for i, e := range events {
+				if e.Data != c.want[i] {
+					t.Fatalf("expected event %d to be %q, but got %q", i, c.want[i], e.Data)
+				}
+				if i > 0 && e.At < events[i-1].At {
+					t.Fatalf("expected increasing times, but got %+v", events)
+				}
+			}
+			if events[len(events)-1].At < 40 {
+				t.Fatalf("expected the events to be timestamped as they arrive, but got %+v", events)
+			}
+			if s.Response.Headers.Get("Content-Length") != "" {
+				t.Fatalf("expected no Content-Length, but got %v", s.Response.Headers)
+			}
+		})
+	}
+
+	if _, err := record(t, "application/x-ndjson", []string{"123456\n", "789\n"}, stream.WithMaxSize(8)); err != mockspec.ErrBodyTooLarge {
+		t.Fatalf("expected ErrBodyTooLarge, but got %v", err)
+	}
+}
+
+func TestIsStream(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"text/event-stream":               true,
+		"application/x-ndjson":            true,
+		"application/json; charset=utf-8": false,
+		"":                                false,
+	} {
+		if got := stream.IsStream(contentType); got != want {
+			t.Fatalf("expected %v for %q, but got %v", want, contentType, got)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package mockspec
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	templateOpen  = "{{"
+	templateClose = "}}"
+)
+
+// TemplateData is the request context a template is rendered against
+type TemplateData struct {
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   url.Values
+	Headers http.Header
+	Body    []byte
+}
+
+// Template is a parsed response template. Templates are plain strings with
+// {{ expression }} placeholders, e.g. {"id": "{{request.params.id}}"}
+type Template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	text string
+	expr *templateExpr
+}
+
+type templateExpr struct {
+	name string
+	args []string
+}
+
+// fakerKinds lists the values supported by faker.<kind> expressions
+var fakerKinds = map[string][]string{
+	"firstName": {"Ada", "Alan", "Grace", "Linus", "Margaret", "Ken", "Barbara", "Dennis"},
+	"lastName":  {"Lovelace", "Turing", "Hopper", "Torvalds", "Hamilton", "Thompson", "Liskov", "Ritchie"},
+	"city":      {"Lisbon", "Nairobi", "Osaka", "Toronto", "Berlin", "Lima", "Oslo", "Austin"},
+	"country":   {"Portugal", "Kenya", "Japan", "Canada", "Germany", "Peru", "Norway", "USA"},
+	"company":   {"Acme", "Initech", "Globex", "Umbrella", "Hooli", "Stark Industries"},
+	"word":      {"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel"},
+	"fullName":  nil,
+	"email":     nil,
+}
+
+// ParseTemplate parses and validates s. A string without placeholders is a
+// valid template that renders to itself
+func ParseTemplate(s string) (*Template, error) {
+	t := &Template{}
+	rest := s
+	for len(rest) > 0 {
+		start := strings.Index(rest, templateOpen)
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{text: rest})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{text: rest[:start]})
+		}
+		end := strings.Index(rest[start:], templateClose)
+		if end < 0 {
+			return nil, fmt.Errorf("template %q: unclosed %s", s, templateOpen)
+		}
+		expr, err := parseTemplateExpr(rest[start+len(templateOpen) : start+end])
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", s, err)
+		}
+		t.parts = append(t.parts, templatePart{expr: expr})
+		rest = rest[start+end+len(templateClose):]
+	}
+	return t, nil
+}
+
+func parseTemplateExpr(s string) (*templateExpr, error) {
+	fields, err := splitTemplateArgs(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	expr := &templateExpr{name: fields[0], args: fields[1:]}
+	return expr, expr.validate()
+}
+
+func splitTemplateArgs(s string) ([]string, error) {
+	var (
+		fields  []string
+		current strings.Builder
+		quoted  bool
+		inField bool
+	)
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inField = true
+		case !quoted && (r == ' ' || r == '\t'):
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated string in %q", s)
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+	return fields, nil
+}
+
+func (e *templateExpr) validate() error {
+	switch {
+	case e.name == "request.method", e.name == "request.path", e.name == "request.body":
+		return e.wantArgs(0)
+	case strings.HasPrefix(e.name, "request.params."),
+		strings.HasPrefix(e.name, "request.query."),
+		strings.HasPrefix(e.name, "request.headers."),
+		strings.HasPrefix(e.name, "request.body."):
+		if strings.HasSuffix(e.name, ".") {
+			return fmt.Errorf("%s: missing field name", e.name)
+		}
+		return e.wantArgs(0)
+	case e.name == "now":
+		if len(e.args) > 1 {
+			return fmt.Errorf("now: expected at most 1 argument, got %d", len(e.args))
+		}
+		if len(e.args) == 1 {
+			switch e.args[0] {
+			case "iso", "unix", "unixMillis":
+			default:
+				return fmt.Errorf("now: unknown format %q", e.args[0])
+			}
+		}
+		return nil
+	case e.name == "uuid":
+		return e.wantArgs(0)
+	case e.name == "randomInt":
+		if err := e.wantArgs(2); err != nil {
+			return err
+		}
+		min, err := strconv.Atoi(e.args[0])
+		if err != nil {
+			return fmt.Errorf("randomInt: invalid min %q", e.args[0])
+		}
+		max, err := strconv.Atoi(e.args[1])
+		if err != nil {
+			return fmt.Errorf("randomInt: invalid max %q", e.args[1])
+		}
+		if max < min {
+			return fmt.Errorf("randomInt: max %d is less than min %d", max, min)
+		}
+		return nil
+	case strings.HasPrefix(e.name, "faker."):
+		if _, ok := fakerKinds[strings.TrimPrefix(e.name, "faker.")]; !ok {
+			return fmt.Errorf("unknown faker kind %q", strings.TrimPrefix(e.name, "faker."))
+		}
+		return e.wantArgs(0)
+	}
+	return fmt.Errorf("unknown expression %q", e.name)
+}
+
+func (e *templateExpr) wantArgs(n int) error {
+	if len(e.args) != n {
+		return fmt.Errorf("%s: expected %d arguments, got %d", e.name, n, len(e.args))
+	}
+	return nil
+}
+
+// IsStatic reports whether the template has no placeholders
+func (t *Template) IsStatic() bool {
+	for _, p := range t.parts {
+		if p.expr != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Execute renders the template against the request data
+func (t *Template) Execute(data TemplateData) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.expr == nil {
+			b.WriteString(p.text)
+			continue
+		}
+		b.WriteString(p.expr.eval(data))
+	}
+	return b.String()
+}
+
+func (e *templateExpr) eval(data TemplateData) string {
+	switch {
+	case e.name == "request.method":
+		return data.Method
+	case e.name == "request.path":
+		return data.Path
+	case e.name == "request.body":
+		return string(data.Body)
+	case strings.HasPrefix(e.name, "request.params."):
+		return data.Params[strings.TrimPrefix(e.name, "request.params.")]
+	case strings.HasPrefix(e.name, "request.query."):
+		return data.Query.Get(strings.TrimPrefix(e.name, "request.query."))
+	case strings.HasPrefix(e.name, "request.headers."):
+		return data.Headers.Get(strings.TrimPrefix(e.name, "request.headers."))
+	case strings.HasPrefix(e.name, "request.body."):
+		return lookupBody(data.Body, strings.Split(strings.TrimPrefix(e.name, "request.body."), "."))
+	case e.name == "now":
+		now := time.Now().UTC()
+		if len(e.args) == 1 && e.args[0] == "unix" {
+			return strconv.FormatInt(now.Unix(), 10)
+		}
+		if len(e.args) == 1 && e.args[0] == "unixMillis" {
+			return strconv.FormatInt(now.UnixMilli(), 10)
+		}
+		return now.Format(time.RFC3339)
+	case e.name == "uuid":
+		return newUUID()
+	case e.name == "randomInt":
+		min, _ := strconv.Atoi(e.args[0])
+		max, _ := strconv.Atoi(e.args[1])
+		return strconv.Itoa(min + randomIntn(max-min+1))
+	case strings.HasPrefix(e.name, "faker."):
+		return fake(strings.TrimPrefix(e.name, "faker."))
+	}
+	return ""
+}
+
+func lookupBody(body []byte, fields []string) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return ""
+	}
+	for _, f := range fields {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[f]
+		case []any:
+			i, err := strconv.Atoi(f)
+			if err != nil || i < 0 || i >= len(node) {
+				return ""
+			}
+			v = node[i]
+		default:
+			return ""
+		}
+	}
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	default:
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
+
+func fake(kind string) string {
+	switch kind {
+	case "fullName":
+		return fake("firstName") + " " + fake("lastName")
+	case "email":
+		return strings.ToLower(fake("firstName")+"."+fake("lastName")) + "@example.com"
+	}
+	values := fakerKinds[kind]
+	return values[randomIntn(len(values))]
+}
+
+func randomIntn(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(v.Int64())
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	// version 4, variant 10
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// ValidateTemplates parses every templated header and body string of the spec.
+// Responses that do not opt into templating are always valid
+func ValidateTemplates(s Spec) error {
+	for _, r := range s.Responses() {
+		if err := r.validateTemplates(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r SpecBodyResponse) validateTemplates() error {
+	if !r.Template {
+		return nil
+	}
+	for name, values := range r.Headers {
+		for _, v := range values {
+			if _, err := ParseTemplate(v); err != nil {
+				return fmt.Errorf("header %s: %w", name, err)
+			}
+		}
+	}
+	if _, err := ParseTemplate(r.BodyText); err != nil {
+		return err
+	}
+	for _, e := range r.Events {
+		if _, err := ParseTemplate(e.Data); err != nil {
+			return err
+		}
+	}
+	_, err := walkJSONStrings(r.Body, func(v string) (string, error) {
+		_, err := ParseTemplate(v)
+		return v, err
+	})
+	return err
+}
+
+// Render returns a copy of the response with every template rendered
+// against the request data. Responses that do not opt into templating are
+// returned as is
+func (r SpecBodyResponse) Render(data TemplateData) (SpecBodyResponse, error) {
+	if !r.Template {
+		return r, nil
+	}
+	out := r
+	out.Headers = make(http.Header, len(r.Headers))
+	for name, values := range r.Headers {
+		for _, v := range values {
+			rendered, err := renderString(v, data)
+			if err != nil {
+				return r, fmt.Errorf("header %s: %w", name, err)
+			}
+			out.Headers.Add(name, rendered)
+		}
+	}
+	var err error
+	if out.BodyText, err = renderString(r.BodyText, data); err != nil {
+		return r, err
+	}
+	if r.Events != nil {
+		out.Events = make([]SpecEvent, len(r.Events))
+		for i, e := range r.Events {
+			if e.Data, err = renderString(e.Data, data); err != nil {
+				return r, err
+			}
+			out.Events[i] = e
+		}
+	}
+	out.Body, err = walkJSONStrings(r.Body, func(v string) (string, error) {
+		return renderString(v, data)
+	})
+	if err != nil {
+		return r, err
+	}
+	return out, nil
+}
+
+func renderString(s string, data TemplateData) (string, error) {
+	t, err := ParseTemplate(s)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(data), nil
+}
+
+// walkJSONStrings calls fn for every string value of a JSON document and
+// returns the document with the strings fn returned. Keys, their order and
+// numbers are copied as is
+func walkJSONStrings(body json.RawMessage, fn func(string) (string, error)) (json.RawMessage, error) {
+	if len(body) == 0 {
+		return body, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	// one entry per open object or array, counting the tokens written in it
+	type level struct {
+		object bool
+		n      int
+	}
+	var stack []*level
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			out.WriteByte(byte(d))
+			continue
+		}
+		key := false
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			key = top.object && top.n%2 == 0
+			switch {
+			case key && top.n > 0, !top.object && top.n > 0:
+				out.WriteByte(',')
+			case top.object && !key:
+				out.WriteByte(':')
+			}
+			top.n++
+		}
+		if s, ok := tok.(string); ok && !key {
+			if tok, err = fn(s); err != nil {
+				return nil, err
+			}
+		}
+		switch v := tok.(type) {
+		case json.Delim:
+			out.WriteByte(byte(v))
+			stack = append(stack, &level{object: v == '{'})
+		case json.Number:
+			out.WriteString(v.String())
+		default:
+			if err := enc.Encode(v); err != nil {
+				return nil, err
+			}
+			// drop the newline Encode ends with
+			out.Truncate(out.Len() - 1)
+		}
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,117 @@
+package mockspec_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+func TestParseTemplate(t *testing.T) {
+	cases := []struct {
+		template  string
+		wantError bool
+	}{
+		{template: "plain text"},
+		{template: "{{request.params.id}}"},
+		{template: "user-{{ request.query.page }}-{{uuid}}"},
+		{template: "{{now unix}}"},
+		{template: "{{randomInt 1 10}}"},
+		{template: "{{faker.email}}"},
+		{template: "{{request.params.id", wantError: true},
+		{template: "{{}}", wantError: true},
+		{template: "{{request.params.}}", wantError: true},
+		{template: "{{now \"yesterday\"}}", wantError: true},
+		{template: "{{randomInt 10 1}}", wantError: true},
+		{template: "{{faker.unicorn}}", wantError: true},
+		{template: "{{env.HOME}}", wantError: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.template, func(t *testing.T) {
+			_, err := mockspec.ParseTemplate(c.template)
+			if c.wantError && err == nil {
+				t.Fatalf("expected an error for %q", c.template)
+			}
+			if !c.wantError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTemplateExecute(t *testing.T) {
+	data := mockspec.TemplateData{
+		Method:  "POST",
+		Path:    "/users/42",
+		Params:  map[string]string{"id": "42"},
+		Query:   url.Values{"page": []string{"3"}},
+		Headers: http.Header{"X-Request-Id": []string{"abc"}},
+		Body:    []byte(`{"user":{"name":"ada","tags":["a","b"]}}`),
+	}
+
+	cases := []struct {
+		template string
+		want     string
+	}{
+		{template: "{{request.params.id}}", want: "42"},
+		{template: "{{request.method}} {{request.path}}", want: "POST /users/42"},
+		{template: "page {{request.query.page}}", want: "page 3"},
+		{template: "{{request.headers.x-request-id}}", want: "abc"},
+		{template: "{{request.body.user.name}}", want: "ada"},
+		{template: "{{request.body.user.tags.1}}", want: "b"},
+		{template: "{{request.body.user.missing}}", want: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.template, func(t *testing.T) {
+			tmpl, err := mockspec.ParseTemplate(c.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := tmpl.Execute(data); got != c.want {
+				t.Fatalf("expected %q, but got %q", c.want, got)
+			}
+		})
+	}
+
+	tmpl, _ := mockspec.ParseTemplate("{{uuid}}")
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if got := tmpl.Execute(data); !uuid.MatchString(got) {
+		t.Fatalf("expected a v4 uuid, but got %q", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	res := mockspec.SpecBodyResponse{
+		SpecResponse: mockspec.SpecResponse{
+			Headers:  http.Header{"Location": []string{"/users/{{request.params.id}}"}},
+			Template: true,
+		},
+		Body: json.RawMessage(`{"id": "{{request.params.id}}", "count": 12345678901234567890, "items": ["{{request.method}}", null, {"a": "<{{request.method}}>"}]}`),
+	}
+	out, err := res.Render(mockspec.TemplateData{Method: "GET", Params: map[string]string{"id": "7"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Headers.Get("Location") != "/users/7" {
+		t.Fatalf("expected the Location header to be rendered, but got %q", out.Headers.Get("Location"))
+	}
+	// key order and number precision are kept
+	want := `{"id":"7","count":12345678901234567890,"items":["GET",null,{"a":"<GET>"}]}`
+	if string(out.Body) != want {
+		t.Fatalf("expected %s, but got %s", want, out.Body)
+	}
+	if !strings.Contains(string(res.Body), "{{request.params.id}}") {
+		t.Fatal("expected Render to leave the original response untouched")
+	}
+
+	text := mockspec.SpecBodyResponse{SpecResponse: mockspec.SpecResponse{Template: true}, BodyText: "id={{request.params.id}}"}
+	if out, _ := text.Render(mockspec.TemplateData{Params: map[string]string{"id": "7"}}); string(out.Bytes()) != "id=7" {
+		t.Fatalf("expected id=7, but got %s", out.Bytes())
+	}
+}
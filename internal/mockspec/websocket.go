@@ -0,0 +1,87 @@
+package mockspec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+)
+
+// Senders of WebSocket messages
+const (
+	FromClient = "client"
+	FromServer = "server"
+)
+
+// Types of WebSocket messages
+const (
+	MessageText   = "text"
+	MessageBinary = "binary"
+	MessageClose  = "close"
+)
+
+// SpecWebSocket is a WebSocket endpoint. The recorded conversation is
+// replayed to every client, and rules reply to the messages of the client
+type SpecWebSocket struct {
+	// Messages is a recorded conversation. Server messages are sent at their
+	// recorded times, client messages are waited for
+	Messages []SpecMessage `json:"messages,omitempty"`
+	// Rules reply to client messages, besides the conversation
+	Rules []SpecMessageRule `json:"rules,omitempty"`
+}
+
+// SpecMessage is a WebSocket message
+type SpecMessage struct {
+	// At is the time the message was sent, in milliseconds after the
+	// connection opened
+	At   int64  `json:"at"`
+	From string `json:"from"`
+	// Type is MessageText by default. Binary data is base64 encoded, close
+	// messages have a close code and the reason as data
+	Type string `json:"type,omitempty"`
+	Data string `json:"data,omitempty"`
+	Code int    `json:"code,omitempty"`
+}
+
+// SpecMessageRule replies to every text message of the client that matches
+// the regular expression Match. An empty Match matches every message
+type SpecMessageRule struct {
+	Match string `json:"match,omitempty"`
+	Reply string `json:"reply"`
+}
+
+// Bytes returns the payload of a text or binary message
+func (m SpecMessage) Bytes() ([]byte, error) {
+	if m.Type == MessageBinary {
+		return base64.StdEncoding.DecodeString(m.Data)
+	}
+	return []byte(m.Data), nil
+}
+
+// Matches reports whether the rule replies to a message
+func (r SpecMessageRule) Matches(message string) bool {
+	ok, _ := regexp.MatchString(r.Match, message)
+	return ok
+}
+
+func (w SpecWebSocket) Validate() error {
+	for i, m := range w.Messages {
+		if m.From != FromClient && m.From != FromServer {
+			return fmt.Errorf("websocket: message %d must be from %s or %s", i, FromClient, FromServer)
+		}
+		switch m.Type {
+		case "", MessageText, MessageClose:
+		case MessageBinary:
+			if _, err := m.Bytes(); err != nil {
+				return fmt.Errorf("websocket: message %d: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("websocket: message %d has unknown type %s", i, m.Type)
+		}
+	}
+	for i, r := range w.Rules {
+		if _, err := regexp.Compile(r.Match); err != nil {
+			return fmt.Errorf("websocket: rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
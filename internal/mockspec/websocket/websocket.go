@@ -0,0 +1,94 @@
+// Package websocket records WebSocket conversations as messages with their
+// sender and timing
+package websocket
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+// Writer logs the messages of a connection. Record is called for every
+// message while the connection is open, WriteResponse writes the spec once
+// it closed
+type Writer struct {
+	w     io.WriteCloser
+	start time.Time
+	mu    sync.Mutex
+	spec  mockspec.Spec
+}
+
+var _ mockspec.MockWriter = (*Writer)(nil)
+
+// New returns a writer for a connection that opens now
+func New(w io.WriteCloser) *Writer {
+	return &Writer{
+		w:     w,
+		start: time.Now(),
+		spec:  mockspec.Spec{WebSocket: &mockspec.SpecWebSocket{}},
+	}
+}
+
+// Record logs a message, typ is one of the mockspec message types
+func (w *Writer) Record(from, typ string, data []byte) {
+	m := mockspec.SpecMessage{
+		At:   time.Since(w.start).Milliseconds(),
+		From: from,
+		Data: string(data),
+	}
+	if typ != mockspec.MessageText {
+		m.Type = typ
+	}
+	if typ == mockspec.MessageBinary {
+		m.Data = base64.StdEncoding.EncodeToString(data)
+	}
+	w.append(m)
+}
+
+// RecordClose logs a close message
+func (w *Writer) RecordClose(from string, code int, reason string) {
+	w.append(mockspec.SpecMessage{
+		At:   time.Since(w.start).Milliseconds(),
+		From: from,
+		Type: mockspec.MessageClose,
+		Data: reason,
+		Code: code,
+	})
+}
+
+func (w *Writer) append(m mockspec.SpecMessage) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.spec.WebSocket.Messages = append(w.spec.WebSocket.Messages, m)
+}
+
+// WriteResponse writes the spec with the handshake response of the upstream
+func (w *Writer) WriteResponse(res *http.Response) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// the handshake headers are negotiated again on replay
+	header := res.Header.Clone()
+	for _, name := range []string{"Connection", "Upgrade", "Sec-Websocket-Accept", "Sec-Websocket-Extensions"} {
+		header.Del(name)
+	}
+	w.spec.SpecVersion = mockspec.SpecVersion
+	w.spec.Request.Headers = header
+	w.spec.Request.RequestPath = res.Request.URL.Path
+	w.spec.Request.Method = http.MethodGet
+	w.spec.Response.Status = res.StatusCode
+	w.spec.Response.Headers = header
+
+	enc := json.NewEncoder(w.w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(" ", " ")
+	return enc.Encode(w.spec)
+}
+
+func (w *Writer) Close() error {
+	return w.w.Close()
+}
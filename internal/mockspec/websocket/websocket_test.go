@@ -0,0 +1,63 @@
+package websocket_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/protomoks/pmok/internal/mockspec/websocket"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+func TestWriter(t *testing.T) {
+	var out buffer
+	w := websocket.New(&out)
+	w.Record(mockspec.FromServer, mockspec.MessageText, []byte("hello"))
+	w.Record(mockspec.FromClient, mockspec.MessageBinary, []byte{1, 2})
+	w.RecordClose(mockspec.FromClient, 1000, "bye")
+	res := &http.Response{
+		StatusCode: http.StatusSwitchingProtocols,
+		Header:     http.Header{"Upgrade": []string{"websocket"}, "Sec-Websocket-Accept": []string{"x"}, "X-Request-Id": []string{"1"}},
+		Request:    &http.Request{URL: &url.URL{Path: "/socket"}},
+	}
+	if err := w.WriteResponse(res); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, err := mockspec.Load(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("expected a valid spec, but got %v", err)
+	}
+	want := []mockspec.SpecMessage{
+		{From: "server", Data: "hello"},
+		{From: "client", Type: "binary", Data: "AQI="},
+		{From: "client", Type: "close", Data: "bye", Code: 1000},
+	}
+	got := s.WebSocket.Messages
+	if len(got) != len(want) {
+		t.Fatalf("expected %d messages, but got %+v", len(want), got)
+	}
+	for i := range want {
+		got[i].At = 0
+		if got[i] != want[i] {
+			t.Fatalf("expected %+v, but got %+v", want[i], got[i])
+		}
+	}
+	if s.Request.Method != "GET" || s.Request.RequestPath != "/socket" {
+		t.Fatalf("expected GET /socket, but got %+v", s.Request)
+	}
+	if s.Response.Headers.Get("Upgrade") != "" || s.Response.Headers.Get("X-Request-Id") != "1" {
+		t.Fatalf("expected only the handshake headers to be dropped, but got %v", s.Response.Headers)
+	}
+}
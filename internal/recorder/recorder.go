@@ -3,58 +3,90 @@ package recorder
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/grpcmock"
 	"github.com/protomoks/pmok/internal/mockspec"
 	"github.com/protomoks/pmok/internal/mockspec/json"
 	"github.com/protomoks/pmok/internal/mockspec/mimetypes"
+	"github.com/protomoks/pmok/internal/mockspec/stream"
+	wsspec "github.com/protomoks/pmok/internal/mockspec/websocket"
 	"github.com/protomoks/pmok/internal/utils/constants"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Bodies larger than MaxBodySize are handled as LargeBodies says
+const (
+	LargeBodiesFile = "file"
+	LargeBodiesSkip = "skip"
+)
+
+const (
+	DefaultMaxBodySize = 1 << 20
+	DefaultQueueSize   = 64
 )
 
 type RecordCommand struct {
 	Target        string
 	ResponsesPath string
+	// MaxBodySize is the largest body stored in a spec, DefaultMaxBodySize if 0
+	MaxBodySize int64
+	// LargeBodies is LargeBodiesFile, the default, or LargeBodiesSkip
+	LargeBodies string
+	// QueueSize is the number of responses waiting to be written before
+	// requests wait for the writer, DefaultQueueSize if 0
+	QueueSize int
+	// Grpc resolves the recorded gRPC methods, gRPC calls are proxied without
+	// recording when it has no method
+	Grpc *grpcmock.Registry
+	// GraphqlPath is the path of the GraphQL endpoint, whose operations get a
+	// mock each. constants.GraphqlDefaultPath if empty
+	GraphqlPath string
 }
 
 func (c RecordCommand) Valid() error {
 	if c.Target == "" {
 		return errors.New("target is required")
 	}
+	switch c.LargeBodies {
+	case "", LargeBodiesFile, LargeBodiesSkip:
+	default:
+		return fmt.Errorf("large bodies must be %s or %s, not %s", LargeBodiesFile, LargeBodiesSkip, c.LargeBodies)
+	}
+	if c.MaxBodySize < 0 || c.QueueSize < 0 {
+		return errors.New("max body size and queue size cannot be negative")
+	}
 	return nil
 }
 
+// Run records the responses of command.Target on the recorder port until ctx
+// is done
 func Run(ctx context.Context, command RecordCommand) error {
-	if err := command.Valid(); err != nil {
-		return err
-	}
-
-	if err := config.CreateMocksDirIfNotExist(command.ResponsesPath); err != nil {
+	rec, err := New(ctx, command)
+	if err != nil {
 		return err
 	}
 
-	rec := &recorder{
-		targetUrl:  command.Target,
-		targetDir:  filepath.Join(config.MocksDir, command.ResponsesPath),
-		ctx:        ctx,
-		workerChan: make(chan targetResponse),
-	}
-
 	server := http.Server{
-		Addr:    fmt.Sprintf(":%d", constants.RecorderDefaultPort),
-		Handler: rec,
+		Addr: fmt.Sprintf(":%d", constants.RecorderDefaultPort),
+		// gRPC clients speak HTTP/2 without TLS
+		Handler: h2c.NewHandler(rec, &http2.Server{}),
 	}
 
-	// start the background worker
-	done := make(chan bool)
-	go rec.processResponses(done)
-
 	serverErr := make(chan error, 1)
 	// start the recorder
 	go func() {
@@ -70,109 +102,668 @@ func Run(ctx context.Context, command RecordCommand) error {
 		if err := server.Shutdown(ctxShutdown); err != nil {
 			return fmt.Errorf("failed to shut down recorder gracefully %w", err)
 		}
-		// stop the worker
-		close(done)
+		// stop the worker once the queued responses are written
+		rec.Close()
+		fmt.Println(rec.Stats())
 	case err := <-serverErr:
-		close(done)
+		rec.Close()
 		return fmt.Errorf("server error %w", err)
 	}
 	return nil
 }
 
-type recorder struct {
-	targetUrl  string
-	targetDir  string
-	ctx        context.Context
-	workerChan chan targetResponse
+// New returns a recorder of the responses of command.Target and starts the
+// writer of their mocks. Mocks are written below the mocks directory of the
+// working directory
+func New(ctx context.Context, command RecordCommand) (*Recorder, error) {
+	if err := command.Valid(); err != nil {
+		return nil, err
+	}
+
+	if err := config.CreateMocksDirIfNotExist(command.ResponsesPath); err != nil {
+		return nil, err
+	}
+
+	rec := &Recorder{
+		targetUrl:   command.Target,
+		targetDir:   filepath.Join(config.MocksDir, command.ResponsesPath),
+		ctx:         ctx,
+		maxBodySize: command.MaxBodySize,
+		skipLarge:   command.LargeBodies == LargeBodiesSkip,
+		grpc:        command.Grpc,
+		graphqlPath: command.GraphqlPath,
+		grpcClient:  &http.Client{Transport: grpcTransport(command.Target)},
+		// bodies reach the client with the encoding the target sent. The
+		// transport would otherwise ask for gzip and decode it itself
+		client: &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DisableCompression: true}},
+	}
+	if rec.maxBodySize == 0 {
+		rec.maxBodySize = DefaultMaxBodySize
+	}
+	if rec.graphqlPath == "" {
+		rec.graphqlPath = constants.GraphqlDefaultPath
+	}
+	queueSize := command.QueueSize
+	if queueSize == 0 {
+		queueSize = DefaultQueueSize
+	}
+	rec.queue = make(chan targetResponse, queueSize)
+
+	// start the background worker
+	rec.done = make(chan bool)
+	rec.finished = make(chan struct{})
+	go rec.processResponses(rec.done, rec.finished)
+	return rec, nil
+}
+
+// Close writes the queued responses and stops the writer. The recorder must
+// not serve requests anymore
+func (rec *Recorder) Close() {
+	close(rec.done)
+	<-rec.finished
 }
 
+// Stats returns what happened to the responses proxied so far
+func (rec *Recorder) Stats() Stats {
+	return Stats{
+		Recorded: rec.stats.recorded.Load(),
+		Skipped:  rec.stats.skipped.Load(),
+		Failed:   rec.stats.failed.Load(),
+		Waits:    rec.stats.waits.Load(),
+		MaxQueue: rec.stats.maxQueue.Load(),
+	}
+}
+
+// Recorder proxies requests to a target and records the responses as mocks
+type Recorder struct {
+	targetUrl   string
+	targetDir   string
+	ctx         context.Context
+	maxBodySize int64
+	skipLarge   bool
+	queue       chan targetResponse
+	stats       stats
+	grpc        *grpcmock.Registry
+	grpcClient  *http.Client
+	client      *http.Client
+	graphqlPath string
+	done        chan bool
+	finished    chan struct{}
+}
+
+// targetResponse is a proxied response waiting to be written. Its body is
+// in the file at bodyPath
 type targetResponse struct {
 	response *http.Response
+	bodyPath string
+}
+
+// Stats counts what happened to the proxied responses
+type Stats struct {
+	Recorded int64
+	Skipped  int64
+	Failed   int64
+	// Waits counts the requests that found the write queue full
+	Waits int64
+	// MaxQueue is the most responses the write queue held
+	MaxQueue int64
 }
 
-func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (s Stats) String() string {
+	return fmt.Sprintf("Recorded %d responses, skipped %d, failed %d. The write queue was full %d times and held at most %d responses",
+		s.Recorded, s.Skipped, s.Failed, s.Waits, s.MaxQueue)
+}
+
+type stats struct {
+	recorded atomic.Int64
+	skipped  atomic.Int64
+	failed   atomic.Int64
+	// waits counts the requests that found the queue full
+	waits    atomic.Int64
+	maxQueue atomic.Int64
+}
+
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Received a request")
+	if websocket.IsWebSocketUpgrade(r) {
+		rec.recordWebSocket(w, r)
+		return
+	}
+	if grpcmock.IsGrpc(r.Header.Get("Content-Type")) {
+		rec.recordGrpc(w, r)
+		return
+	}
 	url := rec.targetUrl + r.URL.Path
-	proxyr, err := http.NewRequestWithContext(rec.ctx, r.Method, url, r.Body)
+	ctx, reqBody, err := rec.graphqlContext(r)
+	if err != nil {
+		fmt.Printf("Error when reading request to %s. Error %s\n", url, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	proxyr, err := http.NewRequestWithContext(ctx, r.Method, url, reqBody)
 	if err != nil {
 		fmt.Printf("Error when creating request to %s\n", url)
 		return
 	}
-	client := &http.Client{}
 	proxyr.Header = r.Header
 
-	res, err := client.Do(proxyr)
+	res, err := rec.client.Do(proxyr)
 	if err != nil {
 		fmt.Printf("Error when receiving response for %s . Error %s\n", url, err)
 		return
 	}
+	defer res.Body.Close()
 
 	fmt.Printf("Header %s\n", res.Header.Get("Content-Type"))
-	clonedRes, err := cloneResponse(res)
+	// the client gets the upstream response as is, encoding included
+	for name, values := range res.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(res.StatusCode)
+
+	if stream.IsStream(res.Header.Get("Content-Type")) {
+		rec.recordStream(w, res)
+		return
+	}
+	if !recordable(res) {
+		// nothing to spool, the body goes straight to the client
+		fmt.Printf("Skipping %s, content type %q is not recorded\n", r.URL.Path, res.Header.Get("Content-Type"))
+		rec.stats.skipped.Add(1)
+		io.Copy(w, res.Body)
+		return
+	}
+
+	file, err := os.CreateTemp(rec.targetDir, ".record-*.tmp")
 	if err != nil {
-		fmt.Printf("Error when cloning response for %s\n", url)
+		fmt.Printf("Error when recording %s. Error %s\n", r.URL.Path, err)
+		rec.stats.failed.Add(1)
+		io.Copy(w, res.Body)
 		return
 	}
+	body := &capture{file: file, limit: -1}
+	if rec.skipLarge {
+		// the limit applies to the encoded body, the writer checks the
+		// decoded body again
+		body.limit = rec.maxBodySize
+	}
+	// the body streams to the client and to disk at the same time
+	_, err = io.Copy(w, io.TeeReader(res.Body, body))
+	if cerr := file.Close(); body.err == nil {
+		body.err = cerr
+	}
+	switch {
+	case err != nil:
+		fmt.Printf("Error when proxying %s. Error %s\n", url, err)
+		rec.stats.failed.Add(1)
+	case body.err != nil:
+		fmt.Printf("Error when recording %s. Error %s\n", r.URL.Path, body.err)
+		rec.stats.failed.Add(1)
+	case body.overflow:
+		fmt.Printf("Skipping %s, the body is larger than %d bytes\n", r.URL.Path, rec.maxBodySize)
+		rec.stats.skipped.Add(1)
+	default:
+		rec.enqueue(targetResponse{response: res, bodyPath: file.Name()})
+		return
+	}
+	os.Remove(file.Name())
+}
 
-	defer res.Body.Close()
+// recordStream proxies an event stream, flushing every chunk to the client.
+// Streams skip the write queue, their events are timestamped while they
+// arrive
+func (rec *Recorder) recordStream(w http.ResponseWriter, res *http.Response) {
+	path := res.Request.URL.Path
+	file, err := createSpec(rec.mockFileName(res))
+	if err != nil {
+		fmt.Printf("Error when recording %s. Error %s\n", path, err)
+		rec.stats.failed.Add(1)
+		io.Copy(flushWriter{w}, res.Body)
+		return
+	}
+	opts := []stream.Option{}
+	if rec.skipLarge {
+		opts = append(opts, stream.WithMaxSize(rec.maxBodySize))
+	}
+	mw := stream.New(file, opts...)
+
+	pr, pw := io.Pipe()
+	recorded := *res
+	recorded.Header = res.Header.Clone()
+	// the writer may stop early, the pipe is drained so the client never waits
+	recorded.Body = io.NopCloser(pr)
+	written := make(chan error, 1)
+	go func() {
+		err := mw.WriteResponse(&recorded)
+		io.Copy(io.Discard, pr)
+		written <- err
+	}()
 
-	rec.workerChan <- targetResponse{
-		response: clonedRes,
+	_, err = io.Copy(flushWriter{w}, io.TeeReader(res.Body, pw))
+	pw.CloseWithError(err)
+	werr := <-written
+	mw.Close()
+	if err != nil {
+		fmt.Printf("Error when proxying %s. Error %s\n", path, err)
+		werr = err
 	}
-	io.Copy(w, res.Body)
+	rec.finish(res, file.Name(), rec.mockFileName(res), werr)
+}
+
+type graphqlKey struct{}
 
+// graphqlContext reads the GraphQL operation of a request to the GraphQL
+// path, so every operation sent to it gets its own mock. Bodies are read up
+// front and returned for the upstream request
+func (rec *Recorder) graphqlContext(r *http.Request) (context.Context, io.Reader, error) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.URL.Path != rec.graphqlPath {
+		return rec.ctx, r.Body, nil
+	}
+	if r.Method != http.MethodGet && contentType != mimetypes.ContentTypeJSON && contentType != "application/graphql" {
+		return rec.ctx, r.Body, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	g, ok := mockspec.ParseGraphqlRequest(r, body)
+	if !ok {
+		return rec.ctx, bytes.NewReader(body), nil
+	}
+	return context.WithValue(rec.ctx, graphqlKey{}, g), bytes.NewReader(body), nil
+}
+
+// graphqlOf returns the GraphQL operation of a proxied request
+func graphqlOf(r *http.Request) (mockspec.GraphqlRequest, bool) {
+	g, ok := r.Context().Value(graphqlKey{}).(mockspec.GraphqlRequest)
+	return g, ok
 }
 
-func cloneResponse(res *http.Response) (*http.Response, error) {
-	var bodyBuf bytes.Buffer
-	tee := io.TeeReader(res.Body, &bodyBuf)
-	// populate the bodyBuf with the body response
-	_, err := io.ReadAll(tee)
+// grpcTransport returns an HTTP/2 transport for target. Plain text targets
+// are reached with h2c
+func grpcTransport(target string) *http2.Transport {
+	if strings.HasPrefix(target, "https://") {
+		return &http2.Transport{}
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// recordGrpc proxies a gRPC call over HTTP/2 and records its response
+// messages and status. Calls skip the write queue, their status is only
+// known from the trailers once the response ended
+func (rec *Recorder) recordGrpc(w http.ResponseWriter, r *http.Request) {
+	url := rec.targetUrl + r.URL.Path
+	proxyr, err := http.NewRequestWithContext(rec.ctx, r.Method, url, r.Body)
 	if err != nil {
+		fmt.Printf("Error when creating request to %s\n", url)
+		return
+	}
+	proxyr.Header = r.Header.Clone()
+
+	res, err := rec.grpcClient.Do(proxyr)
+	if err != nil {
+		fmt.Printf("Error when receiving response for %s . Error %s\n", url, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	for name, values := range res.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(res.StatusCode)
+
+	md, ok := rec.grpc.Method(r.URL.Path)
+	if !ok {
+		fmt.Printf("Skipping %s, the method is not in the gRPC services of the manifest\n", r.URL.Path)
+		rec.stats.skipped.Add(1)
+		io.Copy(flushWriter{w}, res.Body)
+		copyTrailers(w, res)
+		return
+	}
+	name := filepath.Join(rec.targetDir, grpcmock.MockFileName(r.URL.Path))
+	file, err := rec.createGrpcSpec(name)
+	if err != nil {
+		fmt.Printf("Error when recording %s. Error %s\n", r.URL.Path, err)
+		rec.stats.failed.Add(1)
+		io.Copy(flushWriter{w}, res.Body)
+		copyTrailers(w, res)
+		return
+	}
+	// messages have no body file, larger calls are always skipped
+	mw := grpcmock.NewWriter(file, md, grpcmock.WithMaxSize(rec.maxBodySize))
+
+	pr, pw := io.Pipe()
+	recorded := *res
+	// the writer may stop early, the pipe is drained so the client never waits
+	recorded.Body = io.NopCloser(pr)
+	written := make(chan error, 1)
+	go func() {
+		err := mw.WriteResponse(&recorded)
+		io.Copy(io.Discard, pr)
+		written <- err
+	}()
+
+	// messages of streaming calls reach the client as they arrive
+	_, err = io.Copy(flushWriter{w}, io.TeeReader(res.Body, pw))
+	copyTrailers(w, res)
+	// trailers are only known once the body ended, closing the pipe hands
+	// them to the writer
+	recorded.Trailer = res.Trailer
+	pw.CloseWithError(err)
+	werr := <-written
+	mw.Close()
+	if err != nil {
+		fmt.Printf("Error when proxying %s. Error %s\n", url, err)
+		werr = err
+	}
+	rec.finish(res, file.Name(), name, werr)
+}
+
+// createGrpcSpec creates the directory of gRPC specs and the file the spec at
+// name is written to
+func (rec *Recorder) createGrpcSpec(name string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
 		return nil, err
 	}
-	res.Body.Close()
-	// restore the body
-	res.Body = io.NopCloser(&bodyBuf)
-	// clone the response
-	clone := *res
-	// add response to the clone
-	clone.Body = io.NopCloser(bytes.NewBuffer(bodyBuf.Bytes()))
-	return &clone, nil
+	return createSpec(name)
+}
+
+// copyTrailers sends the trailers of an upstream gRPC response to the client
+func copyTrailers(w http.ResponseWriter, res *http.Response) {
+	for name, values := range res.Trailer {
+		w.Header()[http.TrailerPrefix+name] = values
+	}
 }
 
-func (rec *recorder) processResponses(done <-chan bool) {
+// hopHeaders are set by the dialer of the upstream WebSocket connection
+var hopHeaders = []string{"Connection", "Upgrade", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol"}
+
+// recordWebSocket proxies a WebSocket connection and logs the messages of
+// both sides until one of them closes the connection
+func (rec *Recorder) recordWebSocket(w http.ResponseWriter, r *http.Request) {
+	// http://host becomes ws://host and https://host wss://host
+	url := "ws" + strings.TrimPrefix(rec.targetUrl, "http") + r.URL.Path
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	header := r.Header.Clone()
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+	dialer := websocket.Dialer{Subprotocols: websocket.Subprotocols(r)}
+	upstream, res, err := dialer.DialContext(rec.ctx, url, header)
+	if err != nil {
+		fmt.Printf("Error when connecting to %s. Error %s\n", url, err)
+		if res == nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		// the upstream refused the upgrade, the client gets its answer
+		for name, values := range res.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+		return
+	}
+	defer upstream.Close()
+
+	upgrader := websocket.Upgrader{
+		// the recorder proxies any origin, like it does for plain requests
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+	if p := upstream.Subprotocol(); p != "" {
+		upgrader.Subprotocols = []string{p}
+	}
+	client, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Printf("Error when upgrading %s. Error %s\n", r.URL.Path, err)
+		return
+	}
+	defer client.Close()
+
+	res.Request = r
+	file, err := createSpec(rec.mockFileName(res))
+	if err != nil {
+		fmt.Printf("Error when recording %s. Error %s\n", r.URL.Path, err)
+		rec.stats.failed.Add(1)
+	}
+	var mw *wsspec.Writer
+	if file != nil {
+		mw = wsspec.New(file)
+	}
+
+	done := make(chan struct{}, 2)
+	go rec.pump(mw, mockspec.FromClient, client, upstream, done)
+	go rec.pump(mw, mockspec.FromServer, upstream, client, done)
+	// once a side closed, closing both connections ends the other pump
+	<-done
+	client.Close()
+	upstream.Close()
+	<-done
+	if mw == nil {
+		return
+	}
+	err = mw.WriteResponse(res)
+	mw.Close()
+	rec.finish(res, file.Name(), rec.mockFileName(res), err)
+}
+
+// pump forwards the messages of src to dst and logs them
+func (rec *Recorder) pump(mw *wsspec.Writer, from string, src, dst *websocket.Conn, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
 	for {
-		select {
-		case res := <-rec.workerChan:
-			mw, err := rec.getMockWriterFromTargetResponse(res.response)
-			if err != nil {
-				continue
+		typ, data, err := src.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			// abnormal closures are not sent on the wire, there is nothing to
+			// replay or forward
+			if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure {
+				if mw != nil {
+					mw.RecordClose(from, closeErr.Code, closeErr.Text)
+				}
+				dst.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeErr.Code, closeErr.Text))
 			}
-			if err := mw.WriteResponse(res.response); err != nil {
-				continue
+			return
+		}
+		if mw != nil {
+			name := mockspec.MessageText
+			if typ == websocket.BinaryMessage {
+				name = mockspec.MessageBinary
 			}
-			mw.Close()
-		case <-done:
-			fmt.Println("worker shutting down")
+			mw.Record(from, name, data)
+		}
+		if err := dst.WriteMessage(typ, data); err != nil {
 			return
 		}
 	}
 }
 
-func (rec *recorder) getMockWriterFromTargetResponse(res *http.Response) (mockspec.MockWriter, error) {
-	contentType := res.Header.Get("Content-Type")
-	var mw mockspec.MockWriter
-	name := filepath.Join(rec.targetDir, mockspec.MockFileNameFromPath(res.Request.URL.Path))
+// flushWriter sends every write to the client right away
+type flushWriter struct {
+	w http.ResponseWriter
+}
 
-	switch contentType {
-	case mimetypes.ContentTypeJSON:
-		file, err := os.Create(name)
-		if err != nil {
-			return nil, err
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+// capture writes a copy of the body to disk. It never fails so that the
+// client always gets the full response, problems are kept in err
+type capture struct {
+	file *os.File
+	// limit is the largest body kept, -1 for no limit
+	limit    int64
+	n        int64
+	overflow bool
+	err      error
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	if c.err != nil || c.overflow {
+		return len(p), nil
+	}
+	if c.limit >= 0 && c.n+int64(len(p)) > c.limit {
+		c.overflow = true
+		return len(p), nil
+	}
+	n, err := c.file.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return len(p), nil
+}
+
+// enqueue hands a response to the writer. When the queue is full the request
+// waits, which slows the client down instead of buffering without bounds
+func (rec *Recorder) enqueue(res targetResponse) {
+	select {
+	case rec.queue <- res:
+	default:
+		rec.stats.waits.Add(1)
+		select {
+		case rec.queue <- res:
+		case <-rec.ctx.Done():
+			os.Remove(res.bodyPath)
+			rec.stats.failed.Add(1)
+			return
+		}
+	}
+	n := int64(len(rec.queue))
+	for {
+		top := rec.stats.maxQueue.Load()
+		if n <= top || rec.stats.maxQueue.CompareAndSwap(top, n) {
+			return
+		}
+	}
+}
+
+func (rec *Recorder) processResponses(done <-chan bool, finished chan<- struct{}) {
+	defer close(finished)
+	for {
+		select {
+		case res := <-rec.queue:
+			rec.write(res)
+		case <-done:
+			// the server is shut down, write what is left
+			for {
+				select {
+				case res := <-rec.queue:
+					rec.write(res)
+				default:
+					fmt.Println("worker shutting down")
+					return
+				}
+			}
 		}
-		mw = json.New(file)
 	}
+}
 
-	return mw, nil
+func (rec *Recorder) write(res targetResponse) {
+	defer os.Remove(res.bodyPath)
+	path := res.response.Request.URL.Path
+	body, err := os.Open(res.bodyPath)
+	if err != nil {
+		fmt.Printf("Error when recording %s. Error %s\n", path, err)
+		rec.stats.failed.Add(1)
+		return
+	}
+	res.response.Body = body
+	defer body.Close()
+
+	mw, tmp, err := rec.getMockWriterFromTargetResponse(res.response)
+	if err != nil {
+		fmt.Printf("Error when creating mock for %s. Error %s\n", path, err)
+		rec.stats.failed.Add(1)
+		return
+	}
+	if mw == nil {
+		fmt.Printf("Skipping %s, content type %q is not recorded\n", path, res.response.Header.Get("Content-Type"))
+		rec.stats.skipped.Add(1)
+		return
+	}
+	err = mw.WriteResponse(res.response)
+	mw.Close()
+	rec.finish(res.response, tmp, rec.mockFileName(res.response), err)
+}
+
+// createSpec creates the file a spec is written to before it replaces the
+// spec at name, see finish
+func createSpec(name string) (*os.File, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	// specs are shared like the rest of the project, not private temp files
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// finish counts a written mock. The spec written to tmp replaces the spec at
+// name only when writing succeeded, a skipped or failed recording keeps it
+func (rec *Recorder) finish(res *http.Response, tmp, name string, err error) {
+	path := res.Request.URL.Path
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	switch {
+	case errors.Is(err, mockspec.ErrBodyTooLarge):
+		fmt.Printf("Skipping %s, the body is larger than %d bytes\n", path, rec.maxBodySize)
+		rec.stats.skipped.Add(1)
+	case err != nil:
+		fmt.Printf("Error when recording %s. Error %s\n", path, err)
+		rec.stats.failed.Add(1)
+	default:
+		rec.stats.recorded.Add(1)
+		return
+	}
+	os.Remove(tmp)
+}
+
+func (rec *Recorder) mockFileName(res *http.Response) string {
+	if g, ok := graphqlOf(res.Request); ok {
+		return filepath.Join(rec.targetDir, mockspec.GraphqlFileName(res.Request.URL.Path, g))
+	}
+	return filepath.Join(rec.targetDir, mockspec.MockFileNameFromPath(res.Request.URL.Path))
+}
+
+// recordable reports whether responses of the content type of res are
+// recorded. Parameters such as charset do not matter
+func recordable(res *http.Response) bool {
+	contentType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return contentType == mimetypes.ContentTypeJSON
+}
+
+// getMockWriterFromTargetResponse returns the writer of the spec of res and
+// the temporary file it writes to, no writer if res is not recorded
+func (rec *Recorder) getMockWriterFromTargetResponse(res *http.Response) (mockspec.MockWriter, string, error) {
+	if !recordable(res) {
+		return nil, "", nil
+	}
+	name := rec.mockFileName(res)
+	file, err := createSpec(name)
+	if err != nil {
+		return nil, "", err
+	}
+	opts := []json.Option{json.WithMaxInline(rec.maxBodySize)}
+	if !rec.skipLarge {
+		opts = append(opts, json.WithBodyFile(mockspec.BodyFileName(name)))
+	}
+	if g, ok := graphqlOf(res.Request); ok {
+		opts = append(opts, json.WithGraphql(g))
+	}
+	return json.New(file, opts...), file.Name(), nil
 }
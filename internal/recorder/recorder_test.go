@@ -0,0 +1,473 @@
+package recorder_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/grpcmock"
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/protomoks/pmok/internal/recorder"
+	"github.com/protomoks/pmok/internal/testutil"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const existingMock = `{"request": {"method": "GET", "path": "/big"}, "response": {"status": 200, "headers": {}, "body": {"kept": true}}}`
+
+// newRecorder starts a recorder of upstream in a new project, with the
+// project files of files. It returns the proxy and the mocks directory
+func newRecorder(t *testing.T, upstream http.Handler, command recorder.RecordCommand, files map[string]string) (*httptest.Server, *recorder.Recorder, string) {
+	t.Helper()
+	root := testutil.NewProject(t, files)
+	testutil.Chdir(t, root)
+	up := httptest.NewServer(upstream)
+	t.Cleanup(up.Close)
+
+	command.Target = up.URL
+	rec, err := recorder.New(context.Background(), command)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// like pmok record, gRPC clients talk HTTP/2 without TLS to the proxy
+	proxy := httptest.NewServer(h2c.NewHandler(rec, &http2.Server{}))
+	t.Cleanup(proxy.Close)
+	return proxy, rec, filepath.Join(root, "protomok", "mocks")
+}
+
+func jsonHandler(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, []byte) {
+	t.Helper()
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return res, body
+}
+
+func readSpec(t *testing.T, p string) mockspec.Spec {
+	t.Helper()
+	s, err := mockspec.ReadFile(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return s
+}
+
+func compact(t *testing.T, b []byte) string {
+	t.Helper()
+	if len(b) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return buf.String()
+}
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, s)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestRecord(t *testing.T) {
+	body := `{"id":12345678901234567890,"b":1,"a":2}`
+	proxy, rec, mocks := newRecorder(t, jsonHandler(body), recorder.RecordCommand{}, nil)
+
+	_, got := get(t, http.DefaultClient, proxy.URL+"/users")
+	if string(got) != body {
+		t.Fatalf("expected the upstream body, but got %s", got)
+	}
+	rec.Close()
+
+	s := readSpec(t, filepath.Join(mocks, "_users.json"))
+	if compact(t, s.Response.Body) != body || s.Request.Method != "GET" || s.Request.RequestPath != "/users" {
+		t.Fatalf("expected the response to be recorded as is, but got %+v", s)
+	}
+	if stats := rec.Stats(); stats.Recorded != 1 {
+		t.Fatalf("expected 1 recorded response, but got %s", stats)
+	}
+}
+
+func TestRecordLargeBodies(t *testing.T) {
+	large := `{"items": "` + strings.Repeat("x", 100) + `"}`
+	tests := []struct {
+		name     string
+		command  recorder.RecordCommand
+		upstream http.HandlerFunc
+		// the body of the mock of /big after recording, in the spec or its
+		// body file
+		want     string
+		bodyFile string
+		skipped  int64
+	}{
+		{
+			name:     "body file",
+			command:  recorder.RecordCommand{MaxBodySize: 16},
+			upstream: jsonHandler(large),
+			bodyFile: large,
+		},
+		{
+			name:     "skip keeps the previous mock",
+			command:  recorder.RecordCommand{MaxBodySize: 16, LargeBodies: recorder.LargeBodiesSkip},
+			upstream: jsonHandler(large),
+			want:     `{"kept":true}`,
+			skipped:  1,
+		},
+		{
+			// the encoded body fits, the writer finds the decoded body too large
+			name:    "skip decoded body keeps the previous mock",
+			command: recorder.RecordCommand{MaxBodySize: 64, LargeBodies: recorder.LargeBodiesSkip},
+			upstream: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Write(gzipped(large))
+			},
+			want:    `{"kept":true}`,
+			skipped: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, rec, mocks := newRecorder(t, tt.upstream, tt.command, map[string]string{"mocks/_big.json": existingMock})
+			get(t, http.DefaultClient, proxy.URL+"/big")
+			rec.Close()
+
+			s := readSpec(t, filepath.Join(mocks, "_big.json"))
+			if tt.bodyFile == "" && compact(t, s.Response.Body) != tt.want {
+				t.Fatalf("expected body %s, but got %s", tt.want, s.Response.Body)
+			}
+			if tt.bodyFile != "" {
+				b, err := os.ReadFile(filepath.Join(mocks, s.Response.BodyFile))
+				if err != nil || string(b) != tt.bodyFile {
+					t.Fatalf("expected the body in %s, but got %s %v", s.Response.BodyFile, b, err)
+				}
+			}
+			if stats := rec.Stats(); stats.Skipped != tt.skipped {
+				t.Fatalf("expected %d skipped responses, but got %s", tt.skipped, stats)
+			}
+			// no temporary files are left behind
+			entries, _ := os.ReadDir(mocks)
+			for _, e := range entries {
+				if strings.HasSuffix(e.Name(), ".tmp") {
+					t.Fatalf("expected no temporary files, but got %s", e.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestRecordGzip(t *testing.T) {
+	body := `{"compressed":true}`
+	encoded := gzipped(body)
+	upstream := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(encoded)
+	}
+	// the client gets the encoded body as the upstream sent it, whether it
+	// asked for gzip or not
+	for _, accept := range []string{"gzip", ""} {
+		proxy, rec, mocks := newRecorder(t, http.HandlerFunc(upstream), recorder.RecordCommand{}, nil)
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/data", nil)
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+		res, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.Header.Get("Content-Encoding") != "gzip" || !bytes.Equal(got, encoded) {
+			t.Fatalf("Accept-Encoding %q: expected the gzip body to pass through, but got %q %q", accept, res.Header.Get("Content-Encoding"), got)
+		}
+		rec.Close()
+
+		s := readSpec(t, filepath.Join(mocks, "_data.json"))
+		if compact(t, s.Response.Body) != body || s.Response.Encoding != "gzip" {
+			t.Fatalf("expected the body to be stored decoded, but got %s %q", s.Response.Body, s.Response.Encoding)
+		}
+		if s.Response.Headers.Get("Content-Encoding") != "" {
+			t.Fatalf("expected no Content-Encoding header, but got %v", s.Response.Headers)
+		}
+	}
+}
+
+func TestRecordQueue(t *testing.T) {
+	proxy, rec, mocks := newRecorder(t, jsonHandler(`{}`), recorder.RecordCommand{QueueSize: 1}, nil)
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			get(t, http.DefaultClient, fmt.Sprintf("%s/items/%d", proxy.URL, i))
+		}(i)
+	}
+	wg.Wait()
+	// closing writes the responses still queued
+	rec.Close()
+
+	stats := rec.Stats()
+	if stats.Recorded != n || stats.MaxQueue > 1 {
+		t.Fatalf("expected %d recorded responses through a queue of 1, but got %s", n, stats)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := os.Stat(filepath.Join(mocks, fmt.Sprintf("_items_%d.json", i))); err != nil {
+			t.Fatalf("expected the mock of item %d, but got %v", i, err)
+		}
+	}
+}
+
+func TestRecordSkipsContentType(t *testing.T) {
+	upstream := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<p>hello</p>")
+	}
+	proxy, rec, mocks := newRecorder(t, http.HandlerFunc(upstream), recorder.RecordCommand{}, nil)
+	if _, got := get(t, http.DefaultClient, proxy.URL+"/page"); string(got) != "<p>hello</p>" {
+		t.Fatalf("expected the page to be proxied, but got %s", got)
+	}
+	rec.Close()
+
+	if _, err := os.Stat(filepath.Join(mocks, "_page.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected no mock, but got %v", err)
+	}
+	// the page never went through the write queue
+	if stats := rec.Stats(); stats.Skipped != 1 || stats.MaxQueue != 0 {
+		t.Fatalf("expected 1 skipped response that was not queued, but got %s", stats)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(mocks, ".record-*.tmp")); len(tmp) != 0 {
+		t.Fatalf("expected no capture files, but got %v", tmp)
+	}
+}
+
+func TestRecordStream(t *testing.T) {
+	upstream := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{"data: 1\n\n", "data: 2\n\n"} {
+			io.WriteString(w, event)
+			w.(http.Flusher).Flush()
+		}
+	}
+	proxy, rec, mocks := newRecorder(t, http.HandlerFunc(upstream), recorder.RecordCommand{}, nil)
+	if _, got := get(t, http.DefaultClient, proxy.URL+"/events"); string(got) != "data: 1\n\ndata: 2\n\n" {
+		t.Fatalf("expected both events, but got %q", got)
+	}
+	rec.Close()
+
+	events := readSpec(t, filepath.Join(mocks, "_events.json")).Response.Events
+	if len(events) != 2 || events[0].Data != "data: 1\n\n" || events[1].Data != "data: 2\n\n" {
+		t.Fatalf("expected the events to be recorded, but got %+v", events)
+	}
+}
+
+func TestRecordWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	upstream := func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		if _, data, err := conn.ReadMessage(); err == nil && string(data) == "ping" {
+			conn.WriteMessage(websocket.TextMessage, []byte("pong"))
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"))
+		conn.ReadMessage()
+	}
+	proxy, rec, mocks := newRecorder(t, http.HandlerFunc(upstream), recorder.RecordCommand{}, nil)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(proxy.URL, "http")+"/socket", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	conn.ReadMessage()
+	conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+	conn.ReadMessage()
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("expected the upstream close to be forwarded, but got %v", err)
+	}
+	conn.Close()
+	// the mock is written once both sides of the proxy closed
+	for i := 0; i < 100 && rec.Stats().Recorded == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec.Close()
+
+	var got []string
+	for _, m := range readSpec(t, filepath.Join(mocks, "_socket.json")).WebSocket.Messages {
+		got = append(got, m.From+":"+m.Type+":"+m.Data)
+	}
+	want := "server::hello client::ping server::pong server:close:bye"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("expected %s, but got %s", want, strings.Join(got, " "))
+	}
+}
+
+func TestRecordGraphql(t *testing.T) {
+	proxy, rec, mocks := newRecorder(t, jsonHandler(`{"data":{}}`), recorder.RecordCommand{GraphqlPath: "/api/graphql"}, nil)
+
+	query := `{"query": "query GetUser($id: ID!) { user(id: $id) { id } }", "variables": {"id": "1"}}`
+	res, err := http.Post(proxy.URL+"/api/graphql", "application/json", strings.NewReader(query))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	// a query parameter outside the GraphQL path is a plain request
+	get(t, http.DefaultClient, proxy.URL+"/search?query=x")
+	rec.Close()
+
+	s := readSpec(t, filepath.Join(mocks, "_api_graphql.GetUser.5811967f.json"))
+	if s.Graphql == nil || s.Graphql.OperationName != "GetUser" || compact(t, s.Graphql.Variables) != `{"id":"1"}` {
+		t.Fatalf("expected the spec to be narrowed to GetUser, but got %+v", s.Graphql)
+	}
+	if s := readSpec(t, filepath.Join(mocks, "_search.json")); s.Graphql != nil {
+		t.Fatalf("expected a plain spec for /search, but got %+v", s.Graphql)
+	}
+}
+
+const greeter = `syntax = "proto3";
+package helloworld;
+
+service Greeter {
+  rpc StreamHellos (HelloRequest) returns (stream HelloReply);
+}
+
+message HelloRequest {
+  string name = 1;
+}
+
+message HelloReply {
+  string message = 1;
+}
+`
+
+func TestRecordGrpc(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{"protos/greeter.proto": greeter})
+	reg, err := grpcmock.Load(dir, &config.GrpcConfig{
+		Services: map[string]config.GrpcService{"helloworld.Greeter": {Proto: "protos/greeter.proto"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	md, _ := reg.Method("/helloworld.Greeter/StreamHellos")
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+
+	tests := []struct {
+		name        string
+		path        string
+		maxBodySize int64
+		message     string
+		spec        string
+		recorded    int64
+		skipped     int64
+	}{
+		{name: "streamed", path: "/helloworld.Greeter/StreamHellos", message: "hello", spec: "grpc/helloworld.Greeter_StreamHellos.json", recorded: 1},
+		{name: "larger than the max body size", path: "/helloworld.Greeter/StreamHellos", maxBodySize: 10, message: strings.Repeat("x", 20), skipped: 1},
+		{name: "method not in the manifest", path: "/helloworld.Greeter/Missing", message: "hello", skipped: 1},
+	}
+	for _, tt := range tests {
+		// the second message is only sent once the client got the first, a
+		// buffered call would never end
+		next := make(chan struct{})
+		upstream := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", grpcmock.ContentType)
+			w.Header().Set("Trailer", "Grpc-Status")
+			for i := 0; i < 2; i++ {
+				b, _ := grpcmock.Encode(md.Output(), json.RawMessage(`{"message":"`+tt.message+`"}`))
+				grpcmock.WriteMessage(w, b)
+				w.(http.Flusher).Flush()
+				if i == 0 {
+					<-next
+				}
+			}
+			w.Header().Set("Grpc-Status", "0")
+		}
+		proxy, rec, mocks := newRecorder(t, h2c.NewHandler(http.HandlerFunc(upstream), &http2.Server{}), recorder.RecordCommand{Grpc: reg, MaxBodySize: tt.maxBodySize}, nil)
+
+		var body bytes.Buffer
+		grpcmock.WriteMessage(&body, nil)
+		req, _ := http.NewRequest(http.MethodPost, proxy.URL+tt.path, &body)
+		req.Header.Set("Content-Type", grpcmock.ContentType)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		var prefix [5]byte
+		if _, err := io.ReadFull(res.Body, prefix[:]); err != nil {
+			t.Fatalf("%s: expected the first message before the call ended, but got %v", tt.name, err)
+		}
+		close(next)
+		rest, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		msgs, err := grpcmock.ReadMessages(io.MultiReader(bytes.NewReader(prefix[:]), bytes.NewReader(rest)), "")
+		if err != nil || len(msgs) != 2 {
+			t.Fatalf("%s: expected 2 messages, but got %d %v", tt.name, len(msgs), err)
+		}
+		if got := res.Trailer.Get("Grpc-Status"); got != "0" {
+			t.Fatalf("%s: expected the status in the trailers, but got %q", tt.name, got)
+		}
+		rec.Close()
+
+		if stats := rec.Stats(); stats.Recorded != tt.recorded || stats.Skipped != tt.skipped {
+			t.Fatalf("%s: expected %d recorded and %d skipped calls, but got %s", tt.name, tt.recorded, tt.skipped, stats)
+		}
+		if tt.spec == "" {
+			if err := filepath.WalkDir(mocks, func(p string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					t.Fatalf("%s: expected no spec, but got %s", tt.name, p)
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		s := readSpec(t, filepath.Join(mocks, filepath.FromSlash(tt.spec)))
+		if s.Grpc == nil || len(s.Grpc.Messages) != 2 || compact(t, s.Grpc.Messages[1]) != `{"message":"hello"}` {
+			t.Fatalf("%s: expected the messages to be recorded, but got %+v", tt.name, s.Grpc)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package routing
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+// FromProject collects the routes of the functions in the manifest and of
+// the mocks in the mocks directory
+func FromProject(conf *config.Config) ([]Route, error) {
+	var routes []Route
+	for name, fn := range conf.Manifest.Functions.Enabled() {
+		routes = append(routes, Route{
+			Kind:     KindFunction,
+			Name:     name,
+			Pattern:  fn.HttpPathname,
+			Methods:  fn.AllowedMethods,
+			Priority: fn.Priority,
+		})
+	}
+
+	dir := filepath.Join(conf.GetProjectDir(), config.MocksDir)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		s, err := mockspec.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(conf.GetProjectDir(), p)
+		if err != nil {
+			name = p
+		}
+		routes = append(routes, MockRoute(name, s))
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// MockRoute returns the route of a mock spec
+func MockRoute(name string, s mockspec.Spec) Route {
+	r := Route{
+		Kind:     KindMock,
+		Name:     name,
+		Pattern:  s.Request.RequestPath,
+		Methods:  []string{s.Request.Method},
+		Priority: s.Priority,
+	}
+	if g := s.Graphql; g != nil {
+		r.Operation = &Operation{Name: g.OperationName, Variables: mockspec.CanonicalVariables(g.Variables)}
+	}
+	return r
+}
@@ -0,0 +1,262 @@
+// Package routing orders functions and mocks the way the mock server matches
+// them, and finds routes that are ambiguous or can never be reached.
+package routing
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type Kind string
+
+var (
+	KindFunction Kind = "function"
+	KindMock     Kind = "mock"
+)
+
+// Route is a function or a mock as seen by the matcher
+type Route struct {
+	Kind Kind
+	// Name is the function name or the mock file
+	Name    string
+	Pattern string
+	// Methods the route responds to. * matches every method
+	Methods  []string
+	Priority int
+	// Operation narrows a mock to one GraphQL operation, nil for every request
+	Operation *Operation
+}
+
+// Operation is a GraphQL operation, and its canonical variables when the
+// route only matches them
+type Operation struct {
+	Name      string
+	Variables string
+}
+
+func (r Route) String() string {
+	pattern := r.Pattern
+	if r.Operation != nil {
+		pattern += " " + r.Operation.String()
+	}
+	return fmt.Sprintf("%s %s (%s %s)", strings.Join(r.Methods, ","), pattern, r.Kind, r.Name)
+}
+
+func (o Operation) String() string {
+	name := o.Name
+	if name == "" {
+		name = "anonymous operation"
+	}
+	if o.Variables != "" {
+		name += " " + o.Variables
+	}
+	return name
+}
+
+// specificity ranks mocks for a GraphQL operation and its variables above
+// mocks for any request
+func (r Route) specificity() int {
+	switch {
+	case r.Operation == nil:
+		return 0
+	case r.Operation.Variables == "":
+		return 1
+	}
+	return 2
+}
+
+func (r Route) segments() []string {
+	return strings.Split(r.Pattern, "/")
+}
+
+func segmentRank(s string) int {
+	switch {
+	case s == "*":
+		return 2
+	case strings.HasPrefix(s, ":"):
+		return 1
+	}
+	return 0
+}
+
+// Compare orders routes the way the mock server tries them. Higher
+// priorities come first, then the most specific pattern: literal segments
+// beat :params, which beat * wildcards. On a tie functions come before mocks,
+// then mocks for a GraphQL operation come first and names decide
+func Compare(a, b Route) int {
+	if c := compareRank(a, b); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+func compareRank(a, b Route) int {
+	if a.Priority != b.Priority {
+		return b.Priority - a.Priority
+	}
+	as, bs := a.segments(), b.segments()
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := segmentRank(as[i]) - segmentRank(bs[i]); c != 0 {
+			return c
+		}
+	}
+	if len(as) != len(bs) {
+		return len(bs) - len(as)
+	}
+	if a.Kind != b.Kind {
+		if a.Kind == KindFunction {
+			return -1
+		}
+		return 1
+	}
+	return b.specificity() - a.specificity()
+}
+
+// Sort sorts routes in matching order
+func Sort(routes []Route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		return Compare(routes[i], routes[j]) < 0
+	})
+}
+
+func (r Route) hasMethod(m string) bool {
+	for _, rm := range r.Methods {
+		if rm == "*" || strings.EqualFold(rm, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Route) methodsOverlap(o Route) bool {
+	for _, m := range o.Methods {
+		if m == "*" || r.hasMethod(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Route) methodsCover(o Route) bool {
+	if slices.Contains(r.Methods, "*") {
+		return true
+	}
+	for _, m := range o.Methods {
+		if m == "*" || !r.hasMethod(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Overlaps reports whether a request exists that both routes match
+func (r Route) Overlaps(o Route) bool {
+	return r.methodsOverlap(o) && operationsOverlap(r.Operation, o.Operation) && patternsOverlap(r.segments(), o.segments())
+}
+
+// Covers reports whether r matches every request o matches
+func (r Route) Covers(o Route) bool {
+	return r.methodsCover(o) && operationCovers(r.Operation, o.Operation) && patternCovers(r.segments(), o.segments())
+}
+
+func operationsOverlap(a, b *Operation) bool {
+	if a == nil || b == nil {
+		return true
+	}
+	return a.Name == b.Name && (a.Variables == "" || b.Variables == "" || a.Variables == b.Variables)
+}
+
+func operationCovers(a, b *Operation) bool {
+	if a == nil {
+		return true
+	}
+	return b != nil && a.Name == b.Name && (a.Variables == "" || a.Variables == b.Variables)
+}
+
+// patternsOverlap and patternCovers compare the rest of two patterns. A *
+// matches one remaining segment at least
+func patternsOverlap(a, b []string) bool {
+	if len(a) > 0 && a[0] == "*" {
+		return len(b) > 0
+	}
+	if len(b) > 0 && b[0] == "*" {
+		return len(a) > 0
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	if segmentRank(a[0]) == 0 && segmentRank(b[0]) == 0 && a[0] != b[0] {
+		return false
+	}
+	return patternsOverlap(a[1:], b[1:])
+}
+
+func patternCovers(a, b []string) bool {
+	if len(a) > 0 && a[0] == "*" {
+		return len(b) > 0
+	}
+	if len(b) > 0 && b[0] == "*" {
+		return false
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	if segmentRank(a[0]) == 0 && a[0] != b[0] {
+		return false
+	}
+	return patternCovers(a[1:], b[1:])
+}
+
+type ConflictKind string
+
+var (
+	// Ambiguous routes overlap with the same rank. Only their names decide
+	// which one is served
+	Ambiguous ConflictKind = "ambiguous"
+	// Shadowed routes are covered by a route ranked above them and are
+	// never served
+	Shadowed ConflictKind = "shadowed"
+)
+
+type Conflict struct {
+	Kind ConflictKind
+	// Route is the route that loses, By the one that wins
+	Route Route
+	By    Route
+}
+
+func (c Conflict) String() string {
+	if c.Kind == Ambiguous {
+		return fmt.Sprintf("%s is ambiguous with %s, give one of them a higher priority", c.Route, c.By)
+	}
+	return fmt.Sprintf("%s is shadowed by %s and is never served", c.Route, c.By)
+}
+
+// Check reports conflicts between routes, compared in matching order on a
+// copy of routes.
+// Mocks matched by a function are not reported, functions receive them as
+// their static mock
+func Check(routes []Route) []Conflict {
+	routes = slices.Clone(routes)
+	Sort(routes)
+	var conflicts []Conflict
+	for j := range routes {
+		for i := 0; i < j; i++ {
+			winner, loser := routes[i], routes[j]
+			if winner.Kind == KindFunction && loser.Kind == KindMock {
+				continue
+			}
+			if compareRank(winner, loser) == 0 && winner.Overlaps(loser) {
+				conflicts = append(conflicts, Conflict{Kind: Ambiguous, Route: loser, By: winner})
+				break
+			}
+			if winner.Covers(loser) {
+				conflicts = append(conflicts, Conflict{Kind: Shadowed, Route: loser, By: winner})
+				break
+			}
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,123 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/protomoks/pmok/internal/routing"
+)
+
+func fn(name, pattern string, priority int, methods ...string) routing.Route {
+	return routing.Route{Kind: routing.KindFunction, Name: name, Pattern: pattern, Methods: methods, Priority: priority}
+}
+
+func mock(name, pattern string, priority int, method string) routing.Route {
+	return routing.Route{Kind: routing.KindMock, Name: name, Pattern: pattern, Methods: []string{method}, Priority: priority}
+}
+
+func TestSort(t *testing.T) {
+	routes := []routing.Route{
+		fn("wildcard", "/users/*", 0, "GET"),
+		fn("param", "/users/:id", 0, "GET"),
+		mock("literal-mock", "/users/me", 0, "GET"),
+		fn("literal", "/users/me", 0, "GET"),
+		fn("important", "/users/*", 10, "GET"),
+	}
+	routing.Sort(routes)
+
+	want := []string{"important", "literal", "literal-mock", "param", "wildcard"}
+	for i, name := range want {
+		if routes[i].Name != name {
+			t.Fatalf("position %d: expected %s, but got %s", i, name, routes[i].Name)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		routes []routing.Route
+		want   []routing.ConflictKind
+	}{
+		{
+			name:   "distinct",
+			routes: []routing.Route{fn("a", "/users/:id", 0, "GET"), fn("b", "/orders/:id", 0, "GET")},
+		},
+		{
+			name:   "ambiguous params",
+			routes: []routing.Route{fn("a", "/users/:id", 0, "GET"), fn("b", "/users/:name", 0, "GET")},
+			want:   []routing.ConflictKind{routing.Ambiguous},
+		},
+		{
+			name:   "different methods",
+			routes: []routing.Route{fn("a", "/users/:id", 0, "GET"), fn("b", "/users/:name", 0, "POST")},
+		},
+		{
+			name:   "shadowed by wildcard with priority",
+			routes: []routing.Route{fn("a", "/users/*", 1, "*"), fn("b", "/users/:id", 0, "GET")},
+			want:   []routing.ConflictKind{routing.Shadowed},
+		},
+		{
+			name:   "more specific route is not shadowed",
+			routes: []routing.Route{fn("a", "/users/*", 0, "GET"), fn("b", "/users/me", 0, "GET")},
+		},
+		{
+			name:   "wildcard needs a segment",
+			routes: []routing.Route{fn("a", "/users/*", 1, "GET"), fn("b", "/users", 0, "GET")},
+		},
+		{
+			name:   "wildcard under a wildcard",
+			routes: []routing.Route{fn("a", "/*", 1, "GET"), fn("b", "/users/*", 0, "GET")},
+			want:   []routing.ConflictKind{routing.Shadowed},
+		},
+		{
+			name:   "duplicate mocks",
+			routes: []routing.Route{mock("a.json", "/users/1", 0, "GET"), mock("b.json", "/users/1", 0, "GET")},
+			want:   []routing.ConflictKind{routing.Ambiguous},
+		},
+		{
+			name:   "mocks handed to functions",
+			routes: []routing.Route{fn("a", "/users/:id", 0, "GET"), mock("b.json", "/users/:id", 0, "GET")},
+		},
+		{
+			name: "graphql operations",
+			routes: []routing.Route{
+				operation("a.json", "GetUser", ""), operation("b.json", "ListUsers", ""),
+				operation("c.json", "GetUser", `{"id":"1"}`), mock("d.json", "/graphql", 0, "POST"),
+			},
+		},
+		{
+			name:   "duplicate graphql operations",
+			routes: []routing.Route{operation("a.json", "GetUser", `{"id":"1"}`), operation("b.json", "GetUser", `{"id":"1"}`)},
+			want:   []routing.ConflictKind{routing.Ambiguous},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			names := make([]string, len(c.routes))
+			for i, r := range c.routes {
+				names[i] = r.Name
+			}
+			conflicts := routing.Check(c.routes)
+			for i, r := range c.routes {
+				if r.Name != names[i] {
+					t.Fatalf("expected the routes to keep their order, but got %s at %d", r.Name, i)
+				}
+			}
+			if len(conflicts) != len(c.want) {
+				t.Fatalf("expected %d conflicts, but got %v", len(c.want), conflicts)
+			}
+			for i, kind := range c.want {
+				if conflicts[i].Kind != kind {
+					t.Fatalf("expected a %s conflict, but got %s", kind, conflicts[i])
+				}
+			}
+		})
+	}
+}
+
+func operation(name, op, variables string) routing.Route {
+	r := mock(name, "/graphql", 0, "POST")
+	r.Operation = &routing.Operation{Name: op, Variables: variables}
+	return r
+}
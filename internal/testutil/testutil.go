@@ -0,0 +1,50 @@
+// Package testutil holds the fixtures shared by the tests of pmok
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// WriteFiles writes files into dir, keyed by their slash separated path
+// relative to dir. Missing directories are created
+func WriteFiles(t testing.TB, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// NewProject writes files into the protomok directory of a new project and
+// returns the project root
+func NewProject(t testing.TB, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "protomok"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	WriteFiles(t, filepath.Join(root, "protomok"), files)
+	return root
+}
+
+// Chdir changes the working directory for the duration of the test
+func Chdir(t testing.TB, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+}
@@ -6,6 +6,8 @@ const (
 	EdgeRuntimeImage         = "supabase/edge-runtime:v1.66.4"
 	DenoImage                = "denoland/deno:2.0.2"
 	RecorderDefaultPort      = 9999
+	GrpcDefaultPort          = 50051
+	GraphqlDefaultPath       = "/graphql"
 )
 
 var Version = "dev" // default value. Will be overwritten by ldflags
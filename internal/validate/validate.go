@@ -0,0 +1,455 @@
+// Package validate checks the manifest, the functions and the mock specs of
+// a protomok project against their JSON schemas and reports every problem
+// with its file, line and field.
+package validate
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/graphqlmock"
+	"github.com/protomoks/pmok/internal/grpcmock"
+	"github.com/protomoks/pmok/internal/mockspec"
+	"github.com/protomoks/pmok/internal/utils/constants"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ManifestSchemaURL = "https://protomoks.dev/schemas/manifest.schema.json"
+	SpecSchemaURL     = "https://protomoks.dev/schemas/spec.schema.json"
+)
+
+var (
+	//go:embed schemas/*.json
+	schemaFS embed.FS
+	printer  = message.NewPrinter(language.English)
+)
+
+// Schema returns the raw JSON schema, manifest or spec. The spec schema is
+// owned by mockspec
+func Schema(name string) ([]byte, error) {
+	if name == "spec" {
+		return mockspec.Schema, nil
+	}
+	return schemaFS.ReadFile("schemas/" + name + ".schema.json")
+}
+
+// Issue is a single problem found in a project file. Line and Column are 0
+// when the problem is not tied to a position
+type Issue struct {
+	File    string
+	Line    int
+	Column  int
+	Field   string
+	Message string
+}
+
+func (i Issue) String() string {
+	loc := i.File
+	if i.Line > 0 {
+		loc += fmt.Sprintf(":%d:%d", i.Line, i.Column)
+	}
+	if i.Field != "" {
+		return fmt.Sprintf("%s: %s: %s", loc, i.Field, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", loc, i.Message)
+}
+
+type validator struct {
+	root     string
+	manifest *jsonschema.Schema
+	spec     *jsonschema.Schema
+	issues   []Issue
+	// grpc resolves the methods of gRPC specs, set by a valid manifest
+	grpc *grpcmock.Registry
+	// graphqlPath is the only path GraphQL specs are served on
+	graphqlPath string
+}
+
+// Project validates the project rooted at root, the directory containing
+// the protomok directory. The returned error is only set when validation
+// itself failed, problems with the project are reported as issues
+func Project(root string) ([]Issue, error) {
+	v := &validator{root: root, graphqlPath: constants.GraphqlDefaultPath}
+	if err := v.compile(); err != nil {
+		return nil, err
+	}
+
+	manifests := 0
+	for _, name := range []string{config.DeploymentManifestYaml, config.DeploymentManifestJson} {
+		p := filepath.Join(root, name)
+		b, err := os.ReadFile(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifests++
+		v.validateManifest(name, b)
+	}
+	if manifests == 0 {
+		v.add(Issue{File: config.ProtomokDir, Message: "no pmok.yaml or pmok.json manifest found"})
+	}
+
+	err := filepath.WalkDir(filepath.Join(root, config.MocksDir), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		v.validateSpec(v.rel(p), b)
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		if v.issues[i].File != v.issues[j].File {
+			return v.issues[i].File < v.issues[j].File
+		}
+		return v.issues[i].Line < v.issues[j].Line
+	})
+	return v.issues, nil
+}
+
+func (v *validator) compile() error {
+	c := jsonschema.NewCompiler()
+	for name, url := range map[string]string{"manifest": ManifestSchemaURL, "spec": SpecSchemaURL} {
+		b, err := Schema(name)
+		if err != nil {
+			return err
+		}
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		if err := c.AddResource(url, doc); err != nil {
+			return err
+		}
+	}
+	var err error
+	if v.manifest, err = c.Compile(ManifestSchemaURL); err != nil {
+		return err
+	}
+	v.spec, err = c.Compile(SpecSchemaURL)
+	return err
+}
+
+func (v *validator) add(i Issue) {
+	v.issues = append(v.issues, i)
+}
+
+func (v *validator) rel(p string) string {
+	if r, err := filepath.Rel(v.root, p); err == nil {
+		return r
+	}
+	return p
+}
+
+func (v *validator) validateManifest(file string, b []byte) {
+	doc, ok := v.parse(file, b)
+	if !ok {
+		return
+	}
+	if err := config.ExpandVariables(file, doc, false); err != nil {
+		v.add(Issue{File: file, Message: err.Error()})
+		return
+	}
+	// the schema describes the current version only
+	if version := child(doc, "version"); version != nil && version.Value != constants.DefaultManifestVersion {
+		v.add(Issue{
+			File:    file,
+			Line:    version.Line,
+			Column:  version.Column,
+			Field:   "version",
+			Message: fmt.Sprintf("manifest version %s is not %s, run pmok migrate", version.Value, constants.DefaultManifestVersion),
+		})
+		return
+	}
+	if !v.validateSchema(file, doc, v.manifest) {
+		return
+	}
+
+	var m config.ManifestConfig
+	if err := doc.Decode(&m); err != nil {
+		v.add(Issue{File: file, Message: err.Error()})
+		return
+	}
+	for name, fn := range m.Functions {
+		entrypoint := filepath.Join(v.root, config.FunctionsDir, name, fn.Entrypoint)
+		if _, err := os.Stat(entrypoint); err != nil {
+			line, col := position(doc, []string{"functions", name, "entrypoint"})
+			v.add(Issue{
+				File:    file,
+				Line:    line,
+				Column:  col,
+				Field:   "functions." + name + ".entrypoint",
+				Message: fmt.Sprintf("entrypoint %s does not exist", v.rel(entrypoint)),
+			})
+		}
+	}
+	if m.Faults != nil {
+		v.validateFaults(file, doc, []string{"faults"}, m.Faults)
+	}
+	for name, fn := range m.Functions {
+		if fn.Faults != nil {
+			v.validateFaults(file, doc, []string{"functions", name, "faults"}, fn.Faults)
+		}
+	}
+	v.graphqlPath = m.Graphql.GraphqlPath()
+	if m.Grpc != nil && len(m.Grpc.Services) > 0 {
+		reg, err := grpcmock.Load(filepath.Join(v.root, config.ProtomokDir), m.Grpc)
+		if err != nil {
+			line, col := position(doc, []string{"grpc", "services"})
+			v.add(Issue{File: file, Line: line, Column: col, Field: "grpc.services", Message: err.Error()})
+			return
+		}
+		v.grpc = reg
+	}
+	if m.Graphql != nil && m.Graphql.Schema != "" {
+		if _, err := graphqlmock.LoadSchema(filepath.Join(v.root, config.ProtomokDir, m.Graphql.Schema)); err != nil {
+			line, col := position(doc, []string{"graphql", "schema"})
+			v.add(Issue{File: file, Line: line, Column: col, Field: "graphql.schema", Message: err.Error()})
+		}
+	}
+}
+
+// validateFaults checks the latency ranges, which the schema cannot express
+func (v *validator) validateFaults(file string, doc *yaml.Node, path []string, f *mockspec.Faults) {
+	if err := f.Validate(); err != nil {
+		line, col := position(doc, path)
+		v.add(Issue{File: file, Line: line, Column: col, Field: strings.Join(path, "."), Message: err.Error()})
+	}
+}
+
+func (v *validator) validateSpec(file string, b []byte) {
+	doc, ok := v.parse(file, b)
+	if !ok {
+		return
+	}
+	if !v.validateSchema(file, doc, v.spec) {
+		return
+	}
+	s, err := mockspec.Load(bytes.NewReader(b))
+	if err != nil {
+		v.add(Issue{File: file, Message: err.Error()})
+		return
+	}
+	// templates and latency ranges are beyond the schema, each issue points at
+	// the part of the spec that has it
+	for _, part := range specParts(s) {
+		if err := part.validate(); err != nil {
+			line, col := position(doc, part.path)
+			v.add(Issue{File: file, Line: line, Column: col, Field: strings.Join(part.path, "."), Message: err.Error()})
+		}
+	}
+	if f := s.Response.BodyFile; f != "" {
+		p := filepath.Join(v.root, filepath.Dir(file), filepath.FromSlash(f))
+		if _, err := os.Stat(p); err != nil {
+			line, col := position(doc, []string{"response", "bodyFile"})
+			v.add(Issue{File: file, Line: line, Column: col, Field: "response.bodyFile", Message: fmt.Sprintf("body file %s does not exist", f)})
+		}
+	}
+	if s.Grpc != nil {
+		v.validateGrpc(file, doc, s)
+	}
+	if s.Graphql != nil && s.Request.RequestPath != v.graphqlPath {
+		line, col := position(doc, []string{"request", "path"})
+		v.add(Issue{File: file, Line: line, Column: col, Field: "request.path", Message: fmt.Sprintf("GraphQL operations are only served on %s, the GraphQL path of the manifest", v.graphqlPath)})
+	}
+}
+
+// specPart is a part of a spec that mockspec validates on its own
+type specPart struct {
+	path     []string
+	validate func() error
+}
+
+// specParts lists the parts of s to validate, in the order of Spec.Validate
+func specParts(s mockspec.Spec) []specPart {
+	var parts []specPart
+	if s.Faults != nil {
+		parts = append(parts, specPart{[]string{"faults"}, s.Faults.Validate})
+	}
+	if s.Scenario != nil {
+		parts = append(parts, specPart{[]string{"scenario"}, s.Scenario.Validate})
+	}
+	if s.WebSocket != nil {
+		parts = append(parts, specPart{[]string{"websocket"}, s.WebSocket.Validate})
+	}
+	if s.Grpc != nil {
+		parts = append(parts, specPart{[]string{"grpc"}, s.Grpc.Validate})
+	}
+	parts = append(parts, templatesPart([]string{"response"}, s.Response))
+	if s.Scenario != nil {
+		states := make([]string, 0, len(s.Scenario.States))
+		for state := range s.Scenario.States {
+			states = append(states, state)
+		}
+		sort.Strings(states)
+		for _, state := range states {
+			for i, r := range s.Scenario.States[state].Responses {
+				parts = append(parts, templatesPart([]string{"scenario", "states", state, "responses", strconv.Itoa(i)}, r))
+			}
+		}
+	}
+	return parts
+}
+
+func templatesPart(path []string, r mockspec.SpecBodyResponse) specPart {
+	return specPart{path, func() error {
+		return mockspec.ValidateTemplates(mockspec.Spec{Response: r})
+	}}
+}
+
+// validateGrpc transcodes the messages of a gRPC spec with the protos of the
+// manifest
+func (v *validator) validateGrpc(file string, doc *yaml.Node, s mockspec.Spec) {
+	md, ok := v.grpc.Method(s.Request.RequestPath)
+	if !ok {
+		line, col := position(doc, []string{"request", "path"})
+		v.add(Issue{File: file, Line: line, Column: col, Field: "request.path", Message: fmt.Sprintf("method %s is not in the gRPC services of the manifest", s.Request.RequestPath)})
+		return
+	}
+	for i, msg := range s.Grpc.Messages {
+		if _, err := grpcmock.Encode(md.Output(), msg); err != nil {
+			field := fmt.Sprintf("grpc.messages.%d", i)
+			line, col := position(doc, []string{"grpc", "messages", strconv.Itoa(i)})
+			v.add(Issue{File: file, Line: line, Column: col, Field: field, Message: err.Error()})
+		}
+	}
+}
+
+// parse reads YAML or JSON into a node tree. JSON is valid YAML, parsing
+// both the same way gives positions for either format
+func (v *validator) parse(file string, b []byte) (*yaml.Node, bool) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		line := 0
+		var te *yaml.TypeError
+		if !errors.As(err, &te) {
+			line = syntaxErrorLine(err)
+		}
+		v.add(Issue{File: file, Line: line, Message: err.Error()})
+		return nil, false
+	}
+	if len(doc.Content) == 0 {
+		v.add(Issue{File: file, Message: "file is empty"})
+		return nil, false
+	}
+	return doc.Content[0], true
+}
+
+// syntaxErrorLine extracts the line from yaml errors such as
+// "yaml: line 3: mapping values are not allowed in this context"
+func syntaxErrorLine(err error) int {
+	msg := err.Error()
+	i := strings.Index(msg, "line ")
+	if i < 0 {
+		return 0
+	}
+	rest := msg[i+len("line "):]
+	end := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(rest)
+	}
+	line, _ := strconv.Atoi(rest[:end])
+	return line
+}
+
+func (v *validator) validateSchema(file string, doc *yaml.Node, sch *jsonschema.Schema) bool {
+	var raw any
+	if err := doc.Decode(&raw); err != nil {
+		v.add(Issue{File: file, Message: err.Error()})
+		return false
+	}
+	// round trip through JSON so the instance only holds JSON types
+	b, err := json.Marshal(raw)
+	if err != nil {
+		v.add(Issue{File: file, Message: err.Error()})
+		return false
+	}
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(b))
+	if err != nil {
+		v.add(Issue{File: file, Message: err.Error()})
+		return false
+	}
+
+	err = sch.Validate(inst)
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return true
+	}
+	for _, leaf := range leaves(ve) {
+		line, col := position(doc, leaf.InstanceLocation)
+		v.add(Issue{
+			File:    file,
+			Line:    line,
+			Column:  col,
+			Field:   strings.Join(leaf.InstanceLocation, "."),
+			Message: leaf.ErrorKind.LocalizedString(printer),
+		})
+	}
+	return false
+}
+
+func leaves(ve *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(ve.Causes) == 0 {
+		return []*jsonschema.ValidationError{ve}
+	}
+	var out []*jsonschema.ValidationError
+	for _, c := range ve.Causes {
+		out = append(out, leaves(c)...)
+	}
+	return out
+}
+
+// position returns the line and column of the node at path, or of its
+// closest existing parent
+func position(n *yaml.Node, path []string) (int, int) {
+	for _, p := range path {
+		next := child(n, p)
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return n.Line, n.Column
+}
+
+func child(n *yaml.Node, key string) *yaml.Node {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(key)
+		if err == nil && i >= 0 && i < len(n.Content) {
+			return n.Content[i]
+		}
+	}
+	return nil
+}
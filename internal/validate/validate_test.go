@@ -0,0 +1,129 @@
+package validate_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/testutil"
+	"github.com/protomoks/pmok/internal/validate"
+)
+
+const validManifest = `version: "0.01"
+project:
+  name: test
+functions:
+  users:
+    path: /users
+    entrypoint: index.ts
+    methods: [GET]
+`
+
+const validMock = `{
+ "request": {"method": "GET", "path": "/orders/:id"},
+ "response": {"status": 200, "headers": {}, "body": {"id": "{{request.params.id}}"}, "template": true}
+}`
+
+func TestProject(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		// expected issues, as file:line:col: field
+		want []string
+	}{
+		{
+			name: "valid project",
+			files: map[string]string{
+				"pmok.yaml":                validManifest,
+				"functions/users/index.ts": "",
+				"mocks/_orders_:id.json":   validMock,
+			},
+		},
+		{
+			name: "missing entrypoint",
+			files: map[string]string{
+				"pmok.yaml": validManifest,
+			},
+			want: []string{"protomok/pmok.yaml:7:17: functions.users.entrypoint"},
+		},
+		{
+			name: "invalid method",
+			files: map[string]string{
+				"pmok.yaml":                "version: \"0.01\"\nproject:\n  name: test\nfunctions:\n  users:\n    path: /users\n    entrypoint: index.ts\n    methods: [FETCH]\n",
+				"functions/users/index.ts": "",
+			},
+			want: []string{"protomok/pmok.yaml:8:15: functions.users.methods.0"},
+		},
+		{
+			name: "stream speed without delays",
+			files: map[string]string{
+				"pmok.yaml": "version: \"0.01\"\nproject:\n  name: test\nserver:\n  streamSpeed: 0\n",
+			},
+		},
+		{
+			name: "negative stream speed",
+			files: map[string]string{
+				"pmok.yaml": "version: \"0.01\"\nproject:\n  name: test\nserver:\n  streamSpeed: -1\n",
+			},
+			want: []string{"protomok/pmok.yaml:5:16: server.streamSpeed"},
+		},
+		{
+			name: "invalid mock",
+			files: map[string]string{
+				"pmok.yaml":          "version: \"0.01\"\nproject:\n  name: test\n",
+				"mocks/_orders.json": "{\n \"request\": {\"method\": \"GET\", \"path\": \"orders\"},\n \"response\": {\"status\": 200, \"headers\": {}, \"body\": {}}\n}",
+			},
+			want: []string{"protomok/mocks/_orders.json:2:39: request.path"},
+		},
+		{
+			name: "invalid template",
+			files: map[string]string{
+				"pmok.yaml":          "version: \"0.01\"\nproject:\n  name: test\n",
+				"mocks/_orders.json": "{\n \"request\": {\"method\": \"GET\", \"path\": \"/orders\"},\n \"response\": {\"status\": 200, \"headers\": {}, \"body\": {\"id\": \"{{nope}}\"}, \"template\": true}\n}",
+			},
+			want: []string{"protomok/mocks/_orders.json:3:14: response"},
+		},
+		{
+			name: "invalid faults",
+			files: map[string]string{
+				"pmok.yaml":          "version: \"0.01\"\nproject:\n  name: test\n",
+				"mocks/_orders.json": "{\n \"request\": {\"method\": \"GET\", \"path\": \"/orders\"},\n \"response\": {\"status\": 200, \"headers\": {}, \"body\": {}},\n \"faults\": {\"latency\": {\"minMs\": 10}}\n}",
+			},
+			want: []string{"protomok/mocks/_orders.json:4:12: faults"},
+		},
+		{
+			name: "unknown spec field",
+			files: map[string]string{
+				"pmok.yaml":          "version: \"0.01\"\nproject:\n  name: test\n",
+				"mocks/_orders.json": "{\n \"request\": {\"method\": \"GET\", \"path\": \"/orders\"},\n \"response\": {\"status\": 200, \"headers\": {}, \"body\": {}},\n \"delay\": 100\n}",
+			},
+			want: []string{"protomok/mocks/_orders.json:1:1: additional properties 'delay' not allowed"},
+		},
+		{
+			name: "graphql mock outside the graphql path",
+			files: map[string]string{
+				"pmok.yaml":                   "version: \"0.01\"\nproject:\n  name: test\ngraphql:\n  path: /api/graphql\n",
+				"mocks/_search.json":          "{\n \"request\": {\"method\": \"GET\", \"path\": \"/search\"},\n \"graphql\": {\"operationName\": \"\"},\n \"response\": {\"status\": 200, \"headers\": {}, \"body\": {}}\n}",
+				"mocks/_api_graphql.Get.json": "{\n \"request\": {\"method\": \"POST\", \"path\": \"/api/graphql\"},\n \"graphql\": {\"operationName\": \"Get\"},\n \"response\": {\"status\": 200, \"headers\": {}, \"body\": {}}\n}",
+			},
+			want: []string{"protomok/mocks/_search.json:2:39: request.path"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := validate.Project(testutil.NewProject(t, tt.files))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(issues) != len(tt.want) {
+				t.Fatalf("expected %d issues, but got %v", len(tt.want), issues)
+			}
+			for i, want := range tt.want {
+				got := issues[i].String()
+				if !strings.HasPrefix(got, want) {
+					t.Fatalf("expected issue %q, but got %q", want, got)
+				}
+			}
+		})
+	}
+}
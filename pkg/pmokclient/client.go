@@ -0,0 +1,302 @@
+// Package pmokclient is a client for the admin API of a running protomok
+// mock server. It lets integration tests inspect and drive the mock server,
+// e.g. reset scenarios between test cases or register mocks at runtime.
+package pmokclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/protomoks/pmok/internal/mockspec"
+)
+
+const (
+	// DefaultBaseURL is the address pmok serve listens on
+	DefaultBaseURL = "http://127.0.0.1:8000"
+	// AdminPath is the path prefix of the admin API
+	AdminPath = "/__pmok"
+)
+
+// Client calls the admin API of a mock server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Option is a functional option for configuring a Client
+type Option func(*Client)
+
+// WithHTTPClient overrides the http.Client used for requests
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.httpClient = c
+	}
+}
+
+// New creates a client for the mock server at baseURL, e.g. DefaultBaseURL
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is returned when the admin API responds with a non 2xx status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("pmok admin api: %d %s", e.StatusCode, e.Message)
+}
+
+// Mock is a static mock loaded by the mock server. Source is the spec file,
+// or runtime:<METHOD> <path> for mocks added through PutMock
+type Mock struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Source   string `json:"source"`
+	Scenario string `json:"scenario,omitempty"`
+}
+
+// The types of mock specs are the ones of the spec files in protomok/mocks,
+// aliased here so tests outside of pmok can build them
+type (
+	// MockSpec is a mock spec as stored in the protomok/mocks directory
+	MockSpec = mockspec.Spec
+	// MockRequest is the request a mock spec answers
+	MockRequest = mockspec.SpecRequest
+	// MockResponse is the response of a mock spec, its status and headers are
+	// set in its SpecResponse
+	MockResponse = mockspec.SpecBodyResponse
+	// SpecResponse is the status, headers and template flag of a response
+	SpecResponse = mockspec.SpecResponse
+	// MockEvent is an event of a recorded stream
+	MockEvent = mockspec.SpecEvent
+	// MockScenario groups sequences of responses into named states
+	MockScenario = mockspec.SpecScenario
+	// MockSequence is the ordered responses of a scenario state
+	MockSequence = mockspec.SpecSequence
+	// SequenceMode controls what a sequence returns once every response was
+	// served
+	SequenceMode = mockspec.SequenceMode
+	// MockWebSocket is a WebSocket endpoint, a recorded conversation and
+	// rules replying to the client
+	MockWebSocket = mockspec.SpecWebSocket
+	// MockMessage is a WebSocket message
+	MockMessage = mockspec.SpecMessage
+	// MockMessageRule replies to the client messages it matches
+	MockMessageRule = mockspec.SpecMessageRule
+	// MockGrpc is the response of a gRPC method
+	MockGrpc = mockspec.SpecGrpc
+	// MockGraphql narrows a mock to one GraphQL operation
+	MockGraphql = mockspec.SpecGraphql
+)
+
+// DefaultScenarioState is the state a scenario starts in
+const DefaultScenarioState = mockspec.DefaultScenarioState
+
+var (
+	// SequenceStick keeps returning the last response. This is the default
+	SequenceStick = mockspec.SequenceStick
+	// SequenceLoop starts over from the first response
+	SequenceLoop = mockspec.SequenceLoop
+)
+
+// Senders and types of WebSocket messages
+const (
+	FromClient    = mockspec.FromClient
+	FromServer    = mockspec.FromServer
+	MessageText   = mockspec.MessageText
+	MessageBinary = mockspec.MessageBinary
+	MessageClose  = mockspec.MessageClose
+)
+
+// Function is a function handler declared in the manifest
+type Function struct {
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Entrypoint string   `json:"entrypoint"`
+	Methods    []string `json:"methods"`
+}
+
+// Faults are the faults of the manifest and of mock specs. Rates are
+// percentages
+type Faults = mockspec.Faults
+
+// Latency is the latency fault of Faults
+type Latency = mockspec.Latency
+
+// FaultState is the runtime fault configuration of the mock server
+type FaultState struct {
+	Enabled bool    `json:"enabled"`
+	Faults  *Faults `json:"faults"`
+}
+
+// Request is an entry of the request journal
+type Request struct {
+	ID         int         `json:"id"`
+	Time       time.Time   `json:"time"`
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Query      url.Values  `json:"query"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body"`
+	Match      Match       `json:"match"`
+	Status     int         `json:"status"`
+	DurationMs int         `json:"durationMs"`
+}
+
+// Match tells what served a journaled request. Type is one of mock,
+// function or none. Name is the mock source or the function name
+type Match struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// RequestQuery filters the journal on the server. Zero values match all
+type RequestQuery struct {
+	Method string
+	// Path is an exact path or a pattern such as /orders/:id
+	Path string
+	// Match is a match type (mock, function, none) or a mock/function name
+	Match string
+	// Limit returns only the most recent entries
+	Limit int
+}
+
+func (q RequestQuery) values() url.Values {
+	v := url.Values{}
+	if q.Method != "" {
+		v.Set("method", q.Method)
+	}
+	if q.Path != "" {
+		v.Set("path", q.Path)
+	}
+	if q.Match != "" {
+		v.Set("match", q.Match)
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
+}
+
+// ListMocks returns the static mocks loaded by the server
+func (c *Client) ListMocks(ctx context.Context) ([]Mock, error) {
+	var mocks []Mock
+	return mocks, c.do(ctx, http.MethodGet, "/mocks", nil, &mocks)
+}
+
+// PutMock adds a mock, or replaces the mock with the same method and path.
+// Runtime mocks are kept in memory and lost when the server restarts
+func (c *Client) PutMock(ctx context.Context, spec MockSpec) error {
+	return c.do(ctx, http.MethodPut, "/mocks", spec, nil)
+}
+
+// ListFunctions returns the functions declared in the manifest
+func (c *Client) ListFunctions(ctx context.Context) ([]Function, error) {
+	var fns []Function
+	return fns, c.do(ctx, http.MethodGet, "/functions", nil, &fns)
+}
+
+// Scenarios returns the active state of each scenario
+func (c *Client) Scenarios(ctx context.Context) (map[string]string, error) {
+	states := map[string]string{}
+	return states, c.do(ctx, http.MethodGet, "/scenarios", nil, &states)
+}
+
+// ResetScenarios restores the scenario states of the manifest and rewinds
+// every sequence to its first response
+func (c *Client) ResetScenarios(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/scenarios/reset", nil, nil)
+}
+
+// SetScenarioState switches a scenario to another state and rewinds its
+// sequences
+func (c *Client) SetScenarioState(ctx context.Context, name, state string) error {
+	return c.do(ctx, http.MethodPut, "/scenarios/"+url.PathEscape(name), map[string]string{"state": state}, nil)
+}
+
+// Faults returns the runtime fault configuration
+func (c *Client) Faults(ctx context.Context) (FaultState, error) {
+	var state FaultState
+	return state, c.do(ctx, http.MethodGet, "/faults", nil, &state)
+}
+
+// SetFaults replaces the global faults and enables fault injection. Invalid
+// faults are rejected by the server
+func (c *Client) SetFaults(ctx context.Context, faults *Faults) error {
+	return c.do(ctx, http.MethodPut, "/faults", FaultState{Enabled: true, Faults: faults}, nil)
+}
+
+// EnableFaults turns fault injection on or off without changing the faults
+func (c *Client) EnableFaults(ctx context.Context, enabled bool) error {
+	return c.do(ctx, http.MethodPut, "/faults", map[string]bool{"enabled": enabled}, nil)
+}
+
+// Requests returns the journal entries matching q, oldest first
+func (c *Client) Requests(ctx context.Context, q RequestQuery) ([]Request, error) {
+	var reqs []Request
+	p := "/requests"
+	if v := q.values(); len(v) > 0 {
+		p += "?" + v.Encode()
+	}
+	return reqs, c.do(ctx, http.MethodGet, p, nil, &reqs)
+}
+
+// ClearRequests empties the request journal
+func (c *Client) ClearRequests(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/requests", nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, p string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+AdminPath+p, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		apiErr := &Error{StatusCode: res.StatusCode}
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&msg); err == nil {
+			apiErr.Message = msg.Message
+		}
+		return apiErr
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
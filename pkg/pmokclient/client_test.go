@@ -0,0 +1,137 @@
+package pmokclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/protomoks/pmok/pkg/pmokclient"
+)
+
+func TestClient(t *testing.T) {
+	var scenarioBody map[string]string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /__pmok/mocks", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"method":"GET","path":"/users/:id","source":"protomok/mocks/_users.json"}]`))
+	})
+	mux.HandleFunc("PUT /__pmok/scenarios/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("name") != "order polling" {
+			t.Errorf("unexpected scenario name %s", r.PathValue("name"))
+		}
+		json.NewDecoder(r.Body).Decode(&scenarioBody)
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("POST /__pmok/scenarios/reset", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("PUT /__pmok/mocks", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"expected a mock spec"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	c := pmokclient.New(server.URL + "/")
+
+	mocks, err := c.ListMocks(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mocks) != 1 || mocks[0].Path != "/users/:id" {
+		t.Fatalf("unexpected mocks %+v", mocks)
+	}
+
+	if err := c.SetScenarioState(ctx, "order polling", "failed"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if scenarioBody["state"] != "failed" {
+		t.Fatalf("expected state failed to be sent, but got %v", scenarioBody)
+	}
+
+	if err := c.ResetScenarios(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = c.PutMock(ctx, pmokclient.MockSpec{})
+	var apiErr *pmokclient.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected a *pmokclient.Error, but got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "expected a mock spec" {
+		t.Fatalf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestPutMockSendsSpec(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	spec := pmokclient.MockSpec{
+		Request: pmokclient.MockRequest{Method: "GET", RequestPath: "/users/:id"},
+		Response: pmokclient.MockResponse{
+			SpecResponse: pmokclient.SpecResponse{Status: http.StatusOK},
+			Body:         json.RawMessage(`{"id":12345678901234567890,"b":1,"a":2}`),
+		},
+		Faults: &pmokclient.Faults{Latency: &pmokclient.Latency{FixedMs: 10}},
+	}
+	if err := pmokclient.New(server.URL).PutMock(context.Background(), spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the spec is sent in the format of the spec files, bodies as they are
+	for _, want := range []string{`"path":"/users/:id"`, `"body":{"id":12345678901234567890,"b":1,"a":2}`, `"faults":{"latency":{"fixedMs":10}}`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s in the request, but got %s", want, got)
+		}
+	}
+}
+
+func TestPutMockScenario(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// every part of a spec can be built with the types of pmokclient
+	spec := pmokclient.MockSpec{
+		Request: pmokclient.MockRequest{Method: "GET", RequestPath: "/jobs/:id"},
+		Scenario: &pmokclient.MockScenario{
+			Name: "job",
+			States: map[string]pmokclient.MockSequence{
+				pmokclient.DefaultScenarioState: {
+					Mode: pmokclient.SequenceLoop,
+					Responses: []pmokclient.MockResponse{
+						{SpecResponse: pmokclient.SpecResponse{Status: http.StatusAccepted}},
+						{SpecResponse: pmokclient.SpecResponse{Status: http.StatusOK}, Events: []pmokclient.MockEvent{{At: 0, Data: "data: done\n\n"}}},
+					},
+				},
+			},
+		},
+		WebSocket: &pmokclient.MockWebSocket{
+			Messages: []pmokclient.MockMessage{{From: pmokclient.FromServer, Type: pmokclient.MessageText, Data: "hello"}},
+			Rules:    []pmokclient.MockMessageRule{{Match: "^ping", Reply: "pong"}},
+		},
+		Graphql: &pmokclient.MockGraphql{OperationName: "GetJob"},
+	}
+	if err := pmokclient.New(server.URL).PutMock(context.Background(), spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`"scenario":{"name":"job","states":{"default":{"mode":"loop","responses":[{"status":202`, `"events":[{"at":0,"data":"data: done\n\n"}]`, `"rules":[{"match":"^ping","reply":"pong"}]`, `"operationName":"GetJob"`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s in the request, but got %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package pmokclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// RequestMatcher selects journal entries on the client side. Zero values
+// match all requests
+type RequestMatcher struct {
+	Method string
+	// Path is an exact path or a URL pattern such as /orders/:id, read like
+	// the mock server does: :name matches a segment and * matches the rest,
+	// slashes included
+	Path string
+	// Headers must all be present with the given values
+	Headers map[string]string
+	// Body is a regular expression the raw body must match
+	Body string
+	// BodyJSON must be contained in the JSON body. Objects match when every
+	// key of BodyJSON matches, other values must be equal
+	BodyJSON any
+}
+
+func (m RequestMatcher) String() string {
+	var parts []string
+	method, path := m.Method, m.Path
+	if method == "" {
+		method = "*"
+	}
+	if path == "" {
+		path = "*"
+	}
+	parts = append(parts, strings.ToUpper(method)+" "+path)
+	for k, v := range m.Headers {
+		parts = append(parts, fmt.Sprintf("header %s=%s", k, v))
+	}
+	if m.Body != "" {
+		parts = append(parts, fmt.Sprintf("body =~ %s", m.Body))
+	}
+	if m.BodyJSON != nil {
+		b, _ := json.Marshal(m.BodyJSON)
+		parts = append(parts, fmt.Sprintf("body contains %s", b))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Matches reports whether the journaled request matches
+func (m RequestMatcher) Matches(r Request) (bool, error) {
+	c, err := m.compile()
+	if err != nil {
+		return false, err
+	}
+	return c.matches(r, true), nil
+}
+
+// compiledMatcher is a RequestMatcher ready to match many requests
+type compiledMatcher struct {
+	RequestMatcher
+	path *regexp.Regexp
+	body *regexp.Regexp
+	// bodyJSON is BodyJSON in the shape encoding/json decodes to
+	bodyJSON any
+}
+
+func (m RequestMatcher) compile() (*compiledMatcher, error) {
+	c := &compiledMatcher{RequestMatcher: m}
+	var err error
+	if m.Path != "" {
+		if c.path, err = pathRegexp(m.Path); err != nil {
+			return nil, err
+		}
+	}
+	if m.Body != "" {
+		if c.body, err = regexp.Compile(m.Body); err != nil {
+			return nil, err
+		}
+	}
+	if m.BodyJSON != nil {
+		b, err := json.Marshal(m.BodyJSON)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &c.bodyJSON); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// matches reports whether r matches, its path only when path is set
+func (c *compiledMatcher) matches(r Request, path bool) bool {
+	if c.Method != "" && !strings.EqualFold(c.Method, r.Method) {
+		return false
+	}
+	if path && c.path != nil && !c.path.MatchString(r.Path) {
+		return false
+	}
+	for k, v := range c.Headers {
+		if r.Headers.Get(k) != v {
+			return false
+		}
+	}
+	if c.body != nil && !c.body.MatchString(r.Body) {
+		return false
+	}
+	if c.bodyJSON != nil {
+		var got any
+		if err := json.Unmarshal([]byte(r.Body), &got); err != nil {
+			return false
+		}
+		if !containsJSON(got, c.bodyJSON) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathParam is a :name of a URL pattern
+var pathParam = regexp.MustCompile(`^:[A-Za-z_$][A-Za-z0-9_$]*`)
+
+// pathRegexp compiles a path pattern the way URLPattern reads it on the mock
+// server: :name matches one segment and * matches anything
+func pathRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); {
+		if pattern[i] == '*' {
+			b.WriteString(".*")
+			i++
+			continue
+		}
+		if name := pathParam.FindString(pattern[i:]); name != "" {
+			b.WriteString("[^/]+")
+			i += len(name)
+			continue
+		}
+		b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		i++
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func containsJSON(got, want any) bool {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !containsJSON(g[k], v) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !containsJSON(g[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return got == want
+}
+
+// Find returns the journaled requests matching m, oldest first
+func (c *Client) Find(ctx context.Context, m RequestMatcher) ([]Request, error) {
+	cm, err := m.compile()
+	if err != nil {
+		return nil, err
+	}
+	reqs, err := c.Requests(ctx, RequestQuery{Method: m.Method, Path: m.Path})
+	if err != nil {
+		return nil, err
+	}
+	var found []Request
+	for _, r := range reqs {
+		// the server already filtered the paths with URLPattern
+		if cm.matches(r, false) {
+			found = append(found, r)
+		}
+	}
+	return found, nil
+}
+
+// VerificationError is returned when the number of matching requests is
+// not the expected one
+type VerificationError struct {
+	Matcher RequestMatcher
+	Want    string
+	Got     int
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("expected %s requests matching %s, but got %d", e.Want, e.Matcher, e.Got)
+}
+
+// Verify checks that exactly times requests matching m were received
+func (c *Client) Verify(ctx context.Context, m RequestMatcher, times int) error {
+	found, err := c.Find(ctx, m)
+	if err != nil {
+		return err
+	}
+	if len(found) != times {
+		return &VerificationError{Matcher: m, Want: fmt.Sprintf("exactly %d", times), Got: len(found)}
+	}
+	return nil
+}
+
+// VerifyAtLeast checks that at least times requests matching m were received
+func (c *Client) VerifyAtLeast(ctx context.Context, m RequestMatcher, times int) error {
+	found, err := c.Find(ctx, m)
+	if err != nil {
+		return err
+	}
+	if len(found) < times {
+		return &VerificationError{Matcher: m, Want: fmt.Sprintf("at least %d", times), Got: len(found)}
+	}
+	return nil
+}
+
+// AssertCalled fails the test unless exactly times requests matching m
+// were received
+func AssertCalled(t testing.TB, c *Client, m RequestMatcher, times int) {
+	t.Helper()
+	if err := c.Verify(context.Background(), m, times); err != nil {
+		t.Error(err)
+	}
+}
+
+// AssertNotCalled fails the test if any request matching m was received
+func AssertNotCalled(t testing.TB, c *Client, m RequestMatcher) {
+	t.Helper()
+	AssertCalled(t, c, m, 0)
+}
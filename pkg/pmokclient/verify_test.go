@@ -0,0 +1,98 @@
+package pmokclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/protomoks/pmok/pkg/pmokclient"
+)
+
+func TestRequestMatcher(t *testing.T) {
+	req := pmokclient.Request{
+		Method:  "POST",
+		Path:    "/orders/42",
+		Headers: http.Header{"Content-Type": []string{"application/json"}},
+		Body:    `{"sku":"abc","quantity":2,"meta":{"source":"web"}}`,
+	}
+
+	cases := []struct {
+		name    string
+		matcher pmokclient.RequestMatcher
+		want    bool
+	}{
+		{name: "empty", matcher: pmokclient.RequestMatcher{}, want: true},
+		{name: "method", matcher: pmokclient.RequestMatcher{Method: "post"}, want: true},
+		{name: "other method", matcher: pmokclient.RequestMatcher{Method: "GET"}, want: false},
+		{name: "path pattern", matcher: pmokclient.RequestMatcher{Path: "/orders/:id"}, want: true},
+		{name: "other path", matcher: pmokclient.RequestMatcher{Path: "/orders"}, want: false},
+		{name: "wildcard", matcher: pmokclient.RequestMatcher{Path: "/orders/*"}, want: true},
+		{name: "wildcard over segments", matcher: pmokclient.RequestMatcher{Path: "/*/42"}, want: true},
+		{name: "param is one segment", matcher: pmokclient.RequestMatcher{Path: "/:resource"}, want: false},
+		{name: "header", matcher: pmokclient.RequestMatcher{Headers: map[string]string{"content-type": "application/json"}}, want: true},
+		{name: "body regexp", matcher: pmokclient.RequestMatcher{Body: `"sku":"a.c"`}, want: true},
+		{name: "body json subset", matcher: pmokclient.RequestMatcher{BodyJSON: map[string]any{"quantity": 2, "meta": map[string]string{"source": "web"}}}, want: true},
+		{name: "body json mismatch", matcher: pmokclient.RequestMatcher{BodyJSON: map[string]any{"quantity": 3}}, want: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := c.matcher.Matches(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.want {
+				t.Fatalf("expected %v, but got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("method") != "POST" {
+			t.Errorf("expected the method filter to be sent, got %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`[
+			{"method":"POST","path":"/orders","body":"{\"sku\":\"abc\"}"},
+			{"method":"POST","path":"/orders","body":"{\"sku\":\"abc\"}"},
+			{"method":"POST","path":"/orders","body":"{\"sku\":\"xyz\"}"}
+		]`))
+	}))
+	defer server.Close()
+
+	c := pmokclient.New(server.URL)
+	m := pmokclient.RequestMatcher{Method: "POST", Path: "/orders", BodyJSON: map[string]string{"sku": "abc"}}
+	if err := c.Verify(context.Background(), m, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := c.Verify(context.Background(), m, 1)
+	var verr *pmokclient.VerificationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *pmokclient.VerificationError, but got %v", err)
+	}
+	if verr.Got != 2 {
+		t.Fatalf("expected 2 matching requests, but got %d", verr.Got)
+	}
+}
+
+func TestFindWildcard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") != "/users/*" {
+			t.Errorf("expected the path filter to be sent, got %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`[{"method":"GET","path":"/users/1/orders"}, {"method":"GET","path":"/users/1"}]`))
+	}))
+	defer server.Close()
+
+	found, err := pmokclient.New(server.URL).Find(context.Background(), pmokclient.RequestMatcher{Path: "/users/*"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected both requests, but got %v", found)
+	}
+}
@@ -0,0 +1,104 @@
+// Package pmoktest serves the static mocks of a protomok project in-process,
+// for use in Go tests. Mocks recorded with pmok record can be used as test
+// fixtures directly:
+//
+//	func TestClient(t *testing.T) {
+//		srv := pmoktest.NewServer(t, "testdata/protomok")
+//		client := NewClient(srv.URL)
+//		...
+//	}
+//
+// Functions need the Deno runtime of pmok serve and are not served.
+package pmoktest
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/protomoks/pmok/internal/config"
+	"github.com/protomoks/pmok/internal/graphqlmock"
+	"github.com/protomoks/pmok/internal/mockserver"
+)
+
+// Server is a running in-process mock server
+type Server struct {
+	// URL is the base url of the server, e.g. http://127.0.0.1:54321
+	URL     string
+	server  *httptest.Server
+	handler *mockserver.Handler
+}
+
+// NewServer starts a mock server for the protomok project at dir. dir can be
+// the project root or its protomok directory. The server is closed when the
+// test and its subtests complete
+func NewServer(t testing.TB, dir string) *Server {
+	t.Helper()
+	conf, err := config.ReadConfig(dir)
+	if err != nil {
+		t.Fatalf("pmoktest: unable to read the protomok project at %s: %v", dir, err)
+	}
+	h, err := mockserver.Load(filepath.Join(conf.GetProjectDir(), config.MocksDir), conf.Manifest.Scenarios)
+	if err != nil {
+		t.Fatalf("pmoktest: unable to load mocks: %v", err)
+	}
+	if err := conf.Manifest.ValidateFaults(); err != nil {
+		t.Fatalf("pmoktest: invalid faults: %v", err)
+	}
+	h.SetFaults(conf.Manifest.Faults)
+	if server := conf.Manifest.Server; server != nil && server.StreamSpeed != nil {
+		h.SetStreamSpeed(*server.StreamSpeed)
+	}
+	var schema *graphqlmock.Schema
+	if g := conf.Manifest.Graphql; g != nil && g.Schema != "" {
+		schema, err = graphqlmock.LoadSchema(filepath.Join(conf.GetProjectDir(), config.ProtomokDir, g.Schema))
+		if err != nil {
+			t.Fatalf("pmoktest: unable to load the graphql schema: %v", err)
+		}
+	}
+	h.SetGraphql(conf.Manifest.Graphql.GraphqlPath(), schema)
+	if n := len(conf.Manifest.Functions); n > 0 {
+		t.Logf("pmoktest: %d functions are not served in-process, use pmok serve for them", n)
+	}
+
+	s := &Server{
+		server:  httptest.NewServer(h),
+		handler: h,
+	}
+	s.URL = s.server.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close shuts the server down. It is called automatically at test cleanup
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Mocks returns the number of loaded mocks
+func (s *Server) Mocks() int {
+	return s.handler.Len()
+}
+
+// ResetScenarios restores the scenario states of the manifest and rewinds
+// every sequence to its first response
+func (s *Server) ResetScenarios() {
+	s.handler.ResetScenarios()
+}
+
+// SetStreamSpeed scales the timing of replayed event streams and WebSocket
+// conversations, 2 replays twice as fast and 0 without delays
+func (s *Server) SetStreamSpeed(speed float64) {
+	s.handler.SetStreamSpeed(speed)
+}
+
+// EnableFaults turns the fault injection of the manifest and of the mocks on
+// or off, it is on by default
+func (s *Server) EnableFaults(enabled bool) {
+	s.handler.EnableFaults(enabled)
+}
+
+// SetScenarioState switches a scenario to another state
+func (s *Server) SetScenarioState(name, state string) {
+	s.handler.SetScenarioState(name, state)
+}
@@ -0,0 +1,243 @@
+package pmoktest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/protomoks/pmok/internal/testutil"
+	"github.com/protomoks/pmok/pkg/pmoktest"
+)
+
+const userMock = `{
+ "request": {"method": "GET", "path": "/users/:id"},
+ "response": {
+  "status": 200,
+  "template": true,
+  "headers": {"Content-Type": ["application/json"]},
+  "body": {"id": "{{request.params.id}}", "name": "ada"}
+ }
+}`
+
+const orderMock = `{
+ "request": {"method": "GET", "path": "/orders/1"},
+ "response": {"status": 200, "headers": {}, "body": {"state": "done"}},
+ "scenario": {
+  "name": "polling",
+  "states": {
+   "default": {"responses": [
+    {"status": 202, "headers": {}, "body": {"state": "pending"}},
+    {"status": 200, "headers": {}, "body": {"state": "done"}}
+   ]}
+  }
+ }
+}`
+
+func newProject(t *testing.T) string {
+	t.Helper()
+	root := testutil.NewProject(t, map[string]string{
+		"pmok.yaml":             "version: \"0.01\"\nproject:\n  name: test\nfunctions: {}\n",
+		"mocks/_users_:id.json": userMock,
+		"mocks/_orders_1.json":  orderMock,
+	})
+	return filepath.Join(root, "protomok")
+}
+
+func get(t *testing.T, url string) (int, map[string]any) {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	var body map[string]any
+	json.NewDecoder(res.Body).Decode(&body)
+	return res.StatusCode, body
+}
+
+func TestNewServer(t *testing.T) {
+	srv := pmoktest.NewServer(t, newProject(t))
+	if srv.Mocks() != 2 {
+		t.Fatalf("expected 2 mocks, but got %d", srv.Mocks())
+	}
+
+	status, body := get(t, srv.URL+"/users/42")
+	if status != http.StatusOK || body["id"] != "42" {
+		t.Fatalf("expected the requested id to be echoed, got %d %v", status, body)
+	}
+
+	if status, _ := get(t, srv.URL+"/missing"); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown routes, but got %d", status)
+	}
+
+	for i, want := range []int{202, 200, 200} {
+		if status, _ := get(t, srv.URL+"/orders/1"); status != want {
+			t.Fatalf("call %d: expected status %d, but got %d", i, want, status)
+		}
+	}
+	srv.ResetScenarios()
+	if status, _ := get(t, srv.URL+"/orders/1"); status != 202 {
+		t.Fatalf("expected the sequence to restart after a reset, but got %d", status)
+	}
+}
+
+const streamMock = `{
+ "request": {"method": "GET", "path": "/events"},
+ "response": {
+  "status": 200,
+  "headers": {"Content-Type": ["text/event-stream"]},
+  "events": [
+   {"at": 0, "data": "data: 1\n\n"},
+   {"at": 200, "data": "data: 2\n\n"}
+  ]
+ }
+}`
+
+func TestStreams(t *testing.T) {
+	dir := newProject(t)
+	testutil.WriteFiles(t, dir, map[string]string{"mocks/_events.json": streamMock})
+	srv := pmoktest.NewServer(t, dir)
+	// only lower bounds are asserted, a slow machine may take longer
+	cases := []struct {
+		speed float64
+		min   time.Duration
+	}{
+		{speed: 1, min: 200 * time.Millisecond},
+		{speed: 4, min: 50 * time.Millisecond},
+		{speed: 0},
+	}
+	for _, c := range cases {
+		srv.SetStreamSpeed(c.speed)
+		start := time.Now()
+		res, err := http.Get(srv.URL + "/events")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		took := time.Since(start)
+		if string(body) != "data: 1\n\ndata: 2\n\n" {
+			t.Fatalf("expected both events in order, but got %q", body)
+		}
+		if took < c.min {
+			t.Fatalf("expected speed %v to take at least %v, but took %v", c.speed, c.min, took)
+		}
+	}
+}
+
+const socketMock = `{
+ "request": {"method": "GET", "path": "/socket"},
+ "websocket": {
+  "messages": [
+   {"at": 0, "from": "server", "data": "hello"},
+   {"at": 10, "from": "client", "data": "ping"},
+   {"at": 20, "from": "server", "type": "binary", "data": "AQI="},
+   {"at": 30, "from": "server", "type": "close", "code": 1000, "data": "bye"}
+  ],
+  "rules": [{"match": "^ping", "reply": "pong"}]
+ }
+}`
+
+func TestWebSocket(t *testing.T) {
+	dir := newProject(t)
+	testutil.WriteFiles(t, dir, map[string]string{"mocks/_socket.json": socketMock})
+	srv := pmoktest.NewServer(t, dir)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/socket", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	read := func() string {
+		t.Helper()
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			return err.Error()
+		}
+		if typ == websocket.BinaryMessage {
+			return fmt.Sprint(data)
+		}
+		return string(data)
+	}
+	if got := read(); got != "hello" {
+		t.Fatalf("expected hello, but got %s", got)
+	}
+	// the conversation waits for the client
+	conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+	if got := read(); got != "pong" {
+		t.Fatalf("expected the rule to reply pong, but got %s", got)
+	}
+	if got := read(); got != "[1 2]" {
+		t.Fatalf("expected the binary message, but got %s", got)
+	}
+	if got := read(); !strings.Contains(got, "1000") || !strings.Contains(got, "bye") {
+		t.Fatalf("expected the server to close with 1000 bye, but got %s", got)
+	}
+
+	res, err := http.Get(srv.URL + "/socket")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("expected 426 without an upgrade, but got %d", res.StatusCode)
+	}
+}
+
+const graphqlSchema = `type Query {
+  user(id: ID!): User
+}
+
+type User {
+  id: ID!
+  name: String!
+}
+`
+
+func TestGraphql(t *testing.T) {
+	dir := newProject(t)
+	testutil.WriteFiles(t, dir, map[string]string{
+		"pmok.yaml":      "version: \"0.01\"\nproject:\n  name: test\nfunctions: {}\ngraphql:\n  schema: schema.graphql\n",
+		"schema.graphql": graphqlSchema,
+		"mocks/_graphql.GetUser.json": `{
+ "request": {"method": "POST", "path": "/graphql"},
+ "graphql": {"operationName": "GetUser"},
+ "response": {"status": 200, "headers": {}, "body": {"data": {"user": {"id": "any"}}}}
+}`,
+		"mocks/_graphql.GetUser.1.json": `{
+ "request": {"method": "POST", "path": "/graphql"},
+ "graphql": {"operationName": "GetUser", "variables": {"id": "1"}},
+ "response": {"status": 200, "headers": {}, "body": {"data": {"user": {"id": "one"}}}}
+}`,
+	})
+	srv := pmoktest.NewServer(t, dir)
+
+	cases := []struct {
+		body string
+		want string
+	}{
+		{body: `{"query": "query GetUser($id: ID!) { user(id: $id) { id } }", "variables": {"id": "1"}}`, want: `{"data":{"user":{"id":"one"}}}`},
+		{body: `{"query": "query GetUser($id: ID!) { user(id: $id) { id } }", "variables": {"id": "2"}}`, want: `{"data":{"user":{"id":"any"}}}`},
+		{body: `{"query": "query Other { user(id: \"1\") { id name } }"}`, want: `{"data":{"user":{"id":"1","name":"Hello World"}}}`},
+	}
+	for _, c := range cases {
+		res, err := http.Post(srv.URL+"/graphql", "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		var got bytes.Buffer
+		json.Compact(&got, body)
+		if got.String() != c.want {
+			t.Fatalf("expected %s, but got %s", c.want, body)
+		}
+	}
+}